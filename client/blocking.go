@@ -0,0 +1,67 @@
+package client
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/auvn/go.cache/net/serializer"
+)
+
+// the blocking pops hold their connection until the reply arrives, so they
+// are not sent through the shared callers
+func (self *cache) blocking(keys []string, cmdDef *CommandDefinition) (serializer.Payload, error) {
+	conn, err := self.client.(connClient).conn(keys)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.p.Put(conn)
+	return execute(conn, cmdDef.Payload())
+}
+
+// the timeout is sent in seconds
+func formatTimeout(timeout time.Duration) string {
+	return strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)
+}
+
+func (self *cache) blockingPop(name string, timeout time.Duration, keys []string) (string, []byte, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	args = append(args, formatTimeout(timeout))
+	p, err := self.blocking(keys, NewCommandDefinition(name, args...))
+	if err != nil || p.IsNil() {
+		return "", nil, err
+	}
+	// the key and the value
+	kv, err := p.Array()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(kv) != 2 {
+		return "", nil, serializer.ErrPayloadNonArray
+	}
+	key, err := kv[0].Str()
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := kv[1].Bytes()
+	return key, value, err
+}
+
+func (self *cache) BLPop(timeout time.Duration, keys ...string) (string, []byte, error) {
+	return self.blockingPop(BLPopCommand, timeout, keys)
+}
+
+func (self *cache) BRPop(timeout time.Duration, keys ...string) (string, []byte, error) {
+	return self.blockingPop(BRPopCommand, timeout, keys)
+}
+
+func (self *cache) BRPopLPush(source, destination string, timeout time.Duration) ([]byte, error) {
+	cmdDef := NewCommandDefinition(BRPopLPushCommand, source, destination, formatTimeout(timeout))
+	p, err := self.blocking([]string{source, destination}, cmdDef)
+	if err != nil || p.IsNil() {
+		return nil, err
+	}
+	return p.Bytes()
+}
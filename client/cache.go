@@ -1,31 +1,105 @@
 package client
 
-import "time"
+import (
+	"time"
+
+	"github.com/auvn/go.cache/net/serializer"
+)
 
 const (
 	AuthCommand   = "AUTH"
 	DelCommand    = "DEL"
 	KeysCommand   = "KEYS"
+	InfoCommand   = "INFO"
 	TTLCommand    = "TTL"
 	ExpireCommand = "EXPIRE"
 
+	PTTLCommand      = "PTTL"
+	PExpireCommand   = "PEXPIRE"
+	PExpireAtCommand = "PEXPIREAT"
+	PersistCommand   = "PERSIST"
+
 	//string
-	SetCommand = "SET"
-	GetCommand = "GET"
+	SetCommand    = "SET"
+	GetCommand    = "GET"
+	GetSetCommand = "GETSET"
+
+	IncrCommand        = "INCR"
+	DecrCommand        = "DECR"
+	IncrByCommand      = "INCRBY"
+	DecrByCommand      = "DECRBY"
+	IncrByFloatCommand = "INCRBYFLOAT"
 
 	//list
-	LPushCommand  = "LPUSH"
-	RPushCommand  = "RPUSH"
-	LPopCommand   = "LPOP"
-	RPopCommand   = "RPOP"
-	LRangeCommand = "LRANGE"
-	LIndexCommand = "LINDEX"
+	LPushCommand     = "LPUSH"
+	RPushCommand     = "RPUSH"
+	LPopCommand      = "LPOP"
+	RPopCommand      = "RPOP"
+	LRangeCommand    = "LRANGE"
+	LIndexCommand    = "LINDEX"
+	LLenCommand      = "LLEN"
+	LSetCommand      = "LSET"
+	LInsertCommand   = "LINSERT"
+	LRemCommand      = "LREM"
+	LTrimCommand     = "LTRIM"
+	RPopLPushCommand = "RPOPLPUSH"
+	LMoveCommand     = "LMOVE"
+
+	BLPopCommand      = "BLPOP"
+	BRPopCommand      = "BRPOP"
+	BRPopLPushCommand = "BRPOPLPUSH"
+
+	//pubsub
+	PublishCommand      = "PUBLISH"
+	SubscribeCommand    = "SUBSCRIBE"
+	PSubscribeCommand   = "PSUBSCRIBE"
+	UnsubscribeCommand  = "UNSUBSCRIBE"
+	PUnsubscribeCommand = "PUNSUBSCRIBE"
+
+	//transaction
+	MultiCommand   = "MULTI"
+	ExecCommand    = "EXEC"
+	WatchCommand   = "WATCH"
+	UnwatchCommand = "UNWATCH"
 
 	//hash
-	HSetCommand  = "HSET"
-	HGetCommand  = "HGET"
-	HKeysCommand = "HKEYS"
-	HDelCommand  = "HDEL"
+	HSetCommand    = "HSET"
+	HGetCommand    = "HGET"
+	HKeysCommand   = "HKEYS"
+	HDelCommand    = "HDEL"
+	HMSetCommand   = "HMSET"
+	HMGetCommand   = "HMGET"
+	HGetAllCommand = "HGETALL"
+	HValsCommand   = "HVALS"
+	HLenCommand    = "HLEN"
+	HExistsCommand = "HEXISTS"
+	HSetNXCommand  = "HSETNX"
+
+	HIncrByCommand = "HINCRBY"
+
+	HExpireCommand    = "HEXPIRE"
+	HPExpireAtCommand = "HPEXPIREAT"
+	HTTLCommand       = "HTTL"
+	HPersistCommand   = "HPERSIST"
+
+	//set
+	SAddCommand      = "SADD"
+	SRemCommand      = "SREM"
+	SIsMemberCommand = "SISMEMBER"
+	SMembersCommand  = "SMEMBERS"
+	SCardCommand     = "SCARD"
+	SInterCommand    = "SINTER"
+	SUnionCommand    = "SUNION"
+	SDiffCommand     = "SDIFF"
+
+	//sorted set
+	ZAddCommand          = "ZADD"
+	ZRemCommand          = "ZREM"
+	ZScoreCommand        = "ZSCORE"
+	ZRankCommand         = "ZRANK"
+	ZCardCommand         = "ZCARD"
+	ZRangeCommand        = "ZRANGE"
+	ZRangeByScoreCommand = "ZRANGEBYSCORE"
 )
 
 var (
@@ -37,43 +111,215 @@ var (
 	}
 )
 
+// SetOptions control conditional and expiring SET
+type SetOptions struct {
+	NX  bool // only if the key does not exist
+	XX  bool // only if the key exists
+	TTL time.Duration // rounded up to milliseconds
+}
+
+// the milliseconds of the ttl rounded up, so a ttl under 1ms does not become 0
+func ttlMillis(ttl time.Duration) int {
+	ms := ttl / time.Millisecond
+	if ttl%time.Millisecond > 0 {
+		ms += 1
+	}
+	return int(ms)
+}
+
+// the unix time of the deadline in milliseconds, UnixNano overflows after 2262
+func unixMillis(deadline time.Time) int {
+	return int(deadline.Unix()*1000 + int64(deadline.Nanosecond())/int64(time.Millisecond))
+}
+
+// nil options are a plain SET
+func (self *SetOptions) args() []interface{} {
+	args := make([]interface{}, 0, 3)
+	if self == nil {
+		return args
+	}
+	if self.NX {
+		args = append(args, "NX")
+	}
+	if self.XX {
+		args = append(args, "XX")
+	}
+	if self.TTL%time.Second == 0 && self.TTL > 0 {
+		args = append(args, "EX", int(self.TTL/time.Second))
+	} else if self.TTL > 0 {
+		args = append(args, "PX", ttlMillis(self.TTL))
+	}
+	return args
+}
+
 type Options struct {
 	Addrs       []string
 	Auth        string
 	PoolSize    int
 	DialTimeout time.Duration
+	// the weights of the addresses, 1 by default,
+	// a server of weight 2 serves twice as many keys as a server of weight 1
+	Weights map[string]int
+	// the hash of the keys and the virtual nodes, crc32 by default
+	Hash HashFunc
+	// the number of the virtual nodes per weight unit, DefaultVirtualNodes by default
+	VirtualNodes int
+	// assigns the keys to the addresses, a consistent-hash ring by default,
+	// it is filled with Addrs by the client
+	Ring Ring
 }
 
 type Cache interface {
+	Commands
+	// AddAddr starts sending the keys to the server or changes its weight.
+	AddAddr(addr string, weight int) error
+	// RemoveAddr sends the keys of the server to the other ones.
+	RemoveAddr(addr string) error
+	Addrs() []string
+
+	// Exec executes the commands queued by fn atomically, their results are
+	// available once Exec returns. The keys have to be served by the same server.
+	Exec(fn func(Commands)) error
+	// Watch calls fn with a transaction, which is executed only if the keys
+	// are not changed since Watch is called, ErrTxAborted otherwise.
+	Watch(fn func(Tx) error, keys ...string) error
+
+	// BLPop pops the head of the first non-empty list of the keys, it waits
+	// for an element up to the timeout, zero waits indefinitely. The key is
+	// empty once the timeout elapses. The keys have to be served by the same server.
+	BLPop(timeout time.Duration, keys ...string) (string, []byte, error)
+	// BRPop pops the tail of the first non-empty list of the keys.
+	BRPop(timeout time.Duration, keys ...string) (string, []byte, error)
+	// BRPopLPush moves the tail of the source to the head of the destination,
+	// the value is nil once the timeout elapses.
+	BRPopLPush(source, destination string, timeout time.Duration) ([]byte, error)
+}
+
+// Commands are sent once their results are read.
+type Commands interface {
 	Del(keys ...string) IntCommand
 	Keys() StringSliceCommand
+	Info() StringSliceCommand
 	TTL(key string) IntCommand
 	Expire(key string, ttl int) BoolCommand
+	ExpireAt(key string, deadline time.Time) BoolCommand
+	PExpire(key string, ttl time.Duration) BoolCommand
+	Persist(key string) BoolCommand
+	PTTL(key string) DurationCommand
+
+	// Publish sends the message to the server of the channel, returns the number of the subscribers it is sent to.
+	Publish(channel string, message []byte) IntCommand
 
 	Get(key string) BytesCommand
 	Set(key string, value []byte) BoolCommand
+	SetWithOptions(key string, value []byte, opts *SetOptions) BoolCommand
+	GetSet(key string, value []byte) BytesCommand
+
+	Decr(key string) IntCommand
+	DecrBy(key string, delta int) IntCommand
+	Incr(key string) IntCommand
+	IncrBy(key string, delta int) IntCommand
+	IncrByFloat(key string, delta float64) FloatCommand
 
-	LIndex(key string) BytesCommand
+	LIndex(key string, index int) BytesCommand
 	LPop(key string) BytesCommand
 	LPush(key string, values ...[]byte) IntCommand
 	LRange(key string, start int, stop int) BytesSliceCommand
 	RPop(key string) BytesCommand
 	RPush(key string, values ...[]byte) IntCommand
+	LLen(key string) IntCommand
+	LSet(key string, index int, value []byte) BoolCommand
+	// LInsertBefore returns the length of the list, -1 if there is no pivot.
+	LInsertBefore(key string, pivot, value []byte) IntCommand
+	LInsertAfter(key string, pivot, value []byte) IntCommand
+	// LRem removes count values from the head, from the tail if count is negative, all of them if it is zero.
+	LRem(key string, count int, value []byte) IntCommand
+	LTrim(key string, start int, stop int) BoolCommand
+	// RPopLPush moves the tail of the source to the head of the destination,
+	// the keys have to be served by the same server.
+	RPopLPush(source, destination string) BytesCommand
+	// LMove moves the head or the tail of the source to the head or the tail of the destination.
+	LMove(source, destination string, fromBeginning, toBeginning bool) BytesCommand
 
 	HDel(key string, hashKeys ...[]byte) IntCommand
 	HGet(key string, hashKey []byte) BytesCommand
+	HIncrBy(key string, hashKey []byte, delta int) IntCommand
 	HKeys(key string) StringSliceCommand
 	HSet(key string, hashKey []byte, value []byte) BoolCommand
+	HMSet(key string, values map[string][]byte) BoolCommand
+	// HMGet returns the values of the hash keys, the missing ones are omitted.
+	HMGet(key string, hashKeys ...[]byte) BytesMapCommand
+	HGetAll(key string) BytesMapCommand
+	HVals(key string) BytesSliceCommand
+	HLen(key string) IntCommand
+	HExists(key string, hashKey []byte) BoolCommand
+	// HSetNX sets the value only if there is no hash key, false otherwise.
+	HSetNX(key string, hashKey []byte, value []byte) BoolCommand
+	// HExpire sets the TTL of the hash keys in seconds, the replies are in the order of the keys:
+	// 1 if the TTL is set, 2 if the key is deleted by zero TTL, -2 if there is no such key.
+	HExpire(key string, ttl int, hashKeys ...[]byte) IntSliceCommand
+	HExpireAt(key string, deadline time.Time, hashKeys ...[]byte) IntSliceCommand
+	// HTTL returns the remaining seconds of the hash keys, -1 if a key has no TTL,
+	// -2 if there is no such key.
+	HTTL(key string, hashKeys ...[]byte) IntSliceCommand
+	// HPersist removes the TTL of the hash keys, 1 if it is removed, -1 if a key has no TTL,
+	// -2 if there is no such key.
+	HPersist(key string, hashKeys ...[]byte) IntSliceCommand
+
+	SAdd(key string, members ...[]byte) IntCommand
+	SCard(key string) IntCommand
+	SDiff(keys ...string) BytesSliceCommand
+	SInter(keys ...string) BytesSliceCommand
+	SIsMember(key string, member []byte) BoolCommand
+	SMembers(key string) BytesSliceCommand
+	SRem(key string, members ...[]byte) IntCommand
+	SUnion(keys ...string) BytesSliceCommand
+
+	ZAdd(key string, score float64, member []byte) IntCommand
+	ZCard(key string) IntCommand
+	ZRange(key string, start int, stop int) BytesSliceCommand
+	ZRangeByScore(key string, min float64, max float64) BytesSliceCommand
+	ZRank(key string, member []byte) IntCommand
+	ZRem(key string, members ...[]byte) IntCommand
+	ZScore(key string, member []byte) FloatCommand
 }
 
 type cache struct {
 	client Client
+	// the commands of a transaction are queued, nil otherwise
+	queue *txQueue
 }
 
 func (self *cache) command(cmdDef *CommandDefinition) Command {
+	if self.queue != nil {
+		return self.queue.add(cmdDef)
+	}
 	return NewRemoteCommand(self.client, cmdDef)
 }
 
+func (self *cache) AddAddr(addr string, weight int) error {
+	if c, ok := self.client.(*multiClient); ok {
+		c.AddAddr(addr, weight)
+		return nil
+	}
+	return ErrStaticAddrs
+}
+
+func (self *cache) RemoveAddr(addr string) error {
+	if c, ok := self.client.(*multiClient); ok {
+		c.RemoveAddr(addr)
+		return nil
+	}
+	return ErrStaticAddrs
+}
+
+func (self *cache) Addrs() []string {
+	if c, ok := self.client.(*multiClient); ok {
+		return c.Addrs()
+	}
+	return []string{self.client.(*baseClient).addr}
+}
+
 func (self *cache) Del(keys ...string) IntCommand {
 	args := make([]interface{}, len(keys))
 	for i, k := range keys {
@@ -89,6 +335,18 @@ func (self *cache) Keys() StringSliceCommand {
 	)
 }
 
+// name/value pairs of server statistics, pairs of all servers are concatenated
+func (self *cache) Info() StringSliceCommand {
+	return self.command(
+		NewCommandDefinition(InfoCommand).WithType(NoKeyType),
+	)
+}
+
+func (self *cache) Publish(channel string, message []byte) IntCommand {
+	cmdDef := NewCommandDefinition(PublishCommand, channel, message)
+	return self.command(cmdDef)
+}
+
 func (self *cache) TTL(key string) IntCommand {
 	cmdDef := NewCommandDefinition(TTLCommand, key)
 	return self.command(cmdDef)
@@ -99,17 +357,73 @@ func (self *cache) Expire(key string, ttl int) BoolCommand {
 	return self.command(cmdDef)
 }
 
+func (self *cache) PExpire(key string, ttl time.Duration) BoolCommand {
+	cmdDef := NewCommandDefinition(PExpireCommand, key, ttlMillis(ttl))
+	return self.command(cmdDef)
+}
+
+func (self *cache) ExpireAt(key string, deadline time.Time) BoolCommand {
+	cmdDef := NewCommandDefinition(PExpireAtCommand, key, unixMillis(deadline))
+	return self.command(cmdDef)
+}
+
+func (self *cache) Persist(key string) BoolCommand {
+	cmdDef := NewCommandDefinition(PersistCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) PTTL(key string) DurationCommand {
+	cmdDef := NewCommandDefinition(PTTLCommand, key)
+	return self.command(cmdDef)
+}
+
 ///////////////////////// string ////////////////////////
 func (self *cache) Set(key string, value []byte) BoolCommand {
 	cmdDef := NewCommandDefinition(SetCommand, key, value)
 	return self.command(cmdDef)
 }
 
+func (self *cache) SetWithOptions(key string, value []byte, opts *SetOptions) BoolCommand {
+	args := append([]interface{}{key, value}, opts.args()...)
+	cmdDef := NewCommandDefinition(SetCommand, args...)
+	return self.command(cmdDef)
+}
+
+func (self *cache) GetSet(key string, value []byte) BytesCommand {
+	cmdDef := NewCommandDefinition(GetSetCommand, key, value)
+	return self.command(cmdDef)
+}
+
 func (self *cache) Get(key string) BytesCommand {
 	cmdDef := NewCommandDefinition(GetCommand, key)
 	return self.command(cmdDef)
 }
 
+func (self *cache) Incr(key string) IntCommand {
+	cmdDef := NewCommandDefinition(IncrCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) Decr(key string) IntCommand {
+	cmdDef := NewCommandDefinition(DecrCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) IncrBy(key string, delta int) IntCommand {
+	cmdDef := NewCommandDefinition(IncrByCommand, key, delta)
+	return self.command(cmdDef)
+}
+
+func (self *cache) DecrBy(key string, delta int) IntCommand {
+	cmdDef := NewCommandDefinition(DecrByCommand, key, delta)
+	return self.command(cmdDef)
+}
+
+func (self *cache) IncrByFloat(key string, delta float64) FloatCommand {
+	cmdDef := NewCommandDefinition(IncrByFloatCommand, key, delta)
+	return self.command(cmdDef)
+}
+
 ///////////////////////// list ////////////////////////
 func (self *cache) Push(beginning bool, key string, values ...[]byte) IntCommand {
 	var cmdName string
@@ -159,8 +473,60 @@ func (self *cache) LRange(key string, start int, stop int) BytesSliceCommand {
 	return self.command(cmdDef)
 }
 
-func (self *cache) LIndex(key string) BytesCommand {
-	cmdDef := NewCommandDefinition(LIndexCommand, key)
+func (self *cache) LIndex(key string, index int) BytesCommand {
+	cmdDef := NewCommandDefinition(LIndexCommand, key, index)
+	return self.command(cmdDef)
+}
+
+func (self *cache) LLen(key string) IntCommand {
+	cmdDef := NewCommandDefinition(LLenCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) LSet(key string, index int, value []byte) BoolCommand {
+	cmdDef := NewCommandDefinition(LSetCommand, key, index, value)
+	return self.command(cmdDef)
+}
+
+func (self *cache) lInsert(key string, where string, pivot, value []byte) IntCommand {
+	cmdDef := NewCommandDefinition(LInsertCommand, key, where, pivot, value)
+	return self.command(cmdDef)
+}
+
+func (self *cache) LInsertBefore(key string, pivot, value []byte) IntCommand {
+	return self.lInsert(key, "BEFORE", pivot, value)
+}
+
+func (self *cache) LInsertAfter(key string, pivot, value []byte) IntCommand {
+	return self.lInsert(key, "AFTER", pivot, value)
+}
+
+func (self *cache) LRem(key string, count int, value []byte) IntCommand {
+	cmdDef := NewCommandDefinition(LRemCommand, key, count, value)
+	return self.command(cmdDef)
+}
+
+func (self *cache) LTrim(key string, start int, stop int) BoolCommand {
+	cmdDef := NewCommandDefinition(LTrimCommand, key, start, stop)
+	return self.command(cmdDef)
+}
+
+func (self *cache) RPopLPush(source, destination string) BytesCommand {
+	cmdDef := NewCommandDefinition(RPopLPushCommand, source, destination).WithType(CrossKeyType)
+	return self.command(cmdDef)
+}
+
+func listEnd(beginning bool) string {
+	if beginning {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+func (self *cache) LMove(source, destination string, fromBeginning, toBeginning bool) BytesCommand {
+	cmdDef := NewCommandDefinition(LMoveCommand, source, destination, listEnd(fromBeginning), listEnd(toBeginning)).
+		WithType(CrossKeyType).
+		WithKeyCount(2)
 	return self.command(cmdDef)
 }
 
@@ -180,6 +546,11 @@ func (self *cache) HGet(key string, hashKey []byte) BytesCommand {
 	return self.command(cmdDef)
 }
 
+func (self *cache) HIncrBy(key string, hashKey []byte, delta int) IntCommand {
+	cmdDef := NewCommandDefinition(HIncrByCommand, key, hashKey, delta)
+	return self.command(cmdDef)
+}
+
 func (self *cache) HDel(key string, hashKeys ...[]byte) IntCommand {
 	args := make([]interface{}, 1+len(hashKeys))
 	args[0] = key
@@ -190,6 +561,257 @@ func (self *cache) HDel(key string, hashKeys ...[]byte) IntCommand {
 	return self.command(cmdDef)
 }
 
+func (self *cache) HMSet(key string, values map[string][]byte) BoolCommand {
+	args := make([]interface{}, 0, 1+2*len(values))
+	args = append(args, key)
+	for k, v := range values {
+		args = append(args, k, v)
+	}
+	cmdDef := NewCommandDefinition(HMSetCommand, args...)
+	return self.command(cmdDef)
+}
+
+func (self *cache) HMGet(key string, hashKeys ...[]byte) BytesMapCommand {
+	args := make([]interface{}, 1+len(hashKeys))
+	args[0] = key
+	for i, k := range hashKeys {
+		args[i+1] = k
+	}
+	cmdDef := NewCommandDefinition(HMGetCommand, args...)
+	return &fieldsCommand{RemoteCommand: self.command(cmdDef).(*RemoteCommand), fields: hashKeys}
+}
+
+func (self *cache) HGetAll(key string) BytesMapCommand {
+	cmdDef := NewCommandDefinition(HGetAllCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) HVals(key string) BytesSliceCommand {
+	cmdDef := NewCommandDefinition(HValsCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) HLen(key string) IntCommand {
+	cmdDef := NewCommandDefinition(HLenCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) HExists(key string, hashKey []byte) BoolCommand {
+	cmdDef := NewCommandDefinition(HExistsCommand, key, hashKey)
+	return self.command(cmdDef)
+}
+
+func (self *cache) HSetNX(key string, hashKey []byte, value []byte) BoolCommand {
+	cmdDef := NewCommandDefinition(HSetNXCommand, key, hashKey, value)
+	return self.command(cmdDef)
+}
+
+// the command of the hash keys following the arguments
+func (self *cache) hashKeysCommand(name string, hashKeys [][]byte, args ...interface{}) Command {
+	for _, k := range hashKeys {
+		args = append(args, k)
+	}
+	return self.command(NewCommandDefinition(name, args...))
+}
+
+func (self *cache) HExpire(key string, ttl int, hashKeys ...[]byte) IntSliceCommand {
+	return self.hashKeysCommand(HExpireCommand, hashKeys, key, ttl)
+}
+
+func (self *cache) HExpireAt(key string, deadline time.Time, hashKeys ...[]byte) IntSliceCommand {
+	return self.hashKeysCommand(HPExpireAtCommand, hashKeys, key, unixMillis(deadline))
+}
+
+func (self *cache) HTTL(key string, hashKeys ...[]byte) IntSliceCommand {
+	return self.hashKeysCommand(HTTLCommand, hashKeys, key)
+}
+
+func (self *cache) HPersist(key string, hashKeys ...[]byte) IntSliceCommand {
+	return self.hashKeysCommand(HPersistCommand, hashKeys, key)
+}
+
+///////////////////////// set ////////////////////////
+type setOperation int
+
+const (
+	setInter setOperation = iota
+	setUnion
+	setDiff
+)
+
+// setSplitter fetches every set separately and performs the operation on the client side
+type setSplitter struct {
+	op setOperation
+}
+
+func (self *setSplitter) Split(cmdDef *CommandDefinition) []*CommandDefinition {
+	args := cmdDef.Args()
+	defs := make([]*CommandDefinition, len(args))
+	for i, k := range args {
+		defs[i] = NewCommandDefinition(SMembersCommand, k)
+	}
+	return defs
+}
+
+func (self *setSplitter) members(p serializer.Payload) (map[string]bool, error) {
+	members := map[string]bool{}
+	if p.IsNil() {
+		return members, nil
+	}
+	arr, err := p.Array()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range arr {
+		s, err := m.Str()
+		if err != nil {
+			return nil, err
+		}
+		members[s] = true
+	}
+	return members, nil
+}
+
+func (self *setSplitter) Merge(results []serializer.Payload) (serializer.Payload, error) {
+	sets := make([]map[string]bool, len(results))
+	for i, p := range results {
+		members, err := self.members(p)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = members
+	}
+
+	ret := make(ArrayPayload, 0)
+	if len(sets) == 0 {
+		return ret, nil
+	}
+	if self.op == setUnion {
+		union := map[string]bool{}
+		for _, set := range sets {
+			for m := range set {
+				union[m] = true
+			}
+		}
+		for m := range union {
+			ret = append(ret, BytesPayload(m))
+		}
+		return ret, nil
+	}
+
+	for m := range sets[0] {
+		found := 0
+		for _, set := range sets[1:] {
+			if set[m] {
+				found += 1
+			}
+		}
+		if (self.op == setInter && found == len(sets)-1) || (self.op == setDiff && found == 0) {
+			ret = append(ret, BytesPayload(m))
+		}
+	}
+	return ret, nil
+}
+
+func (self *cache) SAdd(key string, members ...[]byte) IntCommand {
+	args := make([]interface{}, 1+len(members))
+	args[0] = key
+	for i, m := range members {
+		args[i+1] = m
+	}
+	cmdDef := NewCommandDefinition(SAddCommand, args...)
+	return self.command(cmdDef)
+}
+
+func (self *cache) SRem(key string, members ...[]byte) IntCommand {
+	args := make([]interface{}, 1+len(members))
+	args[0] = key
+	for i, m := range members {
+		args[i+1] = m
+	}
+	cmdDef := NewCommandDefinition(SRemCommand, args...)
+	return self.command(cmdDef)
+}
+
+func (self *cache) SIsMember(key string, member []byte) BoolCommand {
+	cmdDef := NewCommandDefinition(SIsMemberCommand, key, member)
+	return self.command(cmdDef)
+}
+
+func (self *cache) SMembers(key string) BytesSliceCommand {
+	cmdDef := NewCommandDefinition(SMembersCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) SCard(key string) IntCommand {
+	cmdDef := NewCommandDefinition(SCardCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) setAlgebra(name string, op setOperation, keys ...string) BytesSliceCommand {
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	cmdDef := NewCommandDefinition(name, args...).
+		WithType(CrossKeyType).
+		WithSplitter(&setSplitter{op: op})
+	return self.command(cmdDef)
+}
+
+func (self *cache) SInter(keys ...string) BytesSliceCommand {
+	return self.setAlgebra(SInterCommand, setInter, keys...)
+}
+
+func (self *cache) SUnion(keys ...string) BytesSliceCommand {
+	return self.setAlgebra(SUnionCommand, setUnion, keys...)
+}
+
+func (self *cache) SDiff(keys ...string) BytesSliceCommand {
+	return self.setAlgebra(SDiffCommand, setDiff, keys...)
+}
+
+///////////////////////// sorted set ////////////////////////
+func (self *cache) ZAdd(key string, score float64, member []byte) IntCommand {
+	cmdDef := NewCommandDefinition(ZAddCommand, key, score, member)
+	return self.command(cmdDef)
+}
+
+func (self *cache) ZRem(key string, members ...[]byte) IntCommand {
+	args := make([]interface{}, 1+len(members))
+	args[0] = key
+	for i, m := range members {
+		args[i+1] = m
+	}
+	cmdDef := NewCommandDefinition(ZRemCommand, args...)
+	return self.command(cmdDef)
+}
+
+func (self *cache) ZScore(key string, member []byte) FloatCommand {
+	cmdDef := NewCommandDefinition(ZScoreCommand, key, member)
+	return self.command(cmdDef)
+}
+
+func (self *cache) ZRank(key string, member []byte) IntCommand {
+	cmdDef := NewCommandDefinition(ZRankCommand, key, member)
+	return self.command(cmdDef)
+}
+
+func (self *cache) ZCard(key string) IntCommand {
+	cmdDef := NewCommandDefinition(ZCardCommand, key)
+	return self.command(cmdDef)
+}
+
+func (self *cache) ZRange(key string, start int, stop int) BytesSliceCommand {
+	cmdDef := NewCommandDefinition(ZRangeCommand, key, start, stop)
+	return self.command(cmdDef)
+}
+
+func (self *cache) ZRangeByScore(key string, min float64, max float64) BytesSliceCommand {
+	cmdDef := NewCommandDefinition(ZRangeByScoreCommand, key, min, max)
+	return self.command(cmdDef)
+}
+
 func New(opts *Options) Cache {
 	var cache cache
 
@@ -202,8 +824,13 @@ func New(opts *Options) Cache {
 		auther = newAuther(NewCommandDefinition(AuthCommand, auth))
 	}
 	addrs := opts.Addrs
-	if len(addrs) > 1 {
-		client = newMultiClient(addrs, opts.PoolSize, opts.DialTimeout, auther)
+	// the client with a single address is not sharded unless the ring is set
+	if len(addrs) != 1 || opts.Ring != nil {
+		ring := opts.Ring
+		if ring == nil {
+			ring = NewRing(opts.Hash, opts.VirtualNodes)
+		}
+		client = newMultiClient(addrs, opts.Weights, ring, opts.PoolSize, opts.DialTimeout, auther)
 	} else {
 		client = newBaseClient(addrs[0], opts.PoolSize, opts.DialTimeout, auther)
 	}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/net/serializer"
+)
+
+func Test_setSplitter_Merge(t *testing.T) {
+	members := func(values ...string) serializer.Payload {
+		arr := make(ArrayPayload, len(values))
+		for i, v := range values {
+			arr[i] = BytesPayload(v)
+		}
+		return arr
+	}
+	results := []serializer.Payload{
+		members("a", "b", "c"),
+		members("b", "c", "d"),
+		MultiPayload{},
+		members("c", "e"),
+	}
+	tests := []struct {
+		name    string
+		op      setOperation
+		results []serializer.Payload
+		want    []string
+	}{
+		{
+			name:    "Inter",
+			op:      setInter,
+			results: []serializer.Payload{results[0], results[1], results[3]},
+			want:    []string{"c"},
+		},
+		{
+			name:    "InterWithEmpty",
+			op:      setInter,
+			results: results,
+			want:    []string{},
+		},
+		{
+			name:    "Union",
+			op:      setUnion,
+			results: results,
+			want:    []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:    "Diff",
+			op:      setDiff,
+			results: []serializer.Payload{results[0], results[3]},
+			want:    []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := &setSplitter{op: tt.op}
+			p, err := self.Merge(tt.results)
+			if err != nil {
+				t.Errorf("setSplitter.Merge() error = %v", err)
+				return
+			}
+			arr, _ := p.Array()
+			got := make([]string, len(arr))
+			for i, m := range arr {
+				got[i], _ = m.Str()
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setSplitter.Merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_CommandDefinition_Keys(t *testing.T) {
+	tests := []struct {
+		def  *CommandDefinition
+		want []string
+	}{
+		{NewCommandDefinition(GetCommand, "a"), []string{"a"}},
+		{NewCommandDefinition(LRangeCommand, "a", 0, -1), []string{"a"}},
+		{NewCommandDefinition(KeysCommand).WithType(NoKeyType), nil},
+		{NewCommandDefinition(DelCommand, "a", "b").WithType(MultiKeyType), []string{"a", "b"}},
+		{NewCommandDefinition(LMoveCommand, "a", "b", "LEFT", "RIGHT").WithType(CrossKeyType).WithKeyCount(2), []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		if got := tt.def.Keys(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Keys() of %v = %v, want %v", tt.def.Payload(), got, tt.want)
+		}
+	}
+}
+
+func Test_SetOptions_args(t *testing.T) {
+	tests := []struct {
+		opts *SetOptions
+		want []interface{}
+	}{
+		{nil, []interface{}{}},
+		{&SetOptions{}, []interface{}{}},
+		{&SetOptions{NX: true, TTL: 2 * time.Second}, []interface{}{"NX", "EX", 2}},
+		{&SetOptions{TTL: 1500 * time.Millisecond}, []interface{}{"PX", 1500}},
+		{&SetOptions{TTL: time.Microsecond}, []interface{}{"PX", 1}},
+		{&SetOptions{XX: true, TTL: 2*time.Millisecond + time.Nanosecond}, []interface{}{"XX", "PX", 3}},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.args(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("args() of %+v = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func Test_unixMillis(t *testing.T) {
+	deadline := time.Date(2286, 11, 20, 17, 46, 40, 123456789, time.UTC)
+	if got := unixMillis(deadline); got != 10000000000123 {
+		t.Errorf("unixMillis() = %v, want 10000000000123", got)
+	}
+}
@@ -1,7 +1,8 @@
 package client
 
 import (
-	"hash/crc32"
+	"errors"
+	"io"
 	"net"
 	"sync"
 	"time"
@@ -9,6 +10,12 @@ import (
 	"github.com/auvn/go.cache/net/serializer"
 )
 
+var (
+	ErrCrossServerKeys = errors.New("keys are served by different servers")
+	ErrNoServers       = errors.New("no servers to send the command to")
+	ErrStaticAddrs     = errors.New("the servers cannot be changed, the client is created with a single address")
+)
+
 type Auther interface {
 	Auth(Connection) error
 }
@@ -78,6 +85,7 @@ func execute(conn Connection, payload Payload) (serializer.Payload, error) {
 }
 
 type baseClient struct {
+	addr    string
 	auther  Auther
 	options *Options
 	pool    Pool
@@ -96,27 +104,91 @@ func (self *baseClient) Call(cmdDef *CommandDefinition) (serializer.Payload, err
 	return execute(conn, cmdDef.Payload())
 }
 
+// conn lends an authenticated connection, it is put back to its pool
+func (self *baseClient) conn(keys []string) (*PooledConnection, error) {
+	conn, err := self.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	if err = self.auther.Auth(conn); err != nil {
+		self.pool.Put(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
 func newBaseClient(addr string, poolSize int, dialTimeout time.Duration, auther Auther) *baseClient {
 	return &baseClient{
+		addr:   addr,
 		auther: auther,
 		pool:   NewPool(poolSize, newConnectionFactory(addr, dialTimeout)),
 	}
 }
 
+// multiClient shards the keys between the servers with the ring,
+// the servers can be added and removed at runtime
 type multiClient struct {
-	auther       Auther
-	pools        []Pool
-	serversCount int
-	hash         func(key string) uint32
+	auther      Auther
+	poolSize    int
+	dialTimeout time.Duration
+
+	mu    sync.RWMutex
+	ring  Ring
+	pools map[string]Pool
+}
+
+func (self *multiClient) pool(key string) (Pool, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	addr, ok := self.ring.Get(key)
+	if !ok {
+		return nil, ErrNoServers
+	}
+	return self.pools[addr], nil
+}
+
+func (self *multiClient) allPools() []Pool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	ret := make([]Pool, 0, len(self.pools))
+	for _, p := range self.pools {
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// AddAddr starts sending the keys to the server or changes its weight,
+// ~weight/total of the keys are moved to it from the other servers.
+func (self *multiClient) AddAddr(addr string, weight int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.pools[addr]; !ok {
+		self.pools[addr] = NewPool(self.poolSize, newConnectionFactory(addr, self.dialTimeout))
+	}
+	self.ring.Add(addr, weight)
+}
+
+// RemoveAddr moves the keys of the server to the other ones, the idle
+// connections are closed.
+func (self *multiClient) RemoveAddr(addr string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.ring.Remove(addr)
+	if p, ok := self.pools[addr]; ok {
+		delete(self.pools, addr)
+		if c, ok := p.(io.Closer); ok {
+			c.Close()
+		}
+	}
 }
 
-func (self *multiClient) poolIndex(key string) int {
-	return int(self.hash(key) % uint32(self.serversCount))
+func (self *multiClient) Addrs() []string {
+	return self.ring.Addrs()
 }
 
-func (self *multiClient) callAsync(index int, payload Payload, ch chan interface{}) {
+func (self *multiClient) callAsync(pool Pool, payload Payload, ch chan interface{}) {
 	go func() {
-		p, err := self.call(index, payload)
+		p, err := self.call(pool, payload)
 		if err != nil {
 			ch <- err
 		} else {
@@ -126,12 +198,13 @@ func (self *multiClient) callAsync(index int, payload Payload, ch chan interface
 }
 
 func (self *multiClient) multiCall(payload Payload) (serializer.Payload, error) {
-	n := self.serversCount
+	pools := self.allPools()
+	n := len(pools)
 	wg := &sync.WaitGroup{}
 	wg.Add(n)
 	responses := make(chan interface{}, n)
-	for i, _ := range self.pools {
-		self.callAsync(i, payload, responses)
+	for _, p := range pools {
+		self.callAsync(p, payload, responses)
 	}
 
 	go func(wg *sync.WaitGroup, ch chan interface{}) {
@@ -151,8 +224,7 @@ func (self *multiClient) multiCall(payload Payload) (serializer.Payload, error)
 	return MultiPayload(results), nil
 
 }
-func (self *multiClient) call(index int, payload Payload) (serializer.Payload, error) {
-	pool := self.pools[index]
+func (self *multiClient) call(pool Pool, payload Payload) (serializer.Payload, error) {
 	conn, err := pool.Get()
 	if err != nil {
 		return nil, err
@@ -164,29 +236,114 @@ func (self *multiClient) call(index int, payload Payload) (serializer.Payload, e
 	return execute(conn, payload)
 }
 
+func (self *multiClient) callKey(key string, payload Payload) (serializer.Payload, error) {
+	pool, err := self.pool(key)
+	if err != nil {
+		return nil, err
+	}
+	return self.call(pool, payload)
+}
+
+// calls the server directly if all the keys are served by it,
+// otherwise splits the command into single-key ones and merges the results
+func (self *multiClient) crossCall(cmdDef *CommandDefinition) (serializer.Payload, error) {
+	keys := cmdDef.Keys()
+	if len(keys) == 0 {
+		pools := self.allPools()
+		if len(pools) == 0 {
+			return nil, ErrNoServers
+		}
+		return self.call(pools[0], cmdDef.Payload())
+	}
+
+	var pool Pool
+	for _, key := range keys {
+		p, err := self.pool(key)
+		if err != nil {
+			return nil, err
+		}
+		if pool == nil {
+			pool = p
+		} else if pool != p {
+			pool = nil
+			break
+		}
+	}
+	if pool != nil {
+		return self.call(pool, cmdDef.Payload())
+	}
+
+	splitter := cmdDef.Splitter()
+	if splitter == nil {
+		return nil, ErrCrossServerKeys
+	}
+	defs := splitter.Split(cmdDef)
+	results := make([]serializer.Payload, len(defs))
+	for i, def := range defs {
+		p, err := self.callKey(def.Arg(0).(string), def.Payload())
+		if err != nil {
+			return nil, err
+		}
+		results[i] = p
+	}
+	return splitter.Merge(results)
+}
+
+// conn lends an authenticated connection of the server of the keys,
+// it is put back to its pool
+func (self *multiClient) conn(keys []string) (*PooledConnection, error) {
+	var pool Pool
+	for _, key := range keys {
+		p, err := self.pool(key)
+		if err != nil {
+			return nil, err
+		}
+		if pool == nil {
+			pool = p
+		} else if pool != p {
+			return nil, ErrCrossServerKeys
+		}
+	}
+	if pool == nil {
+		pools := self.allPools()
+		if len(pools) == 0 {
+			return nil, ErrNoServers
+		}
+		pool = pools[0]
+	}
+	conn, err := pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	if err = self.auther.Auth(conn); err != nil {
+		pool.Put(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
 func (self *multiClient) Call(cmdDef *CommandDefinition) (serializer.Payload, error) {
 	payload := cmdDef.Payload()
 	if cmdDef.IsType(NoKeyType | MultiKeyType) {
 		return self.multiCall(payload)
+	} else if cmdDef.IsType(CrossKeyType) {
+		return self.crossCall(cmdDef)
 	} else {
-		key := cmdDef.Arg(0).(string)
-		i := self.poolIndex(key)
-		return self.call(i, payload)
+		return self.callKey(cmdDef.Arg(0).(string), payload)
 	}
 }
 
-func newMultiClient(addrs []string, poolSize int, dialTimeout time.Duration, auther Auther) *multiClient {
-	serversCount := len(addrs)
-	pools := make([]Pool, serversCount)
-	for i, _ := range pools {
-		pools[i] = NewPool(poolSize, newConnectionFactory(addrs[i], dialTimeout))
+// the weight of an address missing in the weights is 1
+func newMultiClient(addrs []string, weights map[string]int, ring Ring, poolSize int, dialTimeout time.Duration, auther Auther) *multiClient {
+	client := &multiClient{
+		auther:      auther,
+		poolSize:    poolSize,
+		dialTimeout: dialTimeout,
+		ring:        ring,
+		pools:       make(map[string]Pool),
 	}
-	return &multiClient{
-		auther:       auther,
-		pools:        pools,
-		serversCount: serversCount,
-		hash: func(key string) uint32 {
-			return crc32.ChecksumIEEE([]byte(key))
-		},
+	for _, addr := range addrs {
+		client.AddAddr(addr, weights[addr])
 	}
+	return client
 }
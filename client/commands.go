@@ -2,11 +2,18 @@ package client
 
 import (
 	"errors"
+	"time"
 
 	"github.com/auvn/go.cache/net/serializer"
 )
 
 var (
+	ErrNil = errors.New("nil value")
+
+	// returned by DurationCommand instead of the negative TTL replies
+	ErrNoTTL = errors.New("key has no ttl")
+	ErrNoKey = errors.New("key does not exist")
+
 	emptySlice       = []serializer.Payload{}
 	emptyBytesSlice  = [][]byte{}
 	emptyBytes       = []byte{}
@@ -63,6 +70,13 @@ func (self MultiPayload) Int() (int, error) {
 	return ret, nil
 }
 
+func (self MultiPayload) Float() (float64, error) {
+	if len(self) != 1 {
+		return 0, errors.New("Float() cannot be invoked if len(multipayload) != 1")
+	}
+	return self[0].Float()
+}
+
 func (self MultiPayload) Bool() (bool, error) {
 	var (
 		b   bool
@@ -125,6 +139,14 @@ type IntCommand interface {
 	Int() (int, error)
 }
 
+type FloatCommand interface {
+	Float() (float64, error)
+}
+
+type DurationCommand interface {
+	Duration() (time.Duration, error)
+}
+
 type BytesCommand interface {
 	Bytes() ([]byte, error)
 }
@@ -137,12 +159,24 @@ type StringSliceCommand interface {
 	StringSlice() ([]string, error)
 }
 
+type BytesMapCommand interface {
+	BytesMap() (map[string][]byte, error)
+}
+
+type IntSliceCommand interface {
+	IntSlice() ([]int, error)
+}
+
 type Command interface {
 	BoolCommand
 	IntCommand
+	FloatCommand
+	DurationCommand
 	BytesCommand
 	BytesSliceCommand
 	StringSliceCommand
+	BytesMapCommand
+	IntSliceCommand
 }
 
 type Payload []interface{}
@@ -171,10 +205,38 @@ func (self *RemoteCommand) Bool() (bool, error) {
 func (self *RemoteCommand) Int() (int, error) {
 	if res, err := self.call(); err != nil {
 		return 0, err
+	} else if res.IsNil() {
+		return 0, ErrNil
 	} else {
 		return res.Int()
 	}
 }
+
+func (self *RemoteCommand) Float() (float64, error) {
+	if res, err := self.call(); err != nil {
+		return 0, err
+	} else if res.IsNil() {
+		return 0, ErrNil
+	} else {
+		return res.Float()
+	}
+}
+
+// milliseconds reply as a duration
+func (self *RemoteCommand) Duration() (time.Duration, error) {
+	ms, err := self.Int()
+	if err != nil {
+		return 0, err
+	}
+	switch ms {
+	case -1:
+		return 0, ErrNoTTL
+	case -2:
+		return 0, ErrNoKey
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
 func (self *RemoteCommand) Bytes() ([]byte, error) {
 	if res, err := self.call(); err != nil {
 		return emptyBytes, err
@@ -211,7 +273,7 @@ func (self *RemoteCommand) BytesSlice() ([][]byte, error) {
 			ret[i] = bs
 		}
 	}
-	return emptyBytesSlice, nil
+	return ret, nil
 }
 
 func (self *RemoteCommand) StringSlice() ([]string, error) {
@@ -230,6 +292,66 @@ func (self *RemoteCommand) StringSlice() ([]string, error) {
 	return ret, nil
 }
 
+func (self *RemoteCommand) IntSlice() ([]int, error) {
+	arr, err := self.slice()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int, len(arr))
+	for i, p := range arr {
+		if ret[i], err = p.Int(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// BytesMap reads the reply of the keys followed by their values, e.g. HGETALL
+func (self *RemoteCommand) BytesMap() (map[string][]byte, error) {
+	arr, err := self.slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(arr)%2 != 0 {
+		return nil, serializer.ErrPayloadNonArray
+	}
+	ret := make(map[string][]byte, len(arr)/2)
+	for i := 0; i < len(arr); i += 2 {
+		k, err := arr[i].Str()
+		if err != nil {
+			return nil, err
+		}
+		if ret[k], err = arr[i+1].Bytes(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// fieldsCommand pairs the values of the reply with the requested keys, e.g. HMGET,
+// the keys replied with nil are omitted
+type fieldsCommand struct {
+	*RemoteCommand
+	fields [][]byte
+}
+
+func (self *fieldsCommand) BytesMap() (map[string][]byte, error) {
+	arr, err := self.slice()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]byte, len(arr))
+	for i, p := range arr {
+		if i >= len(self.fields) || p.IsNil() {
+			continue
+		}
+		if ret[string(self.fields[i])], err = p.Bytes(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
 func NewRemoteCommand(caller Caller, cmdDef *CommandDefinition) *RemoteCommand {
 	return &RemoteCommand{
 		cmdDef: cmdDef,
@@ -243,12 +365,23 @@ const (
 	NoKeyType CommandType = 1 << iota
 	SingleKeyType
 	MultiKeyType
+	CrossKeyType // reads all of its keys at once, so they have to be served by the same server
 )
 
+// Splitter breaks a cross-key command into single-key commands and merges their results
+// when the keys are spread across several servers.
+type Splitter interface {
+	Split(cmdDef *CommandDefinition) []*CommandDefinition
+	Merge(results []serializer.Payload) (serializer.Payload, error)
+}
+
 type CommandDefinition struct {
-	name string
-	args []interface{}
-	t    CommandType
+	name     string
+	args     []interface{}
+	t        CommandType
+	splitter Splitter
+	// the number of the leading arguments which are keys, all of them if zero
+	keyCount int
 }
 
 func (self *CommandDefinition) Name() string {
@@ -259,6 +392,10 @@ func (self *CommandDefinition) Arg(i int) interface{} {
 	return self.args[i]
 }
 
+func (self *CommandDefinition) Args() []interface{} {
+	return self.args
+}
+
 func (self *CommandDefinition) Payload() Payload {
 	payload := make([]interface{}, 1+len(self.args))
 	payload[0] = self.name
@@ -280,6 +417,40 @@ func (self *CommandDefinition) IsType(t CommandType) bool {
 	return self.t&t != 0
 }
 
+// WithKeyCount limits the keys of a multi or cross key command to the leading
+// arguments, e.g. LMOVE source destination LEFT RIGHT.
+func (self *CommandDefinition) WithKeyCount(n int) *CommandDefinition {
+	self.keyCount = n
+	return self
+}
+
+// Keys returns the keys the command is routed by.
+func (self *CommandDefinition) Keys() []string {
+	args := self.args
+	switch {
+	case self.IsType(NoKeyType) || len(args) == 0:
+		return nil
+	case !self.IsType(MultiKeyType | CrossKeyType):
+		args = args[:1]
+	case self.keyCount > 0 && self.keyCount < len(args):
+		args = args[:self.keyCount]
+	}
+	keys := make([]string, len(args))
+	for i, a := range args {
+		keys[i] = a.(string)
+	}
+	return keys
+}
+
+func (self *CommandDefinition) WithSplitter(s Splitter) *CommandDefinition {
+	self.splitter = s
+	return self
+}
+
+func (self *CommandDefinition) Splitter() Splitter {
+	return self.splitter
+}
+
 func NewCommandDefinition(name string, args ...interface{}) *CommandDefinition {
 	return &CommandDefinition{
 		name: name,
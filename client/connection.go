@@ -2,6 +2,7 @@ package client
 
 import (
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/auvn/go.cache/net/serializer"
@@ -122,6 +123,7 @@ func NewPooledConnection(p Pool, conn Connection) *PooledConnection {
 type pool struct {
 	conns       chan *PooledConnection
 	connFactory ConnFactory
+	closed      int32
 }
 
 func (self *pool) Get() (*PooledConnection, error) {
@@ -139,8 +141,9 @@ func (self *pool) Get() (*PooledConnection, error) {
 }
 
 func (self *pool) Put(conn *PooledConnection) {
-	if !conn.Active() {
+	if !conn.Active() || atomic.LoadInt32(&self.closed) == 1 {
 		conn.Close()
+		return
 	}
 	select {
 	case self.conns <- conn:
@@ -149,6 +152,20 @@ func (self *pool) Put(conn *PooledConnection) {
 	}
 }
 
+// Close closes the idle connections, the connections in use are closed
+// once they are put back.
+func (self *pool) Close() error {
+	atomic.StoreInt32(&self.closed, 1)
+	for {
+		select {
+		case conn := <-self.conns:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
 func NewPool(capacity int, connFactory ConnFactory) Pool {
 	if capacity < 0 {
 		capacity = 0
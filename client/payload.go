@@ -0,0 +1,102 @@
+package client
+
+import (
+	"strconv"
+
+	"github.com/auvn/go.cache/net/serializer"
+)
+
+// BytesPayload is a value payload built on the client side
+type BytesPayload []byte
+
+func (self BytesPayload) Array() ([]serializer.Payload, error) {
+	return emptySlice, serializer.ErrPayloadNonArray
+}
+
+func (self BytesPayload) Bytes() ([]byte, error) {
+	return []byte(self), nil
+}
+
+func (self BytesPayload) Str() (string, error) {
+	return string(self), nil
+}
+
+func (self BytesPayload) Int() (int, error) {
+	if i, err := strconv.Atoi(string(self)); err == nil {
+		return i, nil
+	}
+	return 0, serializer.ErrPayloadNonInt
+}
+
+func (self BytesPayload) Float() (float64, error) {
+	if f, err := strconv.ParseFloat(string(self), 64); err == nil {
+		return f, nil
+	}
+	return 0, serializer.ErrPayloadNonFloat
+}
+
+func (self BytesPayload) Bool() (bool, error) {
+	if len(self) == 1 {
+		return self[0] != '0', nil
+	}
+	return false, serializer.ErrPayloadNonBool
+}
+
+func (self BytesPayload) Err() error {
+	return serializer.ErrPayloadNonError
+}
+
+func (self BytesPayload) IsNil() bool {
+	return false
+}
+
+func (self BytesPayload) IsArray() bool {
+	return false
+}
+
+func (self BytesPayload) IsErr() bool {
+	return false
+}
+
+// ArrayPayload is an array payload built on the client side
+type ArrayPayload []serializer.Payload
+
+func (self ArrayPayload) Array() ([]serializer.Payload, error) {
+	return []serializer.Payload(self), nil
+}
+
+func (self ArrayPayload) Bytes() ([]byte, error) {
+	return emptyBytes, serializer.ErrPayloadNonValue
+}
+
+func (self ArrayPayload) Str() (string, error) {
+	return "", serializer.ErrPayloadNonString
+}
+
+func (self ArrayPayload) Int() (int, error) {
+	return 0, serializer.ErrPayloadNonInt
+}
+
+func (self ArrayPayload) Float() (float64, error) {
+	return 0, serializer.ErrPayloadNonFloat
+}
+
+func (self ArrayPayload) Bool() (bool, error) {
+	return false, serializer.ErrPayloadNonBool
+}
+
+func (self ArrayPayload) Err() error {
+	return serializer.ErrPayloadNonError
+}
+
+func (self ArrayPayload) IsNil() bool {
+	return false
+}
+
+func (self ArrayPayload) IsArray() bool {
+	return true
+}
+
+func (self ArrayPayload) IsErr() bool {
+	return false
+}
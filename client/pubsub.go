@@ -0,0 +1,290 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/auvn/go.cache/net/serializer"
+)
+
+var (
+	ErrSubscriberClosed = errors.New("subscriber is closed")
+
+	DefaultSubscriberOptions = &SubscriberOptions{
+		Addrs:          []string{":1234"},
+		DialTimeout:    5 * time.Second,
+		ReconnectDelay: time.Second,
+		BufferSize:     100,
+	}
+)
+
+type SubscriberOptions struct {
+	// the subscriber is connected to every server, a message is published
+	// to the server of its channel
+	Addrs       []string
+	Auth        string
+	DialTimeout time.Duration
+	// the delay between the attempts to connect to a server
+	ReconnectDelay time.Duration
+	// the size of the Messages channel
+	BufferSize int
+}
+
+type Message struct {
+	// the pattern of PSubscribe the channel is matched with, empty for Subscribe
+	Pattern string
+	Channel string
+	Data    []byte
+}
+
+// parses [message, channel, data] and [pmessage, pattern, channel, data],
+// the replies to the subscriptions are skipped
+func parseMessage(p serializer.Payload) (*Message, bool) {
+	arr, err := p.Array()
+	if err != nil || len(arr) == 0 {
+		return nil, false
+	}
+	values := make([][]byte, len(arr))
+	for i, v := range arr {
+		if values[i], err = v.Bytes(); err != nil {
+			return nil, false
+		}
+	}
+	switch kind := string(values[0]); {
+	case kind == "message" && len(values) == 3:
+		return &Message{Channel: string(values[1]), Data: values[2]}, true
+	case kind == "pmessage" && len(values) == 4:
+		return &Message{Pattern: string(values[1]), Channel: string(values[2]), Data: values[3]}, true
+	}
+	return nil, false
+}
+
+// subscriberConn keeps the connection to a single server
+type subscriberConn struct {
+	s           *Subscriber
+	connFactory ConnFactory
+	// nil while disconnected
+	conn Connection
+}
+
+func (self *subscriberConn) dial() (Connection, error) {
+	conn, err := self.connFactory.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := self.s.auther.Auth(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// restores the subscriptions on the new connection,
+// must be called under the lock of the subscriber
+func (self *subscriberConn) resubscribe(conn Connection) error {
+	if channels := self.s.channels.names(); len(channels) > 0 {
+		if err := conn.Send(NewCommandDefinition(SubscribeCommand, channels...).Payload()); err != nil {
+			return err
+		}
+	}
+	if patterns := self.s.patterns.names(); len(patterns) > 0 {
+		if err := conn.Send(NewCommandDefinition(PSubscribeCommand, patterns...).Payload()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *subscriberConn) connect() (Connection, error) {
+	conn, err := self.dial()
+	if err != nil {
+		return nil, err
+	}
+	self.s.mu.Lock()
+	defer self.s.mu.Unlock()
+	if self.s.closed {
+		conn.Close()
+		return nil, ErrSubscriberClosed
+	}
+	if err := self.resubscribe(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	self.conn = conn
+	return conn, nil
+}
+
+func (self *subscriberConn) disconnect(conn Connection) {
+	self.s.mu.Lock()
+	defer self.s.mu.Unlock()
+	self.conn = nil
+	conn.Close()
+}
+
+func (self *subscriberConn) receive(conn Connection) {
+	defer self.disconnect(conn)
+	for {
+		p, err := conn.Receive()
+		if err != nil {
+			return
+		}
+		if m, ok := parseMessage(p); ok {
+			select {
+			case self.s.messages <- m:
+			case <-self.s.quit:
+				return
+			}
+		}
+	}
+}
+
+func (self *subscriberConn) run() {
+	defer self.s.wg.Done()
+	for {
+		if conn, err := self.connect(); err == nil {
+			self.receive(conn)
+		}
+		select {
+		case <-self.s.quit:
+			return
+		case <-time.After(self.s.opts.ReconnectDelay):
+		}
+	}
+}
+
+// the channels or the patterns subscribed to
+type subscriptions map[string]struct{}
+
+func (self subscriptions) names() []interface{} {
+	ret := make([]interface{}, 0, len(self))
+	for name := range self {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// Subscriber receives the published messages on a channel. The subscriptions
+// are restored once the connection to a server is lost and established again,
+// the messages published meanwhile are not received.
+type Subscriber struct {
+	opts     *SubscriberOptions
+	auther   Auther
+	conns    []*subscriberConn
+	messages chan *Message
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	channels subscriptions
+	patterns subscriptions
+	closed   bool
+}
+
+// sends the command to the connected servers, the others receive the
+// subscriptions once they are connected
+func (self *Subscriber) update(subs subscriptions, add bool, name string, args []string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.closed {
+		return ErrSubscriberClosed
+	}
+	if add && len(args) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+		if add {
+			subs[arg] = struct{}{}
+		} else {
+			delete(subs, arg)
+		}
+	}
+	if !add && len(args) == 0 {
+		for arg := range subs {
+			delete(subs, arg)
+		}
+	}
+	payload := NewCommandDefinition(name, values...).Payload()
+	for _, c := range self.conns {
+		if c.conn != nil {
+			// the connection is restored with the subscriptions on failure
+			c.conn.Send(payload)
+		}
+	}
+	return nil
+}
+
+func (self *Subscriber) Subscribe(channels ...string) error {
+	return self.update(self.channels, true, SubscribeCommand, channels)
+}
+
+// PSubscribe subscribes to the channels matching the glob patterns, e.g. news.*
+func (self *Subscriber) PSubscribe(patterns ...string) error {
+	return self.update(self.patterns, true, PSubscribeCommand, patterns)
+}
+
+// Unsubscribe unsubscribes from all the channels if none are passed.
+func (self *Subscriber) Unsubscribe(channels ...string) error {
+	return self.update(self.channels, false, UnsubscribeCommand, channels)
+}
+
+// PUnsubscribe unsubscribes from all the patterns if none are passed.
+func (self *Subscriber) PUnsubscribe(patterns ...string) error {
+	return self.update(self.patterns, false, PUnsubscribeCommand, patterns)
+}
+
+// Messages is closed once the subscriber is closed.
+func (self *Subscriber) Messages() <-chan *Message {
+	return self.messages
+}
+
+func (self *Subscriber) Close() error {
+	self.mu.Lock()
+	if self.closed {
+		self.mu.Unlock()
+		return ErrSubscriberClosed
+	}
+	self.closed = true
+	close(self.quit)
+	for _, c := range self.conns {
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}
+	self.mu.Unlock()
+	self.wg.Wait()
+	close(self.messages)
+	return nil
+}
+
+func NewSubscriber(opts *SubscriberOptions) *Subscriber {
+	if opts == nil {
+		opts = DefaultSubscriberOptions
+	}
+	var auther Auther = new(dummyAuther)
+	if opts.Auth != "" {
+		auther = newAuther(NewCommandDefinition(AuthCommand, opts.Auth))
+	}
+	s := &Subscriber{
+		opts:     opts,
+		auther:   auther,
+		messages: make(chan *Message, opts.BufferSize),
+		quit:     make(chan struct{}),
+		channels: make(subscriptions),
+		patterns: make(subscriptions),
+	}
+	s.conns = make([]*subscriberConn, len(opts.Addrs))
+	for i, addr := range opts.Addrs {
+		s.conns[i] = &subscriberConn{
+			s:           s,
+			connFactory: newConnectionFactory(addr, opts.DialTimeout),
+		}
+	}
+	s.wg.Add(len(s.conns))
+	for _, c := range s.conns {
+		go c.run()
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// number of the points of an address of weight 1 on the ring
+	DefaultVirtualNodes = 160
+)
+
+// HashFunc maps the keys and the virtual nodes onto the ring.
+type HashFunc func(key []byte) uint32
+
+func crc32Hash(key []byte) uint32 {
+	return crc32.ChecksumIEEE(key)
+}
+
+// Ring assigns the keys to the server addresses.
+type Ring interface {
+	// Add adds the address or changes its weight
+	Add(addr string, weight int)
+	Remove(addr string)
+	// Get returns the address serving the key, false if the ring is empty
+	Get(key string) (string, bool)
+	Addrs() []string
+}
+
+type ringPoint struct {
+	hash uint32
+	addr string
+}
+
+// hashRing is a consistent-hash ring, every address is placed at
+// weight * replicas points, so a new address takes ~1/N of the keys
+// from the other ones.
+type hashRing struct {
+	hash     HashFunc
+	replicas int
+
+	mu      sync.RWMutex
+	weights map[string]int
+	points  []ringPoint
+}
+
+// must be called under the lock
+func (self *hashRing) build() {
+	points := make([]ringPoint, 0, len(self.points))
+	for addr, weight := range self.weights {
+		for i := 0; i < weight*self.replicas; i++ {
+			hash := self.hash([]byte(addr + "#" + strconv.Itoa(i)))
+			points = append(points, ringPoint{hash: hash, addr: addr})
+		}
+	}
+	// the collided points are ordered by the address, so the ring
+	// does not depend on the order the addresses are added in
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash == points[j].hash {
+			return points[i].addr < points[j].addr
+		}
+		return points[i].hash < points[j].hash
+	})
+	self.points = points
+}
+
+func (self *hashRing) Add(addr string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.weights[addr] == weight {
+		return
+	}
+	self.weights[addr] = weight
+	self.build()
+}
+
+func (self *hashRing) Remove(addr string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.weights[addr]; !ok {
+		return
+	}
+	delete(self.weights, addr)
+	self.build()
+}
+
+func (self *hashRing) Get(key string) (string, bool) {
+	hash := self.hash([]byte(key))
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	n := len(self.points)
+	if n == 0 {
+		return "", false
+	}
+	i := sort.Search(n, func(i int) bool {
+		return self.points[i].hash >= hash
+	})
+	if i == n {
+		i = 0
+	}
+	return self.points[i].addr, true
+}
+
+func (self *hashRing) Addrs() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	ret := make([]string, 0, len(self.weights))
+	for addr := range self.weights {
+		ret = append(ret, addr)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NewRing creates a consistent-hash ring with the number of virtual nodes
+// per weight unit of an address, crc32 and DefaultVirtualNodes are used by default.
+func NewRing(hash HashFunc, virtualNodes int) Ring {
+	if hash == nil {
+		hash = crc32Hash
+	}
+	if virtualNodes < 1 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &hashRing{
+		hash:     hash,
+		replicas: virtualNodes,
+		weights:  make(map[string]int),
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"strconv"
+	"testing"
+)
+
+const ringTestKeys = 100000
+
+func ringOwners(r Ring) map[string]string {
+	ret := make(map[string]string, ringTestKeys)
+	for i := 0; i < ringTestKeys; i++ {
+		key := "key:" + strconv.Itoa(i)
+		ret[key], _ = r.Get(key)
+	}
+	return ret
+}
+
+func Test_hashRing_Add(t *testing.T) {
+	r := NewRing(nil, 0)
+	if _, ok := r.Get("key"); ok {
+		t.Fatalf("Get() of the empty ring succeeded")
+	}
+	for i := 1; i <= 4; i++ {
+		r.Add("server"+strconv.Itoa(i), 1)
+	}
+	before := ringOwners(r)
+	r.Add("server5", 1)
+	after := ringOwners(r)
+
+	var moved int
+	for key, addr := range after {
+		if addr != before[key] {
+			if addr != "server5" {
+				t.Fatalf("%s is moved from %s to %s", key, before[key], addr)
+			}
+			moved += 1
+		}
+	}
+	// ~1/5 of the keys are moved to the new server
+	if share := float64(moved) / ringTestKeys; share < 0.15 || share > 0.25 {
+		t.Errorf("moved keys share = %.3f", share)
+	}
+
+	r.Remove("server5")
+	for key, addr := range ringOwners(r) {
+		if addr != before[key] {
+			t.Fatalf("%s is served by %s after Remove(), want %s", key, addr, before[key])
+		}
+	}
+}
+
+func Test_hashRing_Weights(t *testing.T) {
+	r := NewRing(nil, 0)
+	r.Add("a", 1)
+	r.Add("b", 3)
+	counts := make(map[string]int)
+	for _, addr := range ringOwners(r) {
+		counts[addr] += 1
+	}
+	if share := float64(counts["b"]) / ringTestKeys; share < 0.68 || share > 0.82 {
+		t.Errorf("share of the server of weight 3 = %.3f", share)
+	}
+	if addrs := r.Addrs(); len(addrs) != 2 || addrs[0] != "a" || addrs[1] != "b" {
+		t.Errorf("Addrs() = %v", addrs)
+	}
+}
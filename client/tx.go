@@ -0,0 +1,150 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/auvn/go.cache/net/serializer"
+)
+
+var (
+	ErrTxAborted     = errors.New("transaction aborted, a watched key was changed")
+	ErrTxNotExecuted = errors.New("transaction is not executed")
+)
+
+// Tx sends its commands to the server of the watched keys, e.g. to read
+// the values the queued commands depend on.
+type Tx interface {
+	Commands
+	// Exec executes the commands queued by fn atomically,
+	// ErrTxAborted if a watched key was changed.
+	Exec(fn func(Commands)) error
+}
+
+// connClient lends a connection of the server of the keys, e.g. to
+// a transaction or a blocking pop
+type connClient interface {
+	conn(keys []string) (*PooledConnection, error)
+}
+
+// txQueue collects the commands of a transaction, their results are
+// available once it is executed
+type txQueue struct {
+	defs    []*CommandDefinition
+	results []serializer.Payload
+	err     error
+}
+
+func (self *txQueue) add(cmdDef *CommandDefinition) Command {
+	self.defs = append(self.defs, cmdDef)
+	return NewRemoteCommand(&queuedCaller{queue: self, i: len(self.defs) - 1}, cmdDef)
+}
+
+// the keys of the commands, the server of the transaction is chosen by them
+func (self *txQueue) keys() []string {
+	keys := make([]string, 0, len(self.defs))
+	for _, def := range self.defs {
+		keys = append(keys, def.Keys()...)
+	}
+	return keys
+}
+
+// sends the commands within MULTI and EXEC
+func (self *txQueue) exec(conn Connection) error {
+	self.err = self.send(conn)
+	return self.err
+}
+
+func (self *txQueue) send(conn Connection) error {
+	if _, err := execute(conn, NewCommandDefinition(MultiCommand).Payload()); err != nil {
+		return err
+	}
+	// the server discards the transaction once a command is not queued,
+	// the error of the command is more helpful than the one of EXEC
+	var queueErr error
+	for _, def := range self.defs {
+		if _, err := execute(conn, def.Payload()); err != nil && queueErr == nil {
+			queueErr = err
+		}
+	}
+	p, err := execute(conn, NewCommandDefinition(ExecCommand).Payload())
+	if queueErr != nil {
+		return queueErr
+	} else if err != nil {
+		return err
+	} else if p.IsNil() {
+		return ErrTxAborted
+	}
+	results, err := p.Array()
+	if err != nil {
+		return err
+	}
+	self.results = results
+	return nil
+}
+
+// queuedCaller returns the result of a command of the executed transaction
+type queuedCaller struct {
+	queue *txQueue
+	i     int
+}
+
+func (self *queuedCaller) Call(cmdDef *CommandDefinition) (serializer.Payload, error) {
+	if err := self.queue.err; err != nil {
+		return nil, err
+	}
+	if self.i >= len(self.queue.results) {
+		return nil, ErrTxNotExecuted
+	}
+	p := self.queue.results[self.i]
+	if p.IsErr() {
+		return nil, p.Err()
+	}
+	return p, nil
+}
+
+type tx struct {
+	*cache
+	conn     Connection
+	executed bool
+}
+
+func (self *tx) Exec(fn func(Commands)) error {
+	self.executed = true
+	queue := new(txQueue)
+	fn(&cache{queue: queue})
+	return queue.exec(self.conn)
+}
+
+func (self *cache) Exec(fn func(Commands)) error {
+	queue := new(txQueue)
+	fn(&cache{queue: queue})
+	conn, err := self.client.(connClient).conn(queue.keys())
+	if err != nil {
+		queue.err = err
+		return err
+	}
+	defer conn.p.Put(conn)
+	return queue.exec(conn)
+}
+
+func (self *cache) Watch(fn func(Tx) error, keys ...string) error {
+	conn, err := self.client.(connClient).conn(keys)
+	if err != nil {
+		return err
+	}
+	defer conn.p.Put(conn)
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	if _, err := execute(conn, NewCommandDefinition(WatchCommand, args...).Payload()); err != nil {
+		return err
+	}
+	t := &tx{cache: &cache{client: newSimpleCaller(conn)}, conn: conn}
+	err = fn(t)
+	if !t.executed {
+		// the connection is reused, so the keys must not stay watched
+		execute(conn, NewCommandDefinition(UnwatchCommand).Payload())
+	}
+	return err
+}
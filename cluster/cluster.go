@@ -0,0 +1,317 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+)
+
+var (
+	filePerm os.FileMode = 0666
+
+	ErrCrossSlot     = errors.New("CROSSSLOT keys of the command are in different slots")
+	ErrClusterDown   = errors.New("CLUSTERDOWN the slot is not served")
+	ErrTryAgain      = errors.New("TRYAGAIN the keys are being migrated")
+	ErrNotOwner      = errors.New("the slot is not served by the node")
+	ErrAlreadyOwner  = errors.New("the slot is already served by the node")
+	ErrInvalidConfig = errors.New("invalid cluster config")
+
+	DefaultOptions = &Options{}
+)
+
+// MovedError redirects the client to the node serving the slot.
+type MovedError struct {
+	Slot int
+	Addr string
+}
+
+func (self *MovedError) Error() string {
+	return fmt.Sprintf("MOVED %d %s", self.Slot, self.Addr)
+}
+
+// AskError redirects the single command to the node importing the slot,
+// the command should be preceded with ASKING there.
+type AskError struct {
+	Slot int
+	Addr string
+}
+
+func (self *AskError) Error() string {
+	return fmt.Sprintf("ASK %d %s", self.Slot, self.Addr)
+}
+
+type Options struct {
+	// the address of the node announced to the clients and other nodes
+	Addr string
+	// keeps the slots of the nodes across restarts, optional
+	ConfigFile string
+}
+
+// Cluster is the map of the slots to the nodes as seen by the node.
+type Cluster struct {
+	opts *Options
+
+	mu     sync.RWMutex
+	owners [Slots]string
+	// the slots being moved from the node, slot -> the target
+	migrating map[int]string
+	// the slots being moved to the node, slot -> the source
+	importing map[int]string
+	// the keys being copied to the target of the migrating slot
+	moving map[core.StrValue]struct{}
+}
+
+func (self *Cluster) Addr() string {
+	return self.opts.Addr
+}
+
+// Assign makes the node serve the slots, the migration of the slots is finished.
+func (self *Cluster) Assign(r Range) error {
+	if err := r.check(); err != nil {
+		return err
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for slot := r.Start; slot <= r.End; slot++ {
+		self.owners[slot] = r.Addr
+		delete(self.migrating, slot)
+		delete(self.importing, slot)
+	}
+	return self.save()
+}
+
+// the slots served by the same node in a row are merged into a range,
+// must be called under the lock
+func (self *Cluster) ranges() []Range {
+	ret := make([]Range, 0)
+	for slot, addr := range self.owners {
+		if addr == "" {
+			continue
+		}
+		if n := len(ret); n > 0 && ret[n-1].Addr == addr && ret[n-1].End == slot-1 {
+			ret[n-1].End = slot
+		} else {
+			ret = append(ret, Range{Start: slot, End: slot, Addr: addr})
+		}
+	}
+	return ret
+}
+
+func (self *Cluster) Ranges() []Range {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.ranges()
+}
+
+// Nodes are the addresses of the other nodes serving slots.
+func (self *Cluster) Nodes() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	seen := map[string]bool{self.opts.Addr: true}
+	ret := make([]string, 0)
+	for _, addr := range self.owners {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			ret = append(ret, addr)
+		}
+	}
+	return ret
+}
+
+func (self *Cluster) Owner(slot int) string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.owners[slot]
+}
+
+// SetMigrating starts moving the slot served by the node to the target.
+func (self *Cluster) SetMigrating(slot int, target string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.owners[slot] != self.opts.Addr {
+		return ErrNotOwner
+	}
+	self.migrating[slot] = target
+	return nil
+}
+
+// SetImporting accepts the keys of the slot from the source after ASKING.
+func (self *Cluster) SetImporting(slot int, source string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.owners[slot] == self.opts.Addr {
+		return ErrAlreadyOwner
+	}
+	self.importing[slot] = source
+	return nil
+}
+
+// Migrating returns the target of the slot being moved from the node.
+func (self *Cluster) Migrating(slot int) (string, bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	target, ok := self.migrating[slot]
+	return target, ok
+}
+
+// SetMoving marks the keys being copied to the target, their writes fail with TRYAGAIN.
+// It should be called while the shards of the keys are locked, so no write
+// of them is in progress.
+func (self *Cluster) SetMoving(keys []core.StrValue, moving bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, key := range keys {
+		if moving {
+			self.moving[key] = struct{}{}
+		} else {
+			delete(self.moving, key)
+		}
+	}
+}
+
+// checks the keys of the migrating slot while their shards are locked
+func (self *Cluster) checkMigrating(r storage.Reader, slot int, target string, keys []core.StrValue) error {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var found int
+	for _, key := range keys {
+		if _, ok := self.moving[key]; ok {
+			return ErrTryAgain
+		}
+		if _, ok := r.Get(key); ok {
+			found += 1
+		}
+	}
+	switch found {
+	case len(keys):
+		return nil
+	case 0:
+		// the keys are moved already or are new
+		return &AskError{Slot: slot, Addr: target}
+	}
+	return ErrTryAgain
+}
+
+// route checks if the node serves the keys, the returned function checks
+// the keys of the migrating slot once their shards are locked
+func (self *Cluster) route(keys []core.StrValue, asking bool) (func(storage.Reader) error, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	slot := Slot([]byte(keys[0]))
+	for _, key := range keys[1:] {
+		if Slot([]byte(key)) != slot {
+			return nil, ErrCrossSlot
+		}
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	owner := self.owners[slot]
+	if owner == "" {
+		return nil, ErrClusterDown
+	}
+	if owner != self.opts.Addr {
+		if _, ok := self.importing[slot]; ok && asking {
+			return nil, nil
+		}
+		return nil, &MovedError{Slot: slot, Addr: owner}
+	}
+	target, ok := self.migrating[slot]
+	if !ok {
+		return nil, nil
+	}
+	return func(r storage.Reader) error {
+		return self.checkMigrating(r, slot, target, keys)
+	}, nil
+}
+
+// Session limits the storage of the session to the keys served by the node.
+// The writes of the leader and of the slot migration are not checked.
+func (self *Cluster) Session(s session.Session) session.Session {
+	if session.IsReplication(s) {
+		return s
+	}
+	return &clusterSession{
+		Session: s,
+		storage: &clusterStorage{
+			Storage: s.Storage(),
+			cluster: self,
+			asking:  session.TakeAsking(s),
+		},
+	}
+}
+
+// saves the slots into the config file, must be called under the lock
+func (self *Cluster) save() error {
+	if self.opts.ConfigFile == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, r := range self.ranges() {
+		fmt.Fprintln(&buf, r.String())
+	}
+	tmpPath := self.opts.ConfigFile + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, self.opts.ConfigFile)
+}
+
+// Load reads the slots saved into the config file, returns false if there is
+// no config yet.
+func (self *Cluster) Load() (bool, error) {
+	if self.opts.ConfigFile == "" {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(self.opts.ConfigFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	ranges := make([]Range, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return false, ErrInvalidConfig
+		}
+		r, err := ParseRanges(fields[1] + "=" + fields[0])
+		if err != nil {
+			return false, ErrInvalidConfig
+		}
+		ranges = append(ranges, r...)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, r := range ranges {
+		for slot := r.Start; slot <= r.End; slot++ {
+			self.owners[slot] = r.Addr
+		}
+	}
+	return true, nil
+}
+
+func New(opts *Options) *Cluster {
+	if opts == nil {
+		opts = DefaultOptions
+	}
+	return &Cluster{
+		opts:      opts,
+		migrating: make(map[int]string),
+		importing: make(map[int]string),
+		moving:    make(map[core.StrValue]struct{}),
+	}
+}
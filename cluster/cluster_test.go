@@ -0,0 +1,184 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+)
+
+const (
+	self  = "127.0.0.1:1"
+	other = "127.0.0.1:2"
+)
+
+func Test_Slot(t *testing.T) {
+	if Slot([]byte("{user:1}:name")) != Slot([]byte("{user:1}:email")) {
+		t.Errorf("Slot() differs for the same hash tag")
+	}
+	if Slot([]byte("{}a")) != Slot([]byte("{}a")) || Slot([]byte("{}a")) == Slot([]byte("a")) {
+		t.Errorf("Slot() hashes the empty hash tag")
+	}
+	for _, key := range []string{"", "a", "{a", "a}"} {
+		if slot := Slot([]byte(key)); CheckSlot(slot) != nil {
+			t.Errorf("Slot(%q) = %d", key, slot)
+		}
+	}
+}
+
+func Test_ParseRanges(t *testing.T) {
+	ranges, err := ParseRanges("a:1=0-8191, b:2=8192-16382,b:2=16383")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Range{{0, 8191, "a:1"}, {8192, 16382, "b:2"}, {16383, 16383, "b:2"}}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("ParseRanges() = %v, want %v", ranges, want)
+	}
+	for _, spec := range []string{"a:1", "a:1=x", "a:1=10-5", "a:1=0-16384", "=0-1"} {
+		if _, err := ParseRanges(spec); err != ErrInvalidSlotRange {
+			t.Errorf("ParseRanges(%q) error = %v", spec, err)
+		}
+	}
+}
+
+// a node serving the first half of the slots with the keys in the storage
+func newTestCluster(t *testing.T, keys ...core.StrValue) (*Cluster, session.Session) {
+	c := New(&Options{Addr: self})
+	if err := c.Assign(Range{0, Slots/2 - 1, self}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Assign(Range{Slots / 2, Slots - 1, other}); err != nil {
+		t.Fatal(err)
+	}
+	s := storage.New(nil)
+	for _, key := range keys {
+		s.Write(func(w storage.Writer) (interface{}, error) {
+			w.Set(key, "value")
+			return nil, nil
+		}, key)
+	}
+	return c, session.WithAuth(session.WithStorage(session.New(), s))
+}
+
+// a key of the slot served by the node or by the other one
+func testKey(t *testing.T, own bool) core.StrValue {
+	for i := 0; i < 1000; i++ {
+		key := core.StrValue(string(rune('a'+i%26)) + string(rune('a'+i/26)))
+		if (Slot([]byte(key)) < Slots/2) == own {
+			return key
+		}
+	}
+	t.Fatal("no key")
+	return ""
+}
+
+func read(c *Cluster, s session.Session, keys ...core.StrValue) error {
+	_, err := c.Session(s).Storage().Read(func(storage.Reader) (interface{}, error) {
+		return nil, nil
+	}, keys...)
+	return err
+}
+
+func Test_Cluster_Session(t *testing.T) {
+	own, foreign := testKey(t, true), testKey(t, false)
+	c, s := newTestCluster(t, own)
+
+	if err := read(c, s, own); err != nil {
+		t.Errorf("own key error = %v", err)
+	}
+	if err := read(c, s); err != nil {
+		t.Errorf("no keys error = %v", err)
+	}
+	want := &MovedError{Slot: Slot([]byte(foreign)), Addr: other}
+	if err := read(c, s, foreign); !reflect.DeepEqual(err, want) {
+		t.Errorf("foreign key error = %v, want %v", err, want)
+	}
+	if err := read(c, s, own, foreign); err != ErrCrossSlot {
+		t.Errorf("keys of different slots error = %v, want %v", err, ErrCrossSlot)
+	}
+	if err := read(c, session.WithReplication(s), foreign); err != nil {
+		t.Errorf("replication error = %v", err)
+	}
+
+	// importing
+	slot := Slot([]byte(foreign))
+	if err := c.SetImporting(slot, other); err != nil {
+		t.Fatal(err)
+	}
+	session.SetAsking(s, true)
+	if err := read(c, s, foreign); err != nil {
+		t.Errorf("importing error = %v", err)
+	}
+	if err := read(c, s, foreign); !reflect.DeepEqual(err, want) {
+		t.Errorf("importing without ASKING error = %v, want %v", err, want)
+	}
+}
+
+func Test_Cluster_Migrating(t *testing.T) {
+	own := testKey(t, true)
+	missing := own + "{" + own + "}"
+	c, s := newTestCluster(t, own)
+	slot := Slot([]byte(own))
+	if err := c.SetMigrating(slot, other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := read(c, s, own); err != nil {
+		t.Errorf("stored key error = %v", err)
+	}
+	want := &AskError{Slot: slot, Addr: other}
+	if err := read(c, s, missing); !reflect.DeepEqual(err, want) {
+		t.Errorf("missing key error = %v, want %v", err, want)
+	}
+	if err := read(c, s, own, missing); err != ErrTryAgain {
+		t.Errorf("partially stored keys error = %v, want %v", err, ErrTryAgain)
+	}
+	c.SetMoving([]core.StrValue{own}, true)
+	if err := read(c, s, own); err != ErrTryAgain {
+		t.Errorf("moving key error = %v, want %v", err, ErrTryAgain)
+	}
+	c.SetMoving([]core.StrValue{own}, false)
+
+	if err := c.Assign(Range{slot, slot, other}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Migrating(slot); ok {
+		t.Errorf("Assign() keeps the slot migrating")
+	}
+	if err := c.SetMigrating(slot, other); err != ErrNotOwner {
+		t.Errorf("SetMigrating() error = %v, want %v", err, ErrNotOwner)
+	}
+}
+
+func Test_Cluster_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := &Options{Addr: self, ConfigFile: filepath.Join(dir, "nodes.conf")}
+
+	c := New(opts)
+	if loaded, err := c.Load(); err != nil || loaded {
+		t.Fatalf("Load() = %v, %v, want no config", loaded, err)
+	}
+	c.Assign(Range{0, Slots - 1, self})
+	c.Assign(Range{100, 100, other})
+
+	restored := New(opts)
+	if loaded, err := restored.Load(); err != nil || !loaded {
+		t.Fatalf("Load() = %v, %v", loaded, err)
+	}
+	if got, want := restored.Ranges(), c.Ranges(); !reflect.DeepEqual(got, want) || len(got) != 3 {
+		t.Errorf("Ranges() = %v, want %v", got, want)
+	}
+	if got := restored.Nodes(); !reflect.DeepEqual(got, []string{other}) {
+		t.Errorf("Nodes() = %v", got)
+	}
+}
@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+const (
+	// number of the hash slots, the keys are assigned to the nodes by slots
+	Slots = 16384
+)
+
+var (
+	ErrInvalidSlot      = errors.New("invalid slot")
+	ErrInvalidSlotRange = errors.New("invalid slot range")
+)
+
+// Slot is the hash slot of the key. Only the part of the key inside the first
+// {...} is hashed if it is not empty, so the keys like {user:1}:name and
+// {user:1}:email are in the same slot.
+func Slot(key []byte) int {
+	if start := bytes.IndexByte(key, '{'); start >= 0 {
+		if end := bytes.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc32.ChecksumIEEE(key) % Slots)
+}
+
+func CheckSlot(slot int) error {
+	if slot < 0 || slot >= Slots {
+		return ErrInvalidSlot
+	}
+	return nil
+}
+
+// Range is the slots from Start to End inclusive served by the node at Addr.
+type Range struct {
+	Start int
+	End   int
+	Addr  string
+}
+
+func (self Range) String() string {
+	return fmt.Sprintf("%d-%d %s", self.Start, self.End, self.Addr)
+}
+
+func (self Range) check() error {
+	if CheckSlot(self.Start) != nil || CheckSlot(self.End) != nil || self.Start > self.End {
+		return ErrInvalidSlotRange
+	}
+	if self.Addr == "" {
+		return ErrInvalidSlotRange
+	}
+	return nil
+}
+
+// parses slots as 100 or 0-8191
+func parseSlots(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, ErrInvalidSlotRange
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, ErrInvalidSlotRange
+		}
+	}
+	return start, end, nil
+}
+
+// ParseRanges parses the slots of the nodes as
+// host:port=0-8191,host:port=8192-16383, a node may have several ranges.
+func ParseRanges(spec string) ([]Range, error) {
+	ret := make([]Range, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			return nil, ErrInvalidSlotRange
+		}
+		start, end, err := parseSlots(item[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		r := Range{Start: start, End: end, Addr: item[:i]}
+		if err := r.check(); err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
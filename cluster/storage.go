@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/pubsub"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+)
+
+// clusterStorage fails the access to the keys which are not served by the node.
+// The functions without keys access the keys of the node only.
+type clusterStorage struct {
+	storage.Storage
+	cluster *Cluster
+	asking  bool
+}
+
+func (self *clusterStorage) checkedWrite(fn storage.WriteFn, keys []core.StrValue) (storage.WriteFn, error) {
+	check, err := self.cluster.route(keys, self.asking)
+	if err != nil || check == nil {
+		return fn, err
+	}
+	return func(w storage.Writer) (interface{}, error) {
+		if err := check(w); err != nil {
+			return nil, err
+		}
+		return fn(w)
+	}, nil
+}
+
+func (self *clusterStorage) Write(fn storage.WriteFn, keys ...core.StrValue) (interface{}, error) {
+	fn, err := self.checkedWrite(fn, keys)
+	if err != nil {
+		return nil, err
+	}
+	return self.Storage.Write(fn, keys...)
+}
+
+func (self *clusterStorage) Free(fn storage.WriteFn, keys ...core.StrValue) (interface{}, error) {
+	fn, err := self.checkedWrite(fn, keys)
+	if err != nil {
+		return nil, err
+	}
+	return self.Storage.Free(fn, keys...)
+}
+
+func (self *clusterStorage) Read(fn storage.ReadFn, keys ...core.StrValue) (interface{}, error) {
+	check, err := self.cluster.route(keys, self.asking)
+	if err != nil {
+		return nil, err
+	}
+	if check == nil {
+		return self.Storage.Read(fn, keys...)
+	}
+	return self.Storage.Read(func(r storage.Reader) (interface{}, error) {
+		if err := check(r); err != nil {
+			return nil, err
+		}
+		return fn(r)
+	}, keys...)
+}
+
+func (self *clusterStorage) Watch(keys ...core.StrValue) (*storage.Watch, error) {
+	if _, err := self.cluster.route(keys, self.asking); err != nil {
+		return nil, err
+	}
+	return self.Storage.Watch(keys...)
+}
+
+type clusterSession struct {
+	session.Session
+	storage storage.Storage
+}
+
+func (self *clusterSession) Storage() storage.Storage {
+	return self.storage
+}
+
+// ASKING is executed with the checked session
+func (self *clusterSession) SetAsking(asking bool) {
+	session.SetAsking(self.Session, asking)
+}
+
+func (self *clusterSession) TakeAsking() bool {
+	return session.TakeAsking(self.Session)
+}
+
+func (self *clusterSession) SetSubscriber(sub *pubsub.Subscriber) {
+	session.SetSubscriber(self.Session, sub)
+}
+
+func (self *clusterSession) Subscriber() *pubsub.Subscriber {
+	return session.Subscriber(self.Session)
+}
+
+func (self *clusterSession) Transaction() *session.Tx {
+	return session.Transaction(self.Session)
+}
@@ -0,0 +1,291 @@
+// Journaltool inspects and repairs the journal files of the cache offline.
+//
+// Usage:
+//
+//	journaltool dump [-json] [-key pattern] journal
+//	journaltool stats journal
+//	journaltool verify journal
+//	journaltool repair [-exclude pattern] journal output
+//
+// The key of an entry is its first argument, patterns are matched as in path.Match.
+//
+// The repaired journal starts with a new JOURNALID, so the server ignores
+// the snapshots taken before the repair instead of skipping the entries
+// they counted.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/auvn/go.cache/journal"
+)
+
+const (
+	// the first entry of a rewritten journal, it has no key
+	journalIDEntry = "JOURNALID"
+)
+
+var (
+	errUsage = errors.New("usage: journaltool dump|stats|verify|repair [flags] journal")
+)
+
+// entry is a command read from the journal.
+type entry struct {
+	Offset  int64    `json:"offset"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	size    int
+}
+
+func newEntry(offset int64, body [][]byte) *entry {
+	e := &entry{Offset: offset, Args: make([]string, 0, len(body))}
+	for i, item := range body {
+		e.size += len(item)
+		if i == 0 {
+			e.Command = strings.ToUpper(string(item))
+		} else {
+			e.Args = append(e.Args, string(item))
+		}
+	}
+	return e
+}
+
+// the key does not match an empty pattern
+func (self *entry) match(pattern string) (bool, error) {
+	if pattern == "" || len(self.Args) == 0 || self.Command == journalIDEntry {
+		return false, nil
+	}
+	return path.Match(pattern, self.Args[0])
+}
+
+func (self *entry) String() string {
+	items := make([]string, 0, len(self.Args)+2)
+	items = append(items, fmt.Sprintf("%d", self.Offset), self.Command)
+	for _, arg := range self.Args {
+		items = append(items, fmt.Sprintf("%q", arg))
+	}
+	return strings.Join(items, " ")
+}
+
+// scanResult is the result of reading the journal up to the end or the damaged entry.
+type scanResult struct {
+	Entries   int
+	Size      int64
+	Valid     int64 // bytes of the valid entries
+	Version   byte
+	Corrupted *journal.CorruptedError
+}
+
+// reads the entries of the journal, stops at the first damaged one
+func scan(name string, fn func(e *entry, body [][]byte) error) (*scanResult, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := journal.NewLimitedReader(f, info.Size())
+	ret := &scanResult{Size: info.Size()}
+	for {
+		body, err := r.NextEntry()
+		if err == journal.ErrEmpty {
+			break
+		} else if cerr, ok := err.(*journal.CorruptedError); ok {
+			ret.Corrupted = cerr
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		ret.Entries += 1
+		if err := fn(newEntry(r.Offset(), body), body); err != nil {
+			return nil, err
+		}
+	}
+	ret.Valid = r.Tell()
+	if ret.Corrupted != nil {
+		ret.Valid = ret.Corrupted.Offset
+	}
+	ret.Version = r.Version()
+	return ret, nil
+}
+
+func (self *scanResult) report(w io.Writer) {
+	fmt.Fprintf(w, "version: %d, entries: %d, size: %d\n", self.Version, self.Entries, self.Size)
+	if self.Corrupted != nil {
+		fmt.Fprintf(w, "%s, %d bytes cannot be read\n", self.Corrupted.Error(), self.Size-self.Valid)
+	} else if self.Valid+1 < self.Size {
+		// the status of the next entry ends the journal, the rest is the entry
+		// being written or rolled back, it is overwritten on the next write
+		fmt.Fprintf(w, "%d bytes of uncommitted entries at offset %d\n", self.Size-self.Valid, self.Valid)
+	}
+}
+
+func dump(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print entries as JSON lines")
+	pattern := flags.String("key", "", "Print only entries with the keys matching the pattern")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	res, err := scan(flags.Arg(0), func(e *entry, body [][]byte) error {
+		if *pattern != "" {
+			if ok, err := e.match(*pattern); err != nil || !ok {
+				return err
+			}
+		}
+		if *asJSON {
+			return encoder.Encode(e)
+		}
+		_, err := fmt.Println(e.String())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if res.Corrupted != nil {
+		return res.Corrupted
+	}
+	return nil
+}
+
+type commandStats struct {
+	name    string
+	entries int
+	bytes   int
+}
+
+func stats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	byName := make(map[string]*commandStats)
+	res, err := scan(flags.Arg(0), func(e *entry, body [][]byte) error {
+		s, ok := byName[e.Command]
+		if !ok {
+			s = &commandStats{name: e.Command}
+			byName[e.Command] = s
+		}
+		s.entries += 1
+		s.bytes += e.size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sorted := make([]*commandStats, 0, len(byName))
+	for _, s := range byName {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].entries != sorted[j].entries {
+			return sorted[i].entries > sorted[j].entries
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	fmt.Printf("%-20s %10s %12s\n", "command", "entries", "bytes")
+	for _, s := range sorted {
+		fmt.Printf("%-20s %10d %12d\n", s.name, s.entries, s.bytes)
+	}
+	res.report(os.Stdout)
+	return nil
+}
+
+func verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	res, err := scan(flags.Arg(0), func(*entry, [][]byte) error { return nil })
+	if err != nil {
+		return err
+	}
+	res.report(os.Stdout)
+	if res.Corrupted != nil {
+		return res.Corrupted
+	}
+	return nil
+}
+
+func repair(args []string) error {
+	flags := flag.NewFlagSet("repair", flag.ExitOnError)
+	pattern := flags.String("exclude", "", "Remove entries with the keys matching the pattern")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errUsage
+	}
+	if flags.Arg(0) == flags.Arg(1) {
+		return errors.New("the output should differ from the journal")
+	}
+	var excluded int
+	// the snapshots count the entries of the original journal
+	entries := [][][]byte{{[]byte(journalIDEntry), []byte(fmt.Sprint(time.Now().UnixNano()))}}
+	res, err := scan(flags.Arg(0), func(e *entry, body [][]byte) error {
+		if e.Command == journalIDEntry {
+			return nil
+		}
+		ok, err := e.match(*pattern)
+		if err != nil {
+			return err
+		}
+		if ok {
+			excluded += 1
+		} else {
+			entries = append(entries, body)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	j, err := journal.CreateFile(flags.Arg(1), entries)
+	if err != nil {
+		return err
+	}
+	if err := j.Close(); err != nil {
+		return err
+	}
+	res.report(os.Stdout)
+	fmt.Printf("written: %d entries, excluded: %d, journal id: %s\n", len(entries)-1, excluded, entries[0][1])
+	return nil
+}
+
+func run(args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	switch args[0] {
+	case "dump":
+		return dump(args[1:])
+	case "stats":
+		return stats(args[1:])
+	case "verify":
+		return verify(args[1:])
+	case "repair":
+		return repair(args[1:])
+	}
+	return errUsage
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/auvn/go.cache/journal"
+)
+
+func Test_repair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journaltool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "journal"), filepath.Join(dir, "repaired")
+
+	body := func(args ...string) [][]byte {
+		ret := make([][]byte, len(args))
+		for i, arg := range args {
+			ret[i] = []byte(arg)
+		}
+		return ret
+	}
+	j, err := journal.CreateFile(src, [][][]byte{
+		body(journalIDEntry, "1"),
+		body("SET", "user:1", "a"),
+		body("LPUSH", "list", "a"),
+		body("DEL", "user:1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	if err := run([]string{"repair", "-exclude", "user:*", src, dst}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var id string
+	res, err := scan(dst, func(e *entry, body [][]byte) error {
+		got = append(got, e.Command)
+		if e.Command == journalIDEntry {
+			id = e.Args[0]
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{journalIDEntry, "LPUSH"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("repair() entries = %v, want %v", got, want)
+	}
+	// the snapshots of the original journal are rejected
+	if id == "1" {
+		t.Errorf("repair() keeps the journal id")
+	}
+	if res.Corrupted != nil || res.Entries != 2 {
+		t.Errorf("repair() result = %+v", res)
+	}
+}
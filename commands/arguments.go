@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"math"
+
 	"github.com/auvn/go.cache/core"
 )
 
@@ -12,9 +14,11 @@ type Arguments interface {
 }
 
 type ArgumentsIterator interface {
+	HasNext() bool
 	Next() (core.Value, error)
 	NextStr() (core.StrValue, error)
 	NextInt() (core.IntValue, error)
+	NextFloat() (core.FloatValue, error)
 	NextArray() core.ValueArray
 	NextArguments() Arguments
 }
@@ -25,6 +29,10 @@ type argsIterator struct {
 	len  int
 }
 
+func (self *argsIterator) HasNext() bool {
+	return self.cur < self.len
+}
+
 func (self *argsIterator) Next() (core.Value, error) {
 	if self.cur >= self.len {
 		return core.Value{}, ErrNumberOfArguments
@@ -64,6 +72,21 @@ func (self *argsIterator) NextInt() (core.IntValue, error) {
 	return i, nil
 }
 
+func (self *argsIterator) NextFloat() (core.FloatValue, error) {
+	f := core.EmptyFloatValue
+	val, err := self.Next()
+	if err != nil {
+		return f, err
+	}
+
+	f, err = val.Float()
+	if err != nil || math.IsNaN(f.Value()) {
+		return core.EmptyFloatValue, ErrNonFloat
+	}
+
+	return f, nil
+}
+
 func (self *argsIterator) NextArray() core.ValueArray {
 	arr := make(core.ValueArray, 0, self.len)
 	stop := false
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"errors"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+)
+
+var (
+	ErrNegativeTimeout = errors.New("timeout is negative")
+	// the reply to the blocked pop of the disconnected client, nothing is popped
+	ErrClientClosed = errors.New("client is disconnected")
+)
+
+// blockingPop is the reply of the blocking pops, the handler pops the element
+// once a list is not empty or replies nil once the timeout elapses
+type blockingPop struct {
+	list      *ListCommand
+	keys      []core.StrValue
+	beginning bool
+	// BRPOPLPUSH pushes the element to the destination
+	move        bool
+	destination core.StrValue
+	// zero blocks until an element arrives
+	timeout time.Duration
+}
+
+// pops an element without blocking, the writes are nil if the lists are empty.
+// The writes are the plain pops, so they are replayed without blocking.
+func (self *blockingPop) try(s session.Session) (interface{}, [][][]byte, []interface{}, error) {
+	if self.move {
+		return self.tryMove(s)
+	}
+	name := "RPOP"
+	if self.beginning {
+		name = "LPOP"
+	}
+	for _, key := range self.keys {
+		v, err := self.list.pop(s, self.beginning, key)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if v == nil {
+			continue
+		}
+		reply := []core.Value{core.Value(key), v.(core.Value)}
+		return reply, [][][]byte{{[]byte(name), []byte(key)}}, []interface{}{v}, nil
+	}
+	return nil, nil, nil, nil
+}
+
+func (self *blockingPop) tryMove(s session.Session) (interface{}, [][][]byte, []interface{}, error) {
+	source := self.keys[0]
+	v, err := self.list.RPopLPush(s, source, self.destination)
+	if err != nil || v == nil {
+		return nil, nil, nil, err
+	}
+	writes := [][][]byte{{[]byte("RPOPLPUSH"), []byte(source), []byte(self.destination)}}
+	return v, writes, []interface{}{v}, nil
+}
+
+// the timeout is in seconds, fractions are allowed
+func parseTimeout(v core.Value) (time.Duration, error) {
+	seconds, err := v.Float()
+	if err != nil {
+		return 0, err
+	}
+	if seconds < 0 {
+		return 0, ErrNegativeTimeout
+	}
+	return time.Duration(float64(seconds) * float64(time.Second)), nil
+}
+
+// blocked is a session waiting for an element of the lists
+type blocked struct {
+	pop     *blockingPop
+	session session.Session
+	resp    chan<- interface{}
+	flag    int
+	// the waiter is dropped once its client disconnects
+	closed <-chan struct{}
+	// zero waits until an element arrives
+	deadline time.Time
+}
+
+func (self *blocked) disconnected() bool {
+	select {
+	case <-self.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (self *blocked) expired() bool {
+	return !self.deadline.IsZero() && !time.Now().Before(self.deadline)
+}
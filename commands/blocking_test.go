@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/server"
+	"github.com/auvn/go.cache/session"
+)
+
+func Test_BlockingPop(t *testing.T) {
+	h, s := newTestHandler()
+	var entries [][][]byte
+	h.AddSuccessHook(func(flag int, body [][]byte, reply interface{}) <-chan error {
+		if !CheckFlag(flag, NonJournalableFlag) {
+			entries = append(entries, body)
+		}
+		return nil
+	})
+	serveHandler(t, h)
+
+	mustRequest(t, h, s, "RPUSH", "b", "1")
+	want := []core.Value{core.Value("b"), core.Value("1")}
+	if got := mustRequest(t, h, s, "BLPOP", "a", "b", "0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("BLPOP = %v, want %v", got, want)
+	}
+	if got := mustRequest(t, h, s, "BRPOP", "a", "b", "0.02"); got != nil {
+		t.Errorf("BRPOP of the empty lists = %v, want nil", got)
+	}
+	if _, err := request(h, s, "BLPOP", "a", "-1"); err != ErrNegativeTimeout {
+		t.Errorf("BLPOP error = %v, want %v", err, ErrNegativeTimeout)
+	}
+
+	// the blocked session does not hold the other requests
+	blocked := server.NewRequest([][]byte{[]byte("BLPOP"), []byte("a"), []byte("b"), []byte("0")}, s)
+	h.HandleRequest(blocked)
+	moved := server.NewRequest([][]byte{[]byte("BRPOPLPUSH"), []byte("c"), []byte("d"), []byte("5")}, s)
+	h.HandleRequest(moved)
+	mustRequest(t, h, s, "SET", "x", "1")
+	mustRequest(t, h, s, "RPUSH", "b", "2")
+	if got, err := blocked.Get(nil); err != nil || !reflect.DeepEqual(got, []core.Value{core.Value("b"), core.Value("2")}) {
+		t.Errorf("blocked BLPOP = %v, %v", got, err)
+	}
+	mustRequest(t, h, s, "RPUSH", "c", "3")
+	if got, err := moved.Get(nil); err != nil || !reflect.DeepEqual(got, core.Value("3")) {
+		t.Errorf("blocked BRPOPLPUSH = %v, %v", got, err)
+	}
+	if got := mustRequest(t, h, s, "LRANGE", "d", "0", "-1"); !reflect.DeepEqual(got, []core.Value{core.Value("3")}) {
+		t.Errorf("LRANGE of the destination = %v", got)
+	}
+
+	// the pops are passed to the hooks, so they are replayed without blocking
+	wantEntries := [][]string{
+		{"RPUSH", "b", "1"},
+		{"LPOP", "b"},
+		{"SET", "x", "1"},
+		{"RPUSH", "b", "2"},
+		{"LPOP", "b"},
+		{"RPUSH", "c", "3"},
+		{"RPOPLPUSH", "c", "d"},
+	}
+	if len(entries) != len(wantEntries) {
+		t.Fatalf("hook entries = %q, want %q", entries, wantEntries)
+	}
+	for i, e := range entries {
+		if got := toStrings(e); !reflect.DeepEqual(got, wantEntries[i]) {
+			t.Errorf("hook entry %d = %q, want %q", i, got, wantEntries[i])
+		}
+	}
+
+	start := time.Now()
+	if got := mustRequest(t, h, s, "BRPOPLPUSH", "c", "d", "0.05"); got != nil {
+		t.Errorf("BRPOPLPUSH of the empty list = %v, want nil", got)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("BRPOPLPUSH returned after %v, want the timeout", elapsed)
+	}
+}
+
+type testConn chan struct{}
+
+func (self testConn) Closed() <-chan struct{} {
+	return self
+}
+
+func Test_BlockingPop_Disconnected(t *testing.T) {
+	h, base := newTestHandler()
+	serveHandler(t, h)
+	conn := make(testConn)
+	s := session.WithAuth(base)
+	session.SetConn(s, conn)
+
+	blocked := server.NewRequest([][]byte{[]byte("BLPOP"), []byte("q"), []byte("0")}, s)
+	h.HandleRequest(blocked)
+	mustRequest(t, h, base, "SET", "x", "1")
+	close(conn)
+	if _, err := blocked.Get(nil); err != ErrClientClosed {
+		t.Errorf("BLPOP of the disconnected client error = %v, want %v", err, ErrClientClosed)
+	}
+	// the element is left for the other waiters
+	mustRequest(t, h, base, "RPUSH", "q", "job")
+	if got := mustRequest(t, h, base, "LLEN", "q"); got != core.IntValue(1) {
+		t.Errorf("LLEN = %v, want 1", got)
+	}
+	// the disconnected client does not pop the element already in the list
+	popped := server.NewRequest([][]byte{[]byte("BLPOP"), []byte("q"), []byte("0")}, s)
+	h.HandleRequest(popped)
+	if _, err := popped.Get(nil); err != ErrClientClosed {
+		t.Errorf("BLPOP of the disconnected client error = %v, want %v", err, ErrClientClosed)
+	}
+	if got := mustRequest(t, h, base, "LLEN", "q"); got != core.IntValue(1) {
+		t.Errorf("LLEN = %v, want 1", got)
+	}
+}
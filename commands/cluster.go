@@ -0,0 +1,407 @@
+package commands
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/auvn/go.cache/client"
+	"github.com/auvn/go.cache/cluster"
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/net/serializer"
+	"github.com/auvn/go.cache/server"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+	"github.com/auvn/go.cache/util/sync"
+)
+
+const (
+	// max number of keys copied to the target at once
+	migrationBatchSize = 100
+)
+
+var (
+	_ (sync.Server) = (*SlotMigrator)(nil)
+
+	ErrClusterUnsupported  = errors.New("cluster mode is not enabled")
+	ErrMigrationInProgress = errors.New("the slot is already being migrated")
+
+	DefaultSlotMigratorOptions = &SlotMigratorOptions{
+		DialTimeout: 5 * time.Second,
+		Timeout:     30 * time.Second,
+	}
+)
+
+type SlotMigratorOptions struct {
+	// the password of the other nodes
+	Auth        string
+	DialTimeout time.Duration
+	// timeout of a single call to another node
+	Timeout time.Duration
+}
+
+// nodeConn is a connection to another node of the cluster.
+type nodeConn struct {
+	c       net.Conn
+	conn    client.Connection
+	timeout time.Duration
+}
+
+func (self *nodeConn) receive() (serializer.Payload, error) {
+	p, err := self.conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	if p.IsErr() {
+		return nil, p.Err()
+	}
+	return p, nil
+}
+
+func (self *nodeConn) call(args ...interface{}) (serializer.Payload, error) {
+	self.c.SetDeadline(time.Now().Add(self.timeout))
+	if err := self.conn.Send(client.Payload(args)); err != nil {
+		return nil, err
+	}
+	return self.receive()
+}
+
+// the commands are sent one by one, the batch stops at the first failed one
+func (self *nodeConn) callAll(bodies [][][]byte) error {
+	for _, body := range bodies {
+		self.c.SetDeadline(time.Now().Add(self.timeout))
+		if err := self.conn.Send(body); err != nil {
+			return err
+		}
+		if _, err := self.receive(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *nodeConn) Close() error {
+	return self.conn.Close()
+}
+
+// SlotMigrator moves the keys of the slots to other nodes while the slots are served.
+type SlotMigrator struct {
+	opts    *SlotMigratorOptions
+	cluster *cluster.Cluster
+	session session.Session
+	handler *Handler
+
+	mu      gosync.Mutex
+	running map[int]bool
+	quit    chan struct{}
+}
+
+func (self *SlotMigrator) dial(addr string) (*nodeConn, error) {
+	c, err := net.DialTimeout("tcp", addr, self.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &nodeConn{c: c, conn: client.NewConnection(c), timeout: self.opts.Timeout}
+	if self.opts.Auth != "" {
+		if _, err := conn.call("AUTH", self.opts.Auth); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// executes the command in order with the other commands of the handler,
+// it is journaled and replicated as usual
+func (self *SlotMigrator) execute(body [][]byte) error {
+	req := server.NewRequest(body, session.WithReplication(self.session))
+	self.handler.HandleRequest(req)
+	_, err := req.Get(self.quit)
+	return err
+}
+
+// scans the whole keyspace, so it is done once per migration
+func (self *SlotMigrator) keysInSlot(slot int) ([]core.StrValue, error) {
+	ret, err := self.session.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		keys := make([]core.StrValue, 0)
+		for _, key := range r.Keys() {
+			if cluster.Slot([]byte(key)) == slot {
+				keys = append(keys, key)
+			}
+		}
+		return keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.([]core.StrValue), nil
+}
+
+// CountKeysInSlot is the number of the keys of the slot stored by the node.
+func (self *SlotMigrator) CountKeysInSlot(slot int) (int, error) {
+	keys, err := self.keysInSlot(slot)
+	return len(keys), err
+}
+
+// the commands replacing the keys on the target, the keys are marked as moving,
+// so they are not changed until they are removed from the node
+func (self *SlotMigrator) dumpKeys(keys []core.StrValue) ([][][]byte, error) {
+	ret, err := self.session.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		self.cluster.SetMoving(keys, true)
+		bodies := make([][][]byte, 0, 2*len(keys))
+		for _, key := range keys {
+			entries, err := DumpKey(r, key)
+			if err != nil {
+				return nil, err
+			}
+			// the removed key might be created on the target meanwhile
+			if entries == nil {
+				continue
+			}
+			bodies = append(bodies, [][]byte{[]byte("ASKING")}, [][]byte{[]byte("DEL"), []byte(key)})
+			for _, entry := range entries {
+				bodies = append(bodies, [][]byte{[]byte("ASKING")}, entry)
+			}
+		}
+		return bodies, nil
+	}, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return ret.([][][]byte), nil
+}
+
+// moves the batch of keys to the target
+func (self *SlotMigrator) moveKeys(conn *nodeConn, keys []core.StrValue) error {
+	defer self.cluster.SetMoving(keys, false)
+	bodies, err := self.dumpKeys(keys)
+	if err != nil {
+		return err
+	}
+	if err := conn.callAll(bodies); err != nil {
+		return err
+	}
+	del := [][]byte{[]byte("DEL")}
+	for _, key := range keys {
+		del = append(del, []byte(key))
+	}
+	return self.execute(del)
+}
+
+// tells the other nodes the new owner of the slot, they redirect to the
+// previous owner until then
+func (self *SlotMigrator) announce(slot int, target string) {
+	for _, addr := range self.cluster.Nodes() {
+		conn, err := self.dial(addr)
+		if err == nil {
+			_, err = conn.call("CLUSTER", "ASSIGN", slot, slot, target)
+			conn.Close()
+		}
+		if err != nil {
+			log.Printf("cannot announce the slot %d to %s: %s", slot, addr, err)
+		}
+	}
+}
+
+func (self *SlotMigrator) migrate(slot int, target string) error {
+	conn, err := self.dial(target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.call("CLUSTER", "IMPORTING", slot, self.cluster.Addr()); err != nil {
+		return err
+	}
+	// new keys of the slot are created on the target since the migration
+	// started, so the keys found once are all of the keys left
+	keys, err := self.keysInSlot(slot)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += migrationBatchSize {
+		select {
+		case <-self.quit:
+			return server.ErrQuit
+		default:
+		}
+		end := start + migrationBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := self.moveKeys(conn, keys[start:end]); err != nil {
+			return err
+		}
+	}
+	if err := self.cluster.Assign(cluster.Range{Start: slot, End: slot, Addr: target}); err != nil {
+		return err
+	}
+	self.announce(slot, target)
+	log.Printf("slot %d migrated to %s, keys: %d", slot, target, len(keys))
+	return nil
+}
+
+// Migrate starts moving the keys of the slot to the target, the keys which are
+// not moved yet are served by the node, the others are redirected to the target with ASK.
+// The failed migration can be started again.
+func (self *SlotMigrator) Migrate(slot int, target string) error {
+	if err := cluster.CheckSlot(slot); err != nil {
+		return err
+	}
+	if target == self.cluster.Addr() {
+		return cluster.ErrAlreadyOwner
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.running[slot] {
+		return ErrMigrationInProgress
+	}
+	if err := self.cluster.SetMigrating(slot, target); err != nil {
+		return err
+	}
+	self.running[slot] = true
+	go func() {
+		if err := self.migrate(slot, target); err != nil {
+			log.Printf("cannot migrate the slot %d to %s: %s", slot, target, err)
+		}
+		self.mu.Lock()
+		defer self.mu.Unlock()
+		delete(self.running, slot)
+	}()
+	return nil
+}
+
+func (self *SlotMigrator) Serve(quit sync.Quit) error {
+	<-quit
+	close(self.quit)
+	return nil
+}
+
+func (self *SlotMigrator) AttachTo(h *Handler) {
+	self.handler = h
+	h.SetCluster(self.cluster)
+}
+
+func (self *SlotMigrator) Cluster() *cluster.Cluster {
+	return self.cluster
+}
+
+func NewSlotMigrator(c *cluster.Cluster, s session.Session, opts *SlotMigratorOptions) *SlotMigrator {
+	if opts == nil {
+		opts = DefaultSlotMigratorOptions
+	}
+	return &SlotMigrator{
+		opts:    opts,
+		cluster: c,
+		session: s,
+		running: make(map[int]bool),
+		quit:    make(chan struct{}),
+	}
+}
+
+type ClusterCommand struct {
+	migrator *SlotMigrator
+}
+
+func (self *ClusterCommand) slots() interface{} {
+	ranges := self.migrator.Cluster().Ranges()
+	ret := make([]interface{}, len(ranges))
+	for i, r := range ranges {
+		ret[i] = []interface{}{r.Start, r.End, r.Addr}
+	}
+	return ret
+}
+
+// CLUSTER SLOTS|KEYSLOT key|COUNTKEYSINSLOT slot|ASSIGN start end addr|
+// MIGRATE slot addr|IMPORTING slot addr
+func (self *ClusterCommand) Cluster(s session.Session, sub core.StrValue, args ...core.Value) (interface{}, error) {
+	if self.migrator == nil {
+		return nil, ErrClusterUnsupported
+	}
+	c := self.migrator.Cluster()
+	arguments := NewArguments(args...)
+	switch strings.ToUpper(sub.Value()) {
+	case "SLOTS":
+		if arguments.Len() != 0 {
+			return nil, ErrNumberOfArguments
+		}
+		return self.slots(), nil
+	case "KEYSLOT":
+		iter, err := arguments.IterN(1)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := iter.Next()
+		return cluster.Slot(key), nil
+	case "COUNTKEYSINSLOT":
+		iter, err := arguments.IterN(1)
+		if err != nil {
+			return nil, err
+		}
+		slot, err := iter.NextInt()
+		if err != nil {
+			return nil, err
+		}
+		if err := cluster.CheckSlot(slot.Value()); err != nil {
+			return nil, err
+		}
+		return self.migrator.CountKeysInSlot(slot.Value())
+	case "ASSIGN":
+		iter, err := arguments.IterN(3)
+		if err != nil {
+			return nil, err
+		}
+		start, err := iter.NextInt()
+		if err != nil {
+			return nil, err
+		}
+		end, err := iter.NextInt()
+		if err != nil {
+			return nil, err
+		}
+		addr, _ := iter.NextStr()
+		if err := c.Assign(cluster.Range{Start: start.Value(), End: end.Value(), Addr: addr.Value()}); err != nil {
+			return nil, err
+		}
+		return true, nil
+	case "MIGRATE", "IMPORTING":
+		iter, err := arguments.IterN(2)
+		if err != nil {
+			return nil, err
+		}
+		slot, err := iter.NextInt()
+		if err != nil {
+			return nil, err
+		}
+		if err := cluster.CheckSlot(slot.Value()); err != nil {
+			return nil, err
+		}
+		addr, _ := iter.NextStr()
+		if strings.ToUpper(sub.Value()) == "IMPORTING" {
+			err = c.SetImporting(slot.Value(), addr.Value())
+		} else {
+			err = self.migrator.Migrate(slot.Value(), addr.Value())
+		}
+		if err != nil {
+			return nil, err
+		}
+		return true, nil
+	}
+	return nil, ErrSyntax
+}
+
+// ASKING allows the next command to access the slot being imported by the node
+func (self *ClusterCommand) Asking(s session.Session) (interface{}, error) {
+	if self.migrator == nil {
+		return nil, ErrClusterUnsupported
+	}
+	session.SetAsking(s, true)
+	return true, nil
+}
+
+// migrator is nil if the cluster mode is disabled
+func NewClusterCommand(migrator *SlotMigrator) *ClusterCommand {
+	return &ClusterCommand{migrator: migrator}
+}
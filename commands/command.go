@@ -16,6 +16,7 @@ var (
 	ErrWrongType         = errors.New("accessing a key holding the wrong type of value")
 	ErrNonStr            = errors.New("non str")
 	ErrNonInt            = errors.New("non int")
+	ErrNonFloat          = errors.New("non float")
 )
 
 type Command interface {
@@ -10,11 +10,15 @@ import (
 )
 
 const (
-	_        int = 1 << iota
-	WFlag        // write
-	RFlag        // read
-	TDFlag       // time dependent
-	AuthFlag     // auth required
+	_            int = 1 << iota
+	WFlag            // write
+	RFlag            // read
+	TDFlag           // time dependent
+	AuthFlag         // auth required
+	SysFlag          // executed in order with writes, but not journaled
+	PushFlag         // allowed in the push mode
+	MultiFlag        // executed immediately in a transaction instead of being queued
+	InternalFlag     // accepted from the journal replay and the replication only
 )
 
 var (
@@ -27,34 +31,50 @@ var (
 	ErrInvalidOutNum             = errors.New("func should return: (interface{}, error)")
 	ErrSessionArgPos             = errors.New("session arguments should be first")
 	ErrNonValuedVariadicArgument = errors.New("non-valued argument cannot be variadic")
+	ErrOptionsArgPos             = errors.New("options argument should be last and cannot follow a variadic one")
 
-	CoreValueType    = reflect.TypeOf(core.Value{})
-	CoreStrValueType = reflect.TypeOf(core.StrValue(""))
-	CoreIntValueType = reflect.TypeOf(core.IntValue(0))
+	CoreValueType      = reflect.TypeOf(core.Value{})
+	CoreStrValueType   = reflect.TypeOf(core.StrValue(""))
+	CoreIntValueType   = reflect.TypeOf(core.IntValue(0))
+	CoreFloatValueType = reflect.TypeOf(core.FloatValue(0))
 
 	SessionType = reflect.TypeOf((*session.Session)(nil)).Elem()
 
 	ErrorType = reflect.TypeOf((*error)(nil)).Elem()
 
+	ArgumentOptionsType = reflect.TypeOf((*ArgumentOptions)(nil)).Elem()
+
 	Flags = &flags{
-		R:  RFlag,
-		W:  WFlag,
-		RA: RFlag | AuthFlag,
-		WA: WFlag | AuthFlag,
-		TD: TDFlag,
-		A:  AuthFlag,
+		R:   RFlag,
+		W:   WFlag,
+		RA:  RFlag | AuthFlag,
+		WA:  WFlag | AuthFlag,
+		WTA: WFlag | TDFlag | AuthFlag,
+		TD:  TDFlag,
+		A:   AuthFlag,
+		SA:  SysFlag | AuthFlag,
+		RSA: RFlag | SysFlag | AuthFlag,
+		SAP: SysFlag | AuthFlag | PushFlag,
+		SAM: SysFlag | AuthFlag | MultiFlag,
+		WAI: WFlag | AuthFlag | InternalFlag,
 	}
 
 	DefaultFlag = (AuthFlag)
 )
 
 type flags struct {
-	R  int
-	RA int
-	W  int
-	WA int
-	TD int
-	A  int
+	R   int
+	RA  int
+	W   int
+	WA  int
+	WTA int
+	TD  int
+	A   int
+	SA  int
+	RSA int
+	SAP int
+	SAM int
+	WAI int
 }
 
 func CheckFlag(flag int, expectedFlag int) bool {
@@ -98,6 +118,26 @@ func (self nonValued) Valued() bool {
 	return false
 }
 
+// ArgumentOptions is implemented by pointer types collecting optional trailing arguments
+// of a command, e.g. SET key value [NX|XX] [EX seconds]
+type ArgumentOptions interface {
+	ParseArguments(ArgumentsIterator) error
+}
+
+type optionsReflector struct {
+	t reflect.Type
+}
+
+func (self *optionsReflector) Reflect(in ReflectorInput) (reflect.Value, error) {
+	value := reflect.New(self.t.Elem())
+	err := value.Interface().(ArgumentOptions).ParseArguments(in.ArgsIterator())
+	return value, err
+}
+
+func (self *optionsReflector) Valued() bool {
+	return false
+}
+
 type ArgumentsProvider map[reflect.Type]ArgumentReflector
 
 func (self ArgumentsProvider) Get(t reflect.Type) (ArgumentReflector, bool) {
@@ -121,12 +161,20 @@ func (self ArgumentsProvider) GetVariadic(t reflect.Type) (ArgumentReflector, bo
 	return reflectorObj, true
 }
 
+func (self ArgumentsProvider) GetOptions(t reflect.Type) (ArgumentReflector, bool) {
+	if t.Kind() != reflect.Ptr || !t.Implements(ArgumentOptionsType) {
+		return nil, false
+	}
+	return &optionsReflector{t: t}, true
+}
+
 func NewArgumentsProvider() ArgumentsProvider {
 	return ArgumentsProvider{
-		CoreValueType:    valued(ValueReflector),
-		CoreStrValueType: valued(StrValueReflector),
-		CoreIntValueType: valued(IntValueReflector),
-		SessionType:      nonValued(SessionValueReflector),
+		CoreValueType:      valued(ValueReflector),
+		CoreStrValueType:   valued(StrValueReflector),
+		CoreIntValueType:   valued(IntValueReflector),
+		CoreFloatValueType: valued(FloatValueReflector),
+		SessionType:        nonValued(SessionValueReflector),
 	}
 }
 
@@ -166,6 +214,11 @@ func IntValueReflector(in ReflectorInput) (reflect.Value, error) {
 	return reflect.ValueOf(v), err
 }
 
+func FloatValueReflector(in ReflectorInput) (reflect.Value, error) {
+	v, err := in.ArgsIterator().NextFloat()
+	return reflect.ValueOf(v), err
+}
+
 func SessionValueReflector(in ReflectorInput) (reflect.Value, error) {
 	return reflect.ValueOf(in.Session()), nil
 }
@@ -209,6 +262,7 @@ func (self *ReflectRegistry) Register(name string, fn interface{}, flag int) err
 	var reflector ArgumentReflector
 	var ok bool
 	var variadicArg bool
+	var options bool
 	for i := 0; i < numIn; i++ {
 		arg := fnType.In(i)
 		variadicArg = variadic && i+1 == numIn
@@ -217,6 +271,14 @@ func (self *ReflectRegistry) Register(name string, fn interface{}, flag int) err
 		} else {
 			reflector, ok = self.args.Get(arg)
 		}
+		if !ok && !variadicArg {
+			if reflector, ok = self.args.GetOptions(arg); ok {
+				if variadic || i+1 != numIn {
+					return ErrOptionsArgPos
+				}
+				options = true
+			}
+		}
 		if !ok {
 			return ErrUnknownInArgumentType
 		}
@@ -247,6 +309,7 @@ func (self *ReflectRegistry) Register(name string, fn interface{}, flag int) err
 		args:       args,
 		valuedArgs: valuedArgs,
 		variadic:   variadic,
+		options:    options,
 		flag:       flag,
 	}
 	return nil
@@ -323,6 +386,7 @@ type reflectedCommand struct {
 	args       []ArgumentReflector
 	valuedArgs int
 	variadic   bool
+	options    bool
 	flag       int
 }
 
@@ -354,6 +418,8 @@ func (self *reflectedCommand) Execute(s session.Session, arguments Arguments) (i
 	n := self.valuedArgs
 	if self.variadic {
 		iter, err = arguments.IterAtLeast(n - 1)
+	} else if self.options {
+		iter, err = arguments.IterAtLeast(n)
 	} else {
 		iter, err = arguments.IterN(n)
 	}
@@ -104,6 +104,44 @@ func TestReflectRegistry_Register(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "ErrOptionsArgPos",
+			fields: fields{
+				args: NewArgumentsProvider(),
+			},
+			args: args{
+				name: "cmd",
+				fn:   func(s session.Session, opts *SetOptions, v core.Value) (interface{}, error) { return "", nil },
+				flag: 0,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ErrOptionsArgPosVariadic",
+			fields: fields{
+				args: NewArgumentsProvider(),
+			},
+			args: args{
+				name: "cmd",
+				fn:   func(s session.Session, opts *SetOptions, vs ...core.Value) (interface{}, error) { return "", nil },
+				flag: 0,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidOptions",
+			fields: fields{
+				opts: &ReflectRegistryOptions{},
+				args: NewArgumentsProvider(),
+				r:    MapRegistry{},
+			},
+			args: args{
+				name: "cmd",
+				fn:   func(s session.Session, v core.Value, opts *SetOptions) (interface{}, error) { return "", nil },
+				flag: 0,
+			},
+			wantErr: false,
+		},
 		{
 			name: "Valid",
 			fields: fields{
@@ -2,23 +2,36 @@ package commands
 
 import (
 	"errors"
+	"sync/atomic"
+	"time"
 
+	"github.com/auvn/go.cache/cluster"
 	"github.com/auvn/go.cache/core"
 	"github.com/auvn/go.cache/server"
 	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
 	"github.com/auvn/go.cache/util/sync"
 )
 
 var (
 	ErrCannotUpdateJournal = errors.New("cannot perform an update in the journal")
+	ErrReadOnly            = errors.New("cannot write against a read only follower")
+	ErrPushMode            = errors.New("only (P)SUBSCRIBE and (P)UNSUBSCRIBE are allowed in the push mode")
+	ErrInternalCommand     = errors.New("the command is accepted from the journal and the leader only")
 )
 
-type SuccessHook func(flag int, body [][]byte)
+// SuccessHook is called after a command succeeded with the reply of the command,
+// the response is held until the returned channel delivers or is closed, nil does
+// not hold it. An error delivered fails the command with ErrCannotUpdateJournal.
+type SuccessHook func(flag int, body [][]byte, reply interface{}) <-chan error
 
 type Handler struct {
 	registry     Registry
 	requests     chan *server.Request
+	unblocked    chan *blocked
 	successHooks []SuccessHook
+	readOnly     int32
+	cluster      *cluster.Cluster
 }
 
 func (self *Handler) lookupCommand(values []core.Value) (Command, Arguments, error) {
@@ -39,34 +52,288 @@ func (self *Handler) lookupCommand(values []core.Value) (Command, Arguments, err
 	return cmd, iter.NextArguments(), nil
 }
 
-func (self *Handler) handle(body [][]byte, s session.Session, resp chan<- interface{}) (Command, error) {
+func (self *Handler) lookupBody(body [][]byte) (Command, Arguments, error) {
 	values := make([]core.Value, len(body))
 	for i, _ := range body {
 		values[i] = body[i]
 	}
-	cmd, arguments, err := self.lookupCommand(values)
+	return self.lookupCommand(values)
+}
+
+func (self *Handler) handle(body [][]byte, s session.Session, resp chan<- interface{}) {
+	cmd, arguments, err := self.lookupBody(body)
 	if err != nil {
 		resp <- err
-		return nil, err
+		return
 	}
 	ret, err := cmd.Execute(s, arguments)
 	if err != nil {
 		resp <- err
+		return
+	}
+	if t, ok := ret.(*transaction); ok {
+		self.exec(t, s)
+		ret = t.reply()
+	} else if p, ok := ret.(*blockingPop); ok {
+		// the replayed commands are not blocked
+		ret, _, _, err = p.try(s)
+		if err != nil {
+			resp <- err
+			return
+		}
+	}
+	resp <- ret
+}
+
+// checks if the session is allowed to execute the command
+func (self *Handler) check(cmd Command, s session.Session) error {
+	if cmd.IsFlag(WFlag) && atomic.LoadInt32(&self.readOnly) != 0 && !session.IsReplication(s) {
+		return ErrReadOnly
+	}
+	// the journal is replayed without the checks
+	if cmd.IsFlag(InternalFlag) && !session.IsReplication(s) {
+		return ErrInternalCommand
+	}
+	if sub := session.Subscriber(s); sub != nil && sub.Count() > 0 && !cmd.IsFlag(PushFlag) {
+		return ErrPushMode
+	}
+	return nil
+}
+
+// queues the command of the transaction instead of executing it,
+// false if the commands are not queued
+func (self *Handler) queue(cmd Command, body [][]byte, err error, s session.Session, resp chan<- interface{}) bool {
+	tx := session.Transaction(s)
+	if tx == nil || !tx.Multi() || (err == nil && cmd.IsFlag(MultiFlag)) {
+		return false
+	}
+	if err == nil && cmd.IsFlag(SysFlag) {
+		err = ErrNotAllowedInMulti
+	}
+	if err != nil {
+		// EXEC fails, so the commands are not executed partially
+		tx.Fail()
+		resp <- err
 	} else {
-		resp <- ret
+		tx.Queue(body)
+		resp <- queuedReply
+	}
+	return true
+}
+
+// executes the commands of the transaction with all of the shards locked,
+// the commands failed are replied with the errors and do not stop the rest
+func (self *Handler) exec(t *transaction, s session.Session) {
+	s.Storage().Atomic(func(locked storage.Storage) (interface{}, error) {
+		if t.tx != nil && t.tx.Changed() {
+			return nil, nil
+		}
+		ls := session.WithStorage(s, locked)
+		if session.IsReplication(s) {
+			ls = session.WithReplication(ls)
+		}
+		t.replies = make([]interface{}, 0, len(t.bodies))
+		var written [][][]byte
+		var writtenReplies []interface{}
+		for _, body := range t.bodies {
+			cmd, arguments, err := self.lookupBody(body)
+			if err == nil {
+				err = self.check(cmd, s)
+			}
+			// the entries are not queued, so they are not checked by queue,
+			// e.g. SAVE or PSYNC would run with all of the shards locked
+			if err == nil && cmd.IsFlag(SysFlag|MultiFlag) {
+				err = ErrNotAllowedInMulti
+			}
+			var reply interface{}
+			cs := ls
+			if err == nil {
+				if self.cluster != nil {
+					cs = self.cluster.Session(ls)
+				}
+				reply, err = cmd.Execute(cs, arguments)
+			}
+			if _, ok := reply.(*transaction); ok {
+				reply, err = nil, ErrNotAllowedInMulti
+			}
+			var writes [][][]byte
+			var replies []interface{}
+			if p, ok := reply.(*blockingPop); ok {
+				// the blocking pops do not block in the transactions
+				reply, writes, replies, err = p.try(cs)
+			}
+			if err != nil {
+				t.replies = append(t.replies, err)
+				continue
+			}
+			t.replies = append(t.replies, reply)
+			if writes != nil {
+				t.flag = cmd.Flag()&^TDFlag | t.flag&TDFlag
+				written = append(written, writes...)
+				writtenReplies = append(writtenReplies, replies...)
+				continue
+			}
+			if CheckFlag(cmd.Flag(), NonJournalableFlag) {
+				continue
+			}
+			// the expiry of the whole entry is made absolute by the hooks
+			t.flag = cmd.Flag() | t.flag&TDFlag
+			written = append(written, body)
+			writtenReplies = append(writtenReplies, reply)
+		}
+		t.entry, t.written = writtenEntry(written, writtenReplies)
+		if len(written) > 1 {
+			t.flag = WFlag | t.flag&TDFlag
+		}
+		return nil, nil
+	})
+	if t.tx != nil {
+		t.tx.Unwatch()
+	}
+}
+
+// calls the success hooks, the returned channels hold the response
+func (self *Handler) succeeded(flag int, body [][]byte, reply interface{}) []<-chan error {
+	// the hooks get the same deadlines, so the journal and the followers agree on them
+	if CheckFlag(flag, TDFlag) {
+		body = absoluteExpiry(body, time.Now())
+		flag &^= TDFlag
+	}
+	var holds []<-chan error
+	for _, h := range self.successHooks {
+		if hold := h(flag, body, reply); hold != nil {
+			holds = append(holds, hold)
+		}
+	}
+	return holds
+}
+
+// replies once the success hooks release the response, the hooks are not
+// called if the hooked body is nil
+func (self *Handler) respond(flag int, hooked [][]byte, hookedReply, reply interface{}, resp chan<- interface{}) {
+	var holds []<-chan error
+	if hooked != nil {
+		holds = self.succeeded(flag, hooked, hookedReply)
+	}
+	if len(holds) == 0 {
+		resp <- reply
+		return
+	}
+	// the next commands are not held, so they may share the same hold
+	go func() {
+		for _, hold := range holds {
+			// the command is executed, but it is lost on restart
+			if err := <-hold; err != nil {
+				reply = ErrCannotUpdateJournal
+			}
+		}
+		resp <- reply
+	}()
+}
+
+// pops an element for the blocked session or parks it until a list is changed,
+// the parked sessions wait outside of the handler loop
+func (self *Handler) block(b *blocked, quit sync.Quit) {
+	if b.disconnected() {
+		b.resp <- ErrClientClosed
+		return
+	}
+	reply, writes, replies, err := b.pop.try(b.session)
+	if err != nil {
+		b.resp <- err
+		return
+	}
+	if writes != nil {
+		entry, written := writtenEntry(writes, replies)
+		self.respond(b.flag, entry, written, reply, b.resp)
+		return
+	}
+	if b.expired() {
+		b.resp <- nil
+		return
+	}
+	// watched before the next write is handled, so its elements are not missed
+	w, err := b.session.Storage().Watch(b.pop.keys...)
+	if err != nil {
+		b.resp <- err
+		return
+	}
+	go self.wait(b, w, quit)
+}
+
+// waits for a change of the lists, the pop is retried in the handler loop
+// to keep it in order with the writes
+func (self *Handler) wait(b *blocked, w *storage.Watch, quit sync.Quit) {
+	defer w.Close()
+	var timeout <-chan time.Time
+	if !b.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(b.deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.Done():
+		select {
+		case self.unblocked <- b:
+		case <-quit:
+		}
+	case <-timeout:
+		b.resp <- nil
+	case <-b.closed:
+		b.resp <- ErrClientClosed
+	case <-quit:
 	}
-	return cmd, err
 }
 
-func (self *Handler) handleRequest(req *server.Request) {
+func (self *Handler) handleRequest(req *server.Request, quit sync.Quit) {
 	body := req.Body()
 	sess := req.Session()
 	resp := req.Response()
-	cmd, err := self.handle(body, sess, resp)
+	cmd, arguments, err := self.lookupBody(body)
 	if err == nil {
-		for _, h := range self.successHooks {
-			h(cmd.Flag(), body)
+		err = self.check(cmd, sess)
+	}
+	if self.queue(cmd, body, err, sess, resp) {
+		return
+	}
+	if err != nil {
+		resp <- err
+		return
+	}
+	// the transactions wrap the sessions of their commands
+	base := sess
+	if self.cluster != nil {
+		// wrapped in order with the other commands of the connection, e.g. ASKING
+		sess = self.cluster.Session(sess)
+	}
+	run := func() {
+		reply, err := cmd.Execute(sess, arguments)
+		if err != nil {
+			resp <- err
+			return
+		}
+		if p, ok := reply.(*blockingPop); ok {
+			b := &blocked{pop: p, session: sess, resp: resp, flag: cmd.Flag(), closed: session.Closed(base)}
+			if p.timeout > 0 {
+				b.deadline = time.Now().Add(p.timeout)
+			}
+			self.block(b, quit)
+			return
 		}
+		flag, hooked, hookedReply := cmd.Flag(), body, reply
+		if t, ok := reply.(*transaction); ok {
+			self.exec(t, base)
+			reply = t.reply()
+			flag, hooked, hookedReply = t.flag, t.entry, t.written
+		}
+		self.respond(flag, hooked, hookedReply, reply, resp)
+	}
+	if cmd.IsFlag(RFlag) {
+		// reads do not change the storage and lock only the shards of their
+		// keys, so there is no need to keep them in order with the writes
+		go run()
+	} else {
+		run()
 	}
 }
 
@@ -76,7 +343,9 @@ func (self *Handler) loopRequests(quit sync.Quit) {
 		case <-quit:
 			return
 		case req := <-self.requests:
-			self.handleRequest(req)
+			self.handleRequest(req, quit)
+		case b := <-self.unblocked:
+			self.block(b, quit)
 		}
 	}
 }
@@ -94,6 +363,20 @@ func (self *Handler) HandleRequest(req *server.Request) {
 	self.requests <- req
 }
 
+// SetReadOnly rejects the writes except the ones of the replication session.
+func (self *Handler) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&self.readOnly, v)
+}
+
+// SetCluster limits the keys of the commands to the slots served by the node.
+func (self *Handler) SetCluster(c *cluster.Cluster) {
+	self.cluster = c
+}
+
 func (self *Handler) AddSuccessHook(fn SuccessHook) {
 	self.successHooks = append(self.successHooks, fn)
 }
@@ -102,6 +385,7 @@ func NewHandler(registry Registry) *Handler {
 	return &Handler{
 		registry:     registry,
 		requests:     make(chan *server.Request, 100),
+		unblocked:    make(chan *blocked),
 		successHooks: make([]SuccessHook, 0, 10),
 	}
 }
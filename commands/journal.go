@@ -1,64 +1,409 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	gosync "sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/auvn/go.cache/journal"
+	"github.com/auvn/go.cache/server"
 	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
 	"github.com/auvn/go.cache/util/sync"
 )
 
+const (
+	// the first entry of a rewritten journal, it is not replayed
+	journalIDEntry = "JOURNALID"
+
+	rewriteCommand = "BGREWRITEJOURNAL"
+
+	FsyncAlways   FsyncPolicy = "always"   // before replying to the command
+	FsyncEverySec FsyncPolicy = "everysec" // once a second
+	FsyncNo       FsyncPolicy = "no"       // left to the OS
+
+	// max number of the journal entries written with a single sync
+	maxGroupCommit = 1000
+)
+
 var (
 	_ (sync.Server) = (*JournalAdapter)(nil)
 
-	NonJournalableFlag = (TDFlag | RFlag)
+	NonJournalableFlag = (RFlag | SysFlag)
+
+	ErrRewriteInProgress  = errors.New("journal rewrite is already in progress")
+	ErrRewriteUnsupported = errors.New("journal file is not configured")
+	ErrUnknownFsyncPolicy = errors.New("unknown fsync policy")
+	// the entries counted by the snapshot are lost, e.g. the tail not synced
+	// before a crash, and the journal cannot be rewritten without its file
+	ErrJournalBehindSnapshot = errors.New("journal has fewer entries than the snapshot expects")
+
+	DefaultJournalAdapterOptions = &JournalAdapterOptions{
+		RewritePercentage: 100,
+		RewriteMinSize:    64 << 20,
+		Fsync:             FsyncEverySec,
+	}
 )
 
+// FsyncPolicy defines when the journal entries are flushed to the disk.
+type FsyncPolicy string
+
+func LookupFsyncPolicy(name string) (FsyncPolicy, error) {
+	switch policy := FsyncPolicy(name); policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return policy, nil
+	}
+	return "", ErrUnknownFsyncPolicy
+}
+
+type JournalAdapterOptions struct {
+	Path string // the journal file, the journal cannot be rewritten without it
+	// the journal is rewritten once it grows by the percentage since the last rewrite,
+	// zero disables the automatic rewrite
+	RewritePercentage int
+	RewriteMinSize    int64
+	Fsync             FsyncPolicy
+}
+
 type journalCmd struct {
 	flag int
 	body [][]byte
+	// the dataset to rewrite the journal with, and the number of
+	// the journal entries it contains
+	rewrite        [][][]byte
+	rewriteEntries uint64
+	// delivers the error of the write once the entry is on the disk, FsyncAlways only
+	synced chan error
+	err    error
 }
 
-type JournalAdapter struct {
-	cmds    chan *journalCmd
+type rewriteResult struct {
 	journal journal.Journal
-	session session.Session
+	id      uint64
+	entries uint64 // the number of the journal entries the dataset replaces
+	dataset uint64 // the number of the entries in the dataset
+	err     error
+}
+
+type JournalAdapter struct {
+	cmds     chan *journalCmd
+	journal  journal.Journal
+	session  session.Session
+	opts     *JournalAdapterOptions
+	handler  *Handler
+	rewrites chan *rewriteResult
+
+	// the journal id and the number of its entries applied to the storage
+	position gosync.Mutex
+	id       uint64
+	entries  uint64
+
+	// the entries written since the last sync
+	dirty  bool
+	synced []*journalCmd
+
+	rewriting int32
+	triggered int32
+	// the entries written since the rewrite started, nil if there is no rewrite
+	buffer   [][][]byte
+	baseSize int64
+	// the first entry read while opening the journal
+	pending    [][]byte
+	pendingErr error
+}
+
+// called in the order the commands are executed, so the journal keeps the same order
+func (self *JournalAdapter) successCommand(flag int, body [][]byte, reply interface{}) <-chan error {
+	if CheckFlag(flag, NonJournalableFlag) {
+		return nil
+	}
+	self.position.Lock()
+	self.entries += 1
+	self.position.Unlock()
+	cmd := &journalCmd{flag: flag, body: body}
+	if self.opts.Fsync == FsyncAlways {
+		cmd.synced = make(chan error, 1)
+	}
+	self.cmds <- cmd
+	return cmd.synced
+}
+
+// Position is the journal id and the number of its entries applied to the storage.
+func (self *JournalAdapter) Position() (uint64, uint64) {
+	self.position.Lock()
+	defer self.position.Unlock()
+	return self.id, self.entries
+}
+
+func (self *JournalAdapter) write(body [][]byte) error {
+	if err := self.journal.Write(body); err != nil {
+		log.Println("cannot write to journal:", err)
+		if err := self.journal.Rollback(); err != nil {
+			log.Println("cannot rollback the journal:", err)
+		}
+		return err
+	}
+	self.dirty = true
+	if err := self.journal.Commit(); err != nil {
+		log.Println("cannot commit the journal:", err)
+		return err
+	}
+	return nil
+}
+
+// flushes the written entries and releases the commands waiting for them
+func (self *JournalAdapter) sync() {
+	var err error
+	if self.dirty {
+		if err = self.journal.Sync(); err != nil {
+			log.Println("cannot sync the journal:", err)
+		}
+		self.dirty = false
+	}
+	for _, cmd := range self.synced {
+		if cmd.err == nil {
+			cmd.err = err
+		}
+		cmd.synced <- cmd.err
+		close(cmd.synced)
+	}
+	self.synced = self.synced[:0]
+}
+
+func (self *JournalAdapter) tmpPath() string {
+	return self.opts.Path + ".rewrite"
+}
+
+// the new id of the rewritten journal preceding the dataset, the snapshots
+// of the previous journal do not match it
+func withJournalID(dataset [][][]byte) (uint64, [][][]byte) {
+	id := uint64(time.Now().UnixNano())
+	return id, append([][][]byte{{[]byte(journalIDEntry), []byte(fmt.Sprint(id))}}, dataset...)
+}
+
+func (self *JournalAdapter) startRewrite(cmd *journalCmd) {
+	self.buffer = make([][][]byte, 0)
+	id, dataset := withJournalID(cmd.rewrite)
+	go func() {
+		j, err := journal.CreateFile(self.tmpPath(), dataset)
+		self.rewrites <- &rewriteResult{
+			journal: j,
+			id:      id,
+			entries: cmd.rewriteEntries,
+			dataset: uint64(len(cmd.rewrite)),
+			err:     err,
+		}
+	}()
+}
+
+func (self *JournalAdapter) finishRewrite(res *rewriteResult) {
+	defer atomic.StoreInt32(&self.rewriting, 0)
+	buffer := self.buffer
+	self.buffer = nil
+
+	err := res.err
+	if err == nil {
+		for _, body := range buffer {
+			if err = res.journal.Write(body); err != nil {
+				break
+			}
+			if err = res.journal.Commit(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = res.journal.Sync()
+	}
+	if err == nil {
+		err = os.Rename(self.tmpPath(), self.opts.Path)
+	}
+	if err != nil {
+		log.Println("cannot rewrite the journal:", err)
+		if res.journal != nil {
+			res.journal.Close()
+		}
+		os.Remove(self.tmpPath())
+		return
+	}
+
+	// the buffered entries are synced with the new journal
+	self.dirty = false
+	self.journal.Close()
+	self.journal = res.journal
+	self.baseSize = res.journal.Size()
+
+	self.position.Lock()
+	// the entries executed after the rewrite started are kept
+	self.entries = self.entries - res.entries + res.dataset
+	self.id = res.id
+	self.position.Unlock()
+	log.Println("journal rewritten, size:", self.baseSize)
 }
 
-func (self *JournalAdapter) successCommand(flag int, body [][]byte) {
-	go func() { self.cmds <- &journalCmd{flag: flag, body: body} }()
+func (self *JournalAdapter) rewriteNeeded() bool {
+	if self.opts.RewritePercentage <= 0 || self.opts.Path == "" || self.handler == nil {
+		return false
+	}
+	if atomic.LoadInt32(&self.rewriting) != 0 {
+		return false
+	}
+	size := self.journal.Size()
+	return size >= self.opts.RewriteMinSize &&
+		size >= self.baseSize+self.baseSize*int64(self.opts.RewritePercentage)/100
+}
+
+// the rewrite is started by the handler to take the dataset in order with the writes,
+// the reply is not waited for once the adapter is stopped
+func (self *JournalAdapter) triggerRewrite(quit sync.Quit) {
+	if !atomic.CompareAndSwapInt32(&self.triggered, 0, 1) {
+		return
+	}
+	req := server.NewRequest([][]byte{[]byte(rewriteCommand)}, self.session)
+	go func() {
+		defer atomic.StoreInt32(&self.triggered, 0)
+		self.handler.HandleRequest(req)
+		if _, err := req.Get(quit); err == server.ErrQuit {
+			return
+		} else if err != nil {
+			log.Println("cannot start the journal rewrite:", err)
+		}
+	}()
+}
+
+func (self *JournalAdapter) handleCmd(cmd *journalCmd) {
+	if cmd.rewrite != nil {
+		self.startRewrite(cmd)
+		return
+	}
+	cmd.err = self.write(cmd.body)
+	if cmd.synced != nil {
+		self.synced = append(self.synced, cmd)
+	}
+	if self.buffer != nil {
+		self.buffer = append(self.buffer, cmd.body)
+	}
+}
+
+// writes the commands queued meanwhile, so they share a single sync
+func (self *JournalAdapter) handleCmds(cmd *journalCmd) {
+	self.handleCmd(cmd)
+	for i := 1; i < maxGroupCommit; i++ {
+		select {
+		case cmd := <-self.cmds:
+			self.handleCmd(cmd)
+		default:
+			return
+		}
+	}
 }
 
 func (self *JournalAdapter) loopCommands(quit sync.Quit) {
+	var tick <-chan time.Time
+	if self.opts.Fsync == FsyncEverySec {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	defer self.sync()
 	for {
 		select {
 		case <-quit:
 			return
 		case cmd := <-self.cmds:
-			if !CheckFlag(cmd.flag, NonJournalableFlag) {
-				if err := self.journal.Write(cmd.body); err != nil {
-					log.Println("cannot write to journal:", err)
-				}
-				if err := self.journal.Commit(); err != nil {
-					log.Println("cannot commit the journal:", err)
-				}
+			self.handleCmds(cmd)
+			if self.opts.Fsync == FsyncAlways {
+				self.sync()
+			}
+			if self.buffer == nil && self.rewriteNeeded() {
+				self.triggerRewrite(quit)
 			}
+		case <-tick:
+			self.sync()
+		case res := <-self.rewrites:
+			self.finishRewrite(res)
 		}
 	}
 }
 
-func (self *JournalAdapter) Restore(h *Handler) error {
+// Rewrite replaces the journal with the minimal set of commands reproducing
+// the storage, must be called in order with the writes.
+func (self *JournalAdapter) Rewrite(s storage.Storage) error {
+	if self.opts.Path == "" {
+		return ErrRewriteUnsupported
+	}
+	if !atomic.CompareAndSwapInt32(&self.rewriting, 0, 1) {
+		return ErrRewriteInProgress
+	}
+	dataset, err := s.Read(func(r storage.Reader) (interface{}, error) {
+		return DumpCommands(r)
+	})
+	if err != nil {
+		atomic.StoreInt32(&self.rewriting, 0)
+		return err
+	}
+	_, entries := self.Position()
+	self.cmds <- &journalCmd{rewrite: dataset.([][][]byte), rewriteEntries: entries}
+	return nil
+}
+
+// Open reads the id of the journal, it is called before Restore.
+func (self *JournalAdapter) Open() (uint64, error) {
+	entry, err := self.journal.NextEntry()
+	if err != nil {
+		self.pendingErr = err
+		if err == journal.ErrEmpty {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(entry) == 2 && string(entry[0]) == journalIDEntry {
+		if _, err := fmt.Sscan(string(entry[1]), &self.id); err != nil {
+			return 0, fmt.Errorf("invalid journal id: %s", err.Error())
+		}
+	} else {
+		self.pending = entry
+	}
+	return self.id, nil
+}
+
+func (self *JournalAdapter) nextEntry() ([][]byte, error) {
+	if entry := self.pending; entry != nil {
+		self.pending = nil
+		return entry, nil
+	}
+	if err := self.pendingErr; err != nil {
+		return nil, err
+	}
+	return self.journal.NextEntry()
+}
+
+// Restore replays the journal, skipping the entries which are already in the storage,
+// e.g. restored from a snapshot.
+func (self *JournalAdapter) Restore(h *Handler, skip uint64) error {
 	resp := make(chan interface{}, 1)
+	defer func() { self.baseSize = self.journal.Size() }()
 	for {
-		entry, err := self.journal.NextEntry()
+		entry, err := self.nextEntry()
 		if err != nil {
 			if err == journal.ErrEmpty {
+				if self.entries < skip {
+					log.Printf("the journal has %d entries, but %d are expected, rewriting it", self.entries, skip)
+					return self.rewriteRestored()
+				}
 				return nil
 			} else {
 				return err
 			}
 		} else {
+			self.entries += 1
+			if self.entries <= skip {
+				continue
+			}
 			h.Handle(self.session, entry, resp)
 			select {
 			case ret := <-resp:
@@ -70,19 +415,77 @@ func (self *JournalAdapter) Restore(h *Handler) error {
 	}
 }
 
+// replaces the journal behind the snapshot with the restored keys, otherwise the next
+// writes would be skipped on the next start as the entries counted by the snapshot
+func (self *JournalAdapter) rewriteRestored() error {
+	if self.opts.Path == "" {
+		return ErrJournalBehindSnapshot
+	}
+	dataset, err := self.session.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		return DumpCommands(r)
+	})
+	if err != nil {
+		return err
+	}
+	id, entries := withJournalID(dataset.([][][]byte))
+	j, err := journal.CreateFile(self.tmpPath(), entries)
+	if err == nil {
+		if err = os.Rename(self.tmpPath(), self.opts.Path); err != nil {
+			j.Close()
+		}
+	}
+	if err != nil {
+		os.Remove(self.tmpPath())
+		return err
+	}
+	self.journal.Close()
+	self.journal = j
+
+	self.position.Lock()
+	self.id = id
+	self.entries = uint64(len(entries) - 1)
+	self.position.Unlock()
+	return nil
+}
+
 func (self *JournalAdapter) Serve(quit sync.Quit) error {
 	self.loopCommands(quit)
 	return nil
 }
 
 func (self *JournalAdapter) AttachTo(h *Handler) {
+	self.handler = h
 	h.AddSuccessHook(self.successCommand)
 }
 
-func NewJournalAdapter(journal journal.Journal, s session.Session) *JournalAdapter {
+func NewJournalAdapter(journal journal.Journal, s session.Session, opts *JournalAdapterOptions) *JournalAdapter {
+	if opts == nil {
+		opts = DefaultJournalAdapterOptions
+	}
 	return &JournalAdapter{
-		cmds:    make(chan *journalCmd, 1000),
-		journal: journal,
-		session: s,
+		cmds:     make(chan *journalCmd, 1000),
+		rewrites: make(chan *rewriteResult, 1),
+		journal:  journal,
+		session:  s,
+		opts:     opts,
+	}
+}
+
+type JournalCommand struct {
+	journal *JournalAdapter
+}
+
+func (self *JournalCommand) Rewrite(s session.Session) (interface{}, error) {
+	if self.journal == nil {
+		return nil, ErrRewriteUnsupported
 	}
+	if err := self.journal.Rewrite(s.Storage()); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// journal is nil if the journal is disabled
+func NewJournalCommand(journal *JournalAdapter) *JournalCommand {
+	return &JournalCommand{journal: journal}
 }
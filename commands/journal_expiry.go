@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+// milliseconds of the ttl, saturated instead of overflowing
+func ttlMillis(ttl core.Value, unit int64) (int64, bool) {
+	i, err := ttl.Int()
+	if err != nil {
+		return 0, false
+	}
+	v := int64(i)
+	switch {
+	case v < 0:
+		return 0, true
+	case v > math.MaxInt64/unit:
+		return math.MaxInt64, true
+	}
+	return v * unit, true
+}
+
+func deadlineMillis(now time.Time, ttl int64) []byte {
+	ms := now.UnixNano() / int64(time.Millisecond)
+	if ttl > math.MaxInt64-ms {
+		ttl = math.MaxInt64 - ms
+	}
+	return []byte(strconv.FormatInt(ms+ttl, 10))
+}
+
+// EXPIRE/PEXPIRE key ttl -> PEXPIREAT key deadline
+func absoluteExpire(body [][]byte, now time.Time, unit int64) [][]byte {
+	if len(body) != 3 {
+		return body
+	}
+	ttl, ok := ttlMillis(body[2], unit)
+	if !ok {
+		return body
+	}
+	return [][]byte{[]byte("PEXPIREAT"), body[1], deadlineMillis(now, ttl)}
+}
+
+// HEXPIRE key ttl hashKey ... -> HPEXPIREAT key deadline hashKey ...
+func absoluteHashExpire(body [][]byte, now time.Time) [][]byte {
+	if len(body) < 4 {
+		return body
+	}
+	ttl, ok := ttlMillis(body[2], 1000)
+	if !ok {
+		return body
+	}
+	entry := [][]byte{[]byte("HPEXPIREAT"), body[1], deadlineMillis(now, ttl)}
+	return append(entry, body[3:]...)
+}
+
+// SET key value ... EX/PX ttl ... -> SET key value ... PXAT deadline ...
+func absoluteSet(body [][]byte, now time.Time) [][]byte {
+	entry := make([][]byte, len(body))
+	copy(entry, body)
+	for i := 3; i < len(entry)-1; i++ {
+		var unit int64
+		switch strings.ToUpper(string(entry[i])) {
+		case "EX":
+			unit = 1000
+		case "PX":
+			unit = 1
+		default:
+			continue
+		}
+		ttl, ok := ttlMillis(entry[i+1], unit)
+		if !ok {
+			return body
+		}
+		entry[i] = []byte("PXAT")
+		entry[i+1] = deadlineMillis(now, ttl)
+		break
+	}
+	return entry
+}
+
+// absoluteExpiry turns the relative TTL of a command into the absolute deadline,
+// so the replay of the journal does not prolong TTLs.
+func absoluteExpiry(body [][]byte, now time.Time) [][]byte {
+	if len(body) == 0 {
+		return body
+	}
+	if isTransaction(body) {
+		bodies, err := decodeTransaction(body)
+		if err != nil {
+			return body
+		}
+		for i := range bodies {
+			bodies[i] = absoluteExpiry(bodies[i], now)
+		}
+		return encodeTransaction(bodies)
+	}
+	switch strings.ToUpper(string(body[0])) {
+	case "EXPIRE":
+		return absoluteExpire(body, now, 1000)
+	case "PEXPIRE":
+		return absoluteExpire(body, now, 1)
+	case "SET":
+		return absoluteSet(body, now)
+	case "HEXPIRE":
+		return absoluteHashExpire(body, now)
+	}
+	return body
+}
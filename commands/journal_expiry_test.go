@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+)
+
+func Test_absoluteExpiry(t *testing.T) {
+	now := time.Unix(1000, 500*int64(time.Millisecond))
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"EXPIRE k 10", "PEXPIREAT k 1010500"},
+		{"expire k -5", "PEXPIREAT k 1000500"},
+		{"EXPIRE k 9223372036854775807", "PEXPIREAT k 9223372036854775807"},
+		{"PEXPIRE k 250", "PEXPIREAT k 1000750"},
+		{"SET k v", "SET k v"},
+		{"SET k v NX ex 10 GET", "SET k v NX PXAT 1010500 GET"},
+		{"SET k v PX 100", "SET k v PXAT 1000600"},
+		{"SET k EX", "SET k EX"},
+		{"EXPIREAT k 10", "EXPIREAT k 10"},
+		{"HEXPIRE k 10 a b", "HPEXPIREAT k 1010500 a b"},
+		{"HEXPIRE k 10", "HEXPIRE k 10"},
+		{"TRANSACTION 3 EXPIRE k 10 2 DEL k", "TRANSACTION 3 PEXPIREAT k 1010500 2 DEL k"},
+		{"TRANSACTION 3 EXPIRE k", "TRANSACTION 3 EXPIRE k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var body [][]byte
+			for _, arg := range strings.Split(tt.body, " ") {
+				body = append(body, []byte(arg))
+			}
+			got := absoluteExpiry(body, now)
+			var args []string
+			for _, arg := range got {
+				args = append(args, string(arg))
+			}
+			if strings.Join(args, " ") != tt.want {
+				t.Errorf("absoluteExpiry() = %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
+
+func Test_absoluteExpiry_Replay(t *testing.T) {
+	h, s := newTestHandler()
+	past := time.Now().Add(-time.Hour)
+	execute(t, h, s, "SET", "expired", "v", "EX", "10")
+	execute(t, h, s, "SET", "alive", "v", "EX", "10")
+	execute(t, h, s, "SET", "set", "v", "PX", "100")
+	execute(t, h, s, "HMSET", "hash", "expired", "v", "alive", "v")
+
+	replay := func(body ...string) {
+		entry := make([][]byte, len(body))
+		for i, arg := range body {
+			entry[i] = []byte(arg)
+		}
+		entry = absoluteExpiry(entry, past)
+		args := make([]string, len(entry))
+		for i, arg := range entry {
+			args[i] = string(arg)
+		}
+		execute(t, h, s, args...)
+	}
+	replay("EXPIRE", "expired", "10")
+	replay("SET", "set", "v", "PX", "100")
+	replay("EXPIRE", "missing", "10")
+	replay("HEXPIRE", "hash", "10", "expired")
+
+	for key, want := range map[string]interface{}{
+		"expired": nil,
+		"set":     nil,
+		"alive":   core.Value("v"),
+	} {
+		if got := execute(t, h, s, "GET", key); !reflect.DeepEqual(got, want) {
+			t.Errorf("GET %s = %v, want %v", key, got, want)
+		}
+	}
+	want := []interface{}{nil, core.Value("v")}
+	if got := execute(t, h, s, "HMGET", "hash", "expired", "alive"); !reflect.DeepEqual(got, want) {
+		t.Errorf("HMGET = %v, want %v", got, want)
+	}
+}
+
+func Test_absoluteExpiry_Hooks(t *testing.T) {
+	h, base := newTestHandler()
+	var entries [2][]string
+	for i := range entries {
+		i := i
+		h.AddSuccessHook(func(flag int, body [][]byte, reply interface{}) <-chan error {
+			if CheckFlag(flag, TDFlag) {
+				t.Errorf("hook flag %b has TDFlag", flag)
+			}
+			if CheckFlag(flag, NonJournalableFlag) {
+				return nil
+			}
+			if !isTransaction(body) {
+				entries[i] = append(entries[i], string(body[0]))
+				return nil
+			}
+			bodies, _ := decodeTransaction(body)
+			for _, b := range bodies {
+				entries[i] = append(entries[i], string(b[0]))
+			}
+			return nil
+		})
+	}
+	serveHandler(t, h)
+	s := session.WithAuth(base)
+
+	mustRequest(t, h, s, "SET", "a", "1", "EX", "10")
+	mustRequest(t, h, s, "MULTI")
+	mustRequest(t, h, s, "EXPIRE", "a", "10")
+	mustRequest(t, h, s, "HSET", "h", "k", "v")
+	mustRequest(t, h, s, "HEXPIRE", "h", "10", "k")
+	mustRequest(t, h, s, "EXEC")
+
+	want := []string{"SET", "PEXPIREAT", "HSET", "HPEXPIREAT"}
+	for _, got := range entries {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("hook entries = %v, want %v", got, want)
+		}
+	}
+}
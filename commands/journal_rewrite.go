@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/storage"
+	"github.com/auvn/go.cache/types"
+)
+
+const (
+	// max number of items added by a single command of the rewritten journal
+	rewriteBatchSize = 64
+)
+
+type commandsDump struct {
+	entries [][][]byte
+}
+
+func (self *commandsDump) add(args ...[]byte) {
+	self.entries = append(self.entries, args)
+}
+
+// adds the items in batches, the prefix is repeated in every command
+func (self *commandsDump) addBatches(prefix [][]byte, items [][]byte, itemSize int) {
+	step := rewriteBatchSize * itemSize
+	for start := 0; start < len(items); start += step {
+		end := start + step
+		if end > len(items) {
+			end = len(items)
+		}
+		entry := make([][]byte, 0, len(prefix)+end-start)
+		entry = append(entry, prefix...)
+		entry = append(entry, items[start:end]...)
+		self.entries = append(self.entries, entry)
+	}
+}
+
+func (self *commandsDump) addValue(key core.StrValue, v interface{}) error {
+	k := []byte(key)
+	switch value := v.(type) {
+	case types.String:
+		self.add([]byte("SET"), k, value.Get())
+	case types.List:
+		values := value.Range(0, -1)
+		// pushing to the head from the tail of the list keeps the order
+		items := make([][]byte, len(values))
+		for i, item := range values {
+			items[len(values)-1-i] = item
+		}
+		self.addBatches([][]byte{[]byte("LPUSH"), k}, items, 1)
+	case types.Hash:
+		for _, hashKey := range value.Keys() {
+			hashValue, _ := value.Get(hashKey)
+			self.add([]byte("HSET"), k, []byte(hashKey), hashValue)
+			if deadline := value.Deadline(hashKey); !deadline.IsZero() {
+				self.add([]byte("HPEXPIREAT"), k, millis(deadline), []byte(hashKey))
+			}
+		}
+	case types.Set:
+		members := value.Members()
+		items := make([][]byte, len(members))
+		for i, m := range members {
+			items[i] = []byte(m)
+		}
+		self.addBatches([][]byte{[]byte("SADD"), k}, items, 1)
+	case types.SortedSet:
+		sortedItems := value.Range(0, -1)
+		items := make([][]byte, 0, 2*len(sortedItems))
+		for _, item := range sortedItems {
+			items = append(items, []byte(item.Score.String()), []byte(item.Member))
+		}
+		self.addBatches([][]byte{[]byte("ZADD"), k}, items, 2)
+	default:
+		return ErrWrongType
+	}
+	return nil
+}
+
+// the unix time of the deadline in milliseconds, UnixNano overflows after 2262
+func millis(deadline time.Time) []byte {
+	ms := deadline.Unix()*1000 + int64(deadline.Nanosecond())/int64(time.Millisecond)
+	return []byte(strconv.FormatInt(ms, 10))
+}
+
+func (self *commandsDump) addDeadline(key core.StrValue, deadline time.Time) {
+	self.add([]byte("PEXPIREAT"), []byte(key), millis(deadline))
+}
+
+// DumpCommands generates the minimal set of commands reproducing the storage,
+// the reader should hold all of the shards.
+func DumpCommands(r storage.Reader) ([][][]byte, error) {
+	dump := new(commandsDump)
+	var err error
+	r.Scan(func(key core.StrValue, v interface{}, deadline time.Time) {
+		if err != nil {
+			return
+		}
+		if err = dump.addValue(key, v); err == nil && !deadline.IsZero() {
+			dump.addDeadline(key, deadline)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dump.entries, nil
+}
+
+// DumpKey generates the commands reproducing the key, the reader should hold
+// the shard of the key.
+func DumpKey(r storage.Reader, key core.StrValue) ([][][]byte, error) {
+	v, ok := r.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	dump := new(commandsDump)
+	if err := dump.addValue(key, v); err != nil {
+		return nil, err
+	}
+	if pttl := r.PTTL(key); pttl >= 0 {
+		dump.addDeadline(key, r.TimeNow().Add(time.Duration(pttl)*time.Millisecond))
+	}
+	return dump.entries, nil
+}
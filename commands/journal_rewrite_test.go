@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+)
+
+func newTestHandler() (*Handler, session.Session) {
+	handler := NewHandler(InitReflectRegistry(new(RegistryOptions)))
+	return handler, session.WithStorage(session.New(), storage.New(nil))
+}
+
+func execute(t *testing.T, h *Handler, s session.Session, args ...string) interface{} {
+	body := make([][]byte, len(args))
+	for i, a := range args {
+		body[i] = []byte(a)
+	}
+	resp := make(chan interface{}, 1)
+	h.Handle(s, body, resp)
+	ret := <-resp
+	if err, ok := ret.(error); ok {
+		t.Fatalf("%v error = %v", args, err)
+	}
+	return ret
+}
+
+// the state of the keys in a comparable form
+func dumpState(t *testing.T, s session.Session) []string {
+	ret, _ := s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		return DumpCommands(r)
+	})
+	state := make([]string, 0)
+	for _, entry := range ret.([][][]byte) {
+		// batches of set members are not ordered
+		items := make([]string, len(entry))
+		for i, item := range entry {
+			items[i] = string(item)
+		}
+		sort.Strings(items[2:])
+		state = append(state, strings.Join(items, " "))
+	}
+	sort.Strings(state)
+	return state
+}
+
+func Test_DumpCommands(t *testing.T) {
+	h, s := newTestHandler()
+	execute(t, h, s, "SET", "string", "value")
+	execute(t, h, s, "PEXPIREAT", "string", "4102444800000")
+	execute(t, h, s, "LPUSH", "list", "c", "b", "a")
+	execute(t, h, s, "LPOP", "list")
+	execute(t, h, s, "HSET", "hash", "field", "value")
+	execute(t, h, s, "HSET", "hash", "other", "value")
+	execute(t, h, s, "HPEXPIREAT", "hash", "4102444800000", "field")
+	execute(t, h, s, "SADD", "set", "a", "b")
+	execute(t, h, s, "ZADD", "zset", "1.5", "one", "-2", "two")
+	for i := 0; i < rewriteBatchSize+1; i++ {
+		execute(t, h, s, "LPUSH", "long", string(rune('a'+i%26)))
+	}
+
+	restoredHandler, restored := newTestHandler()
+	ret, _ := s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		return DumpCommands(r)
+	})
+	for _, entry := range ret.([][][]byte) {
+		args := make([]string, len(entry))
+		for i, item := range entry {
+			args[i] = string(item)
+		}
+		execute(t, restoredHandler, restored, args...)
+	}
+
+	if got, want := dumpState(t, restored), dumpState(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("DumpCommands() restored = %v, want %v", got, want)
+	}
+	if got := execute(t, restoredHandler, restored, "LRANGE", "list", "0", "-1"); !reflect.DeepEqual(got, execute(t, h, s, "LRANGE", "list", "0", "-1")) {
+		t.Errorf("DumpCommands() restored list = %v", got)
+	}
+}
+
+func Test_DumpCommands_FarDeadline(t *testing.T) {
+	h, s := newTestHandler()
+	execute(t, h, s, "SET", "k", "v")
+	// the deadline in nanoseconds overflows
+	execute(t, h, s, "EXPIREAT", "k", "10000000000")
+	ret, _ := s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		return DumpCommands(r)
+	})
+	entries := ret.([][][]byte)
+	if got := string(entries[len(entries)-1][2]); got != "10000000000000" {
+		t.Errorf("DumpCommands() deadline = %v, want 10000000000000", got)
+	}
+
+	for _, args := range [][]string{
+		{"EXPIREAT", "k", "9223372036854775807"},
+		{"PEXPIREAT", "k", "9223372036854775807"},
+		{"SET", "k", "v", "EXAT", "9223372036854775807"},
+	} {
+		resp := make(chan interface{}, 1)
+		body := make([][]byte, len(args))
+		for i, a := range args {
+			body[i] = []byte(a)
+		}
+		h.Handle(s, body, resp)
+		if err := <-resp; err != ErrInvalidExpireTime {
+			t.Errorf("%v error = %v, want %v", args, err, ErrInvalidExpireTime)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/journal"
+	"github.com/auvn/go.cache/util/sync"
+)
+
+type memoryJournal struct {
+	entries []string
+	syncs   int
+	synced  int // number of the entries on the "disk"
+	err     error
+}
+
+func (self *memoryJournal) NextEntry() ([][]byte, error) { return nil, journal.ErrEmpty }
+func (self *memoryJournal) Rollback() error              { return nil }
+func (self *memoryJournal) Commit() error                { return nil }
+func (self *memoryJournal) Size() int64                  { return int64(len(self.entries)) }
+func (self *memoryJournal) Close() error                 { return nil }
+
+func (self *memoryJournal) Write(e [][]byte) error {
+	self.entries = append(self.entries, string(e[0]))
+	return nil
+}
+
+func (self *memoryJournal) Sync() error {
+	if self.err != nil {
+		return self.err
+	}
+	self.syncs += 1
+	self.synced = len(self.entries)
+	return nil
+}
+
+func Test_JournalAdapter_GroupCommit(t *testing.T) {
+	j := new(memoryJournal)
+	adapter := NewJournalAdapter(j, nil, &JournalAdapterOptions{Fsync: FsyncAlways})
+
+	var holds []<-chan error
+	for i := 0; i < 10; i++ {
+		holds = append(holds, adapter.successCommand(WFlag, [][]byte{[]byte(fmt.Sprint(i))}, true))
+	}
+	if hold := adapter.successCommand(RFlag, [][]byte{[]byte("GET")}, nil); hold != nil {
+		t.Errorf("successCommand() holds a read")
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		adapter.Serve(sync.Quit(quit))
+		close(done)
+	}()
+	for _, hold := range holds {
+		select {
+		case err := <-hold:
+			if err != nil {
+				t.Fatalf("successCommand() hold error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("successCommand() hold is not released")
+		}
+	}
+	close(quit)
+	<-done
+
+	for i, entry := range j.entries {
+		if entry != fmt.Sprint(i) {
+			t.Fatalf("journal entries = %v, want in order", j.entries)
+		}
+	}
+	if len(j.entries) != 10 || j.synced != 10 {
+		t.Errorf("journal entries = %d, synced = %d, want 10", len(j.entries), j.synced)
+	}
+	if j.syncs != 1 {
+		t.Errorf("journal syncs = %d, want 1", j.syncs)
+	}
+}
+
+func Test_JournalAdapter_SyncError(t *testing.T) {
+	j := &memoryJournal{err: errors.New("disk is full")}
+	h, s := newTestHandler()
+	adapter := NewJournalAdapter(j, s, &JournalAdapterOptions{Fsync: FsyncAlways})
+	adapter.AttachTo(h)
+	quit := make(chan struct{})
+	defer close(quit)
+	go adapter.Serve(sync.Quit(quit))
+	serveHandler(t, h)
+
+	if _, err := request(h, s, "SET", "a", "1"); err != ErrCannotUpdateJournal {
+		t.Errorf("SET error = %v, want %v", err, ErrCannotUpdateJournal)
+	}
+	// the reads are not held
+	if _, err := request(h, s, "GET", "a"); err != nil {
+		t.Errorf("GET error = %v", err)
+	}
+}
+
+func Test_JournalAdapter_TriggerRewriteQuit(t *testing.T) {
+	h, s := newTestHandler()
+	adapter := NewJournalAdapter(new(memoryJournal), s, nil)
+	adapter.AttachTo(h)
+	// the handler is not served, so the rewrite is never replied
+	quit := make(chan struct{})
+	adapter.triggerRewrite(sync.Quit(quit))
+	close(quit)
+	for i := 0; atomic.LoadInt32(&adapter.triggered) != 0; i++ {
+		if i == 100 {
+			t.Fatal("triggerRewrite() waits for the reply after quit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_JournalAdapter_RestoreBehindSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	// the snapshot counts 3 entries, but only 1 of them reached the journal
+	j, err := journal.CreateFile(path, [][][]byte{
+		{[]byte(journalIDEntry), []byte("1")},
+		{[]byte("SET"), []byte("a"), []byte("1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	h, s := newTestHandler()
+	execute(t, h, s, "SET", "a", "1")
+	execute(t, h, s, "SET", "b", "2")
+
+	if j, err = journal.InitFile(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	adapter := NewJournalAdapter(j, s, &JournalAdapterOptions{Path: path})
+	if _, err := adapter.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.Restore(h, 3); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	id, entries := adapter.Position()
+	if id == 1 || entries != 2 {
+		t.Errorf("Position() = %d, %d, want a new id and 2 entries", id, entries)
+	}
+	adapter.journal.Close()
+
+	// the next start replays the rewritten journal from the start
+	if j, err = journal.InitFile(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	restoredHandler, restored := newTestHandler()
+	adapter = NewJournalAdapter(j, restored, nil)
+	if got, err := adapter.Open(); err != nil || got != id {
+		t.Errorf("Open() = %d, %v, want %d", got, err, id)
+	}
+	if err := adapter.Restore(restoredHandler, 0); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, want := dumpState(t, restored), dumpState(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() restored = %v, want %v", got, want)
+	}
+
+	// without the file the journal cannot be rewritten
+	adapter = NewJournalAdapter(new(memoryJournal), restored, nil)
+	if err := adapter.Restore(restoredHandler, 1); err != ErrJournalBehindSnapshot {
+		t.Errorf("Restore() error = %v, want %v", err, ErrJournalBehindSnapshot)
+	}
+}
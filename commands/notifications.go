@@ -0,0 +1,282 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+	gosync "sync"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/pubsub"
+	"github.com/auvn/go.cache/storage"
+)
+
+// NotifyClass is a set of the classes of the keyspace events.
+type NotifyClass int
+
+const (
+	NotifyGeneric   NotifyClass = 1 << iota // del, expire, persist
+	NotifyString                            // set, incrby, incrbyfloat
+	NotifyList                              // lpush, rpush, lpop, rpop, lset, linsert, lrem, ltrim
+	NotifyHash                              // hset, hdel, hincrby, hexpire, hpersist
+	NotifySet                               // sadd, srem
+	NotifySortedSet                         // zadd, zrem
+	NotifyExpired                           // expired
+	NotifyEvicted                           // evicted
+
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifyHash |
+		NotifySet | NotifySortedSet | NotifyExpired | NotifyEvicted
+
+	// the channels the events are published to
+	KeyspaceChannelPrefix = "__keyspace__:" // + key, the message is the event
+	KeyeventChannelPrefix = "__keyevent__:" // + event, the message is the key
+)
+
+var (
+	ErrUnknownNotifyClass = errors.New("unknown keyspace event class")
+
+	DefaultKeyspaceNotifierOptions = &KeyspaceNotifierOptions{
+		Classes: NotifyAll,
+	}
+
+	notifyClassNames = map[string]NotifyClass{
+		"generic": NotifyGeneric,
+		"string":  NotifyString,
+		"list":    NotifyList,
+		"hash":    NotifyHash,
+		"set":     NotifySet,
+		"zset":    NotifySortedSet,
+		"expired": NotifyExpired,
+		"evicted": NotifyEvicted,
+		"all":     NotifyAll,
+	}
+
+	// the events of the write commands by the command name
+	commandEvents = map[string]commandEvent{
+		"SET":         {NotifyString, "set", notFalse},
+		"GETSET":      {NotifyString, "set", always},
+		"INCR":        {NotifyString, "incrby", always},
+		"DECR":        {NotifyString, "incrby", always},
+		"INCRBY":      {NotifyString, "incrby", always},
+		"DECRBY":      {NotifyString, "incrby", always},
+		"INCRBYFLOAT": {NotifyString, "incrbyfloat", always},
+		"EXPIRE":      {NotifyGeneric, "expire", notFalse},
+		"PEXPIRE":     {NotifyGeneric, "expire", notFalse},
+		"EXPIREAT":    {NotifyGeneric, "expire", notFalse},
+		"PEXPIREAT":   {NotifyGeneric, "expire", notFalse},
+		"PERSIST":     {NotifyGeneric, "persist", notFalse},
+		"LPUSH":       {NotifyList, "lpush", always},
+		"RPUSH":       {NotifyList, "rpush", always},
+		"LPOP":        {NotifyList, "lpop", popped},
+		"RPOP":        {NotifyList, "rpop", popped},
+		"LSET":        {NotifyList, "lset", always},
+		"LINSERT":     {NotifyList, "linsert", positive},
+		"LREM":        {NotifyList, "lrem", positive},
+		"LTRIM":       {NotifyList, "ltrim", notFalse},
+		"HSET":        {NotifyHash, "hset", always},
+		"HMSET":       {NotifyHash, "hset", always},
+		"HSETNX":      {NotifyHash, "hset", notFalse},
+		"HDEL":        {NotifyHash, "hdel", positive},
+		"HINCRBY":     {NotifyHash, "hincrby", always},
+		"HEXPIRE":     {NotifyHash, "hexpire", anyUpdated},
+		"HPEXPIREAT":  {NotifyHash, "hexpire", anyUpdated},
+		"HPERSIST":    {NotifyHash, "hpersist", anyUpdated},
+		"SADD":        {NotifySet, "sadd", positive},
+		"SREM":        {NotifySet, "srem", positive},
+		"ZADD":        {NotifySortedSet, "zadd", always},
+		"ZREM":        {NotifySortedSet, "zrem", positive},
+	}
+
+	// the events of the keys removed by the storage
+	removalEvents = map[storage.Removal]commandEvent{
+		storage.Deleted: {class: NotifyGeneric, name: "del"},
+		storage.Expired: {class: NotifyExpired, name: "expired"},
+		storage.Evicted: {class: NotifyEvicted, name: "evicted"},
+	}
+)
+
+// ParseNotifyClasses parses the comma separated class names, e.g. generic,expired,
+// all enables every class, an empty string disables the notifications.
+func ParseNotifyClasses(spec string) (NotifyClass, error) {
+	var ret NotifyClass
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		class, ok := notifyClassNames[name]
+		if !ok {
+			return 0, ErrUnknownNotifyClass
+		}
+		ret |= class
+	}
+	return ret, nil
+}
+
+// checks if the reply of the command means the key is changed
+type changedFn func(reply interface{}) bool
+
+func always(reply interface{}) bool {
+	return true
+}
+
+func notFalse(reply interface{}) bool {
+	return reply != false
+}
+
+func positive(reply interface{}) bool {
+	n, ok := reply.(core.IntValue)
+	return ok && n > 0
+}
+
+// one of the replies of the keys of a hash is positive
+func anyUpdated(reply interface{}) bool {
+	replies, _ := reply.([]core.IntValue)
+	for _, r := range replies {
+		if r > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func popped(reply interface{}) bool {
+	v, ok := reply.(core.Value)
+	return ok && v != nil
+}
+
+type commandEvent struct {
+	class   NotifyClass
+	name    string
+	changed changedFn
+}
+
+type KeyEvent struct {
+	Class NotifyClass
+	// the name of the event, e.g. set or expired
+	Name string
+	Key  core.StrValue
+}
+
+// KeyEventHook is called synchronously, the events of a key are received in
+// order. It must not access the storage, since the shard of the key may be locked.
+type KeyEventHook func(KeyEvent)
+
+type KeyspaceNotifierOptions struct {
+	// the classes of the events emitted
+	Classes NotifyClass
+}
+
+// KeyspaceNotifier publishes the changes of the keys to the pub/sub channels
+// and the in-process hooks.
+type KeyspaceNotifier struct {
+	opts   *KeyspaceNotifierOptions
+	broker *pubsub.Broker
+
+	mu    gosync.RWMutex
+	hooks []KeyEventHook
+}
+
+func (self *KeyspaceNotifier) notify(event commandEvent, key core.StrValue) {
+	if self.opts.Classes&event.class == 0 {
+		return
+	}
+	if self.broker != nil {
+		self.broker.Publish(KeyspaceChannelPrefix+string(key), []byte(event.name))
+		self.broker.Publish(KeyeventChannelPrefix+event.name, []byte(key))
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for _, hook := range self.hooks {
+		hook(KeyEvent{Class: event.class, Name: event.name, Key: key})
+	}
+}
+
+// Removed is the remove hook of the storage.
+func (self *KeyspaceNotifier) Removed(key core.StrValue, reason storage.Removal) {
+	if event, ok := removalEvents[reason]; ok {
+		self.notify(event, key)
+	}
+}
+
+// the prefix of the events of the end of a list
+func listEnd(where []byte) string {
+	if strings.ToUpper(string(where)) == "LEFT" {
+		return "l"
+	}
+	return "r"
+}
+
+// the events of the source and the destination of the moves between the lists
+func moveEvents(body [][]byte) (commandEvent, commandEvent, bool) {
+	var from, to string
+	switch strings.ToUpper(string(body[0])) {
+	case "RPOPLPUSH":
+		from, to = "rpop", "lpush"
+	case "LMOVE":
+		if len(body) != 5 {
+			return commandEvent{}, commandEvent{}, false
+		}
+		from, to = listEnd(body[3])+"pop", listEnd(body[4])+"push"
+	default:
+		return commandEvent{}, commandEvent{}, false
+	}
+	return commandEvent{class: NotifyList, name: from}, commandEvent{class: NotifyList, name: to}, len(body) >= 3
+}
+
+func (self *KeyspaceNotifier) notifyCommand(body [][]byte, reply interface{}) {
+	if len(body) < 2 {
+		return
+	}
+	if from, to, ok := moveEvents(body); ok {
+		if popped(reply) {
+			self.notify(from, core.StrValue(body[1]))
+			self.notify(to, core.StrValue(body[2]))
+		}
+		return
+	}
+	event, ok := commandEvents[strings.ToUpper(string(body[0]))]
+	if ok && event.changed(reply) {
+		self.notify(event, core.StrValue(body[1]))
+	}
+}
+
+func (self *KeyspaceNotifier) successCommand(flag int, body [][]byte, reply interface{}) <-chan error {
+	if !CheckFlag(flag, WFlag) {
+		return nil
+	}
+	if !isTransaction(body) {
+		self.notifyCommand(body, reply)
+		return nil
+	}
+	// the replies of the writes of the transaction
+	bodies, err := decodeTransaction(body)
+	replies, ok := reply.([]interface{})
+	if err != nil || !ok || len(replies) != len(bodies) {
+		return nil
+	}
+	for i, b := range bodies {
+		self.notifyCommand(b, replies[i])
+	}
+	return nil
+}
+
+func (self *KeyspaceNotifier) AddHook(fn KeyEventHook) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.hooks = append(self.hooks, fn)
+}
+
+func (self *KeyspaceNotifier) AttachTo(h *Handler) {
+	h.AddSuccessHook(self.successCommand)
+}
+
+// the events are not published if the broker is nil
+func NewKeyspaceNotifier(broker *pubsub.Broker, opts *KeyspaceNotifierOptions) *KeyspaceNotifier {
+	if opts == nil {
+		opts = DefaultKeyspaceNotifierOptions
+	}
+	return &KeyspaceNotifier{
+		opts:   opts,
+		broker: broker,
+	}
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/pubsub"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+)
+
+func Test_ParseNotifyClasses(t *testing.T) {
+	if classes, err := ParseNotifyClasses(" generic, Expired,"); err != nil || classes != NotifyGeneric|NotifyExpired {
+		t.Errorf("ParseNotifyClasses() = %v, %v", classes, err)
+	}
+	if classes, err := ParseNotifyClasses(""); err != nil || classes != 0 {
+		t.Errorf("ParseNotifyClasses() of empty string = %v, %v", classes, err)
+	}
+	if _, err := ParseNotifyClasses("generic,keys"); err != ErrUnknownNotifyClass {
+		t.Errorf("ParseNotifyClasses() error = %v, want %v", err, ErrUnknownNotifyClass)
+	}
+}
+
+func Test_KeyspaceNotifier(t *testing.T) {
+	broker := pubsub.NewBroker()
+	notifier := NewKeyspaceNotifier(broker, &KeyspaceNotifierOptions{
+		Classes: NotifyGeneric | NotifyList | NotifyExpired,
+	})
+	var events []string
+	notifier.AddHook(func(e KeyEvent) {
+		events = append(events, e.Name+" "+string(e.Key))
+	})
+	sub := pubsub.NewSubscriber(0)
+	broker.Subscribe(sub, KeyeventChannelPrefix+"del")
+
+	h := NewHandler(InitReflectRegistry(new(RegistryOptions)))
+	s := session.WithStorage(session.New(), storage.New(&storage.Options{OnRemove: notifier.Removed}))
+	notifier.AttachTo(h)
+	serveHandler(t, h)
+
+	mustRequest(t, h, s, "SET", "a", "1")
+	mustRequest(t, h, s, "LPUSH", "l", "x")
+	mustRequest(t, h, s, "LPOP", "l")
+	mustRequest(t, h, s, "LPOP", "l")
+	mustRequest(t, h, s, "RPOPLPUSH", "l", "m")
+	mustRequest(t, h, s, "RPUSH", "l", "y")
+	mustRequest(t, h, s, "LMOVE", "l", "m", "LEFT", "RIGHT")
+	mustRequest(t, h, s, "DEL", "a", "b")
+	mustRequest(t, h, s, "SET", "c", "1", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	// reclaims the expired key
+	mustRequest(t, h, s, "SET", "d", "1")
+
+	want := []string{"lpush l", "lpop l", "rpush l", "lpop l", "rpush m", "del a", "expired c"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	m := <-sub.Messages()
+	if m.Channel != KeyeventChannelPrefix+"del" || string(m.Data) != "a" {
+		t.Errorf("message = %+v", m)
+	}
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/pubsub"
+	"github.com/auvn/go.cache/session"
+)
+
+var (
+	ErrPushUnsupported = errors.New("the connection does not support the push mode")
+)
+
+type PubSubCommand struct {
+	broker *pubsub.Broker
+}
+
+func (self *PubSubCommand) subscriber(s session.Session) (*pubsub.Subscriber, error) {
+	sub := session.Subscriber(s)
+	if sub == nil {
+		return nil, ErrPushUnsupported
+	}
+	return sub, nil
+}
+
+func strValues(values []core.StrValue) []string {
+	ret := make([]string, len(values))
+	for i, v := range values {
+		ret[i] = v.Value()
+	}
+	return ret
+}
+
+// the connection enters the push mode, replies with [subscribe, number of the subscriptions]
+func (self *PubSubCommand) Subscribe(s session.Session, channel core.StrValue, channels ...core.StrValue) (interface{}, error) {
+	sub, err := self.subscriber(s)
+	if err != nil {
+		return nil, err
+	}
+	n, err := self.broker.Subscribe(sub, strValues(append([]core.StrValue{channel}, channels...))...)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{"subscribe", n}, nil
+}
+
+func (self *PubSubCommand) PSubscribe(s session.Session, pattern core.StrValue, patterns ...core.StrValue) (interface{}, error) {
+	sub, err := self.subscriber(s)
+	if err != nil {
+		return nil, err
+	}
+	n, err := self.broker.PSubscribe(sub, strValues(append([]core.StrValue{pattern}, patterns...))...)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{"psubscribe", n}, nil
+}
+
+// the connection leaves the push mode once there are no subscriptions
+func (self *PubSubCommand) Unsubscribe(s session.Session, channels ...core.StrValue) (interface{}, error) {
+	sub, err := self.subscriber(s)
+	if err != nil {
+		return nil, err
+	}
+	n := self.broker.Unsubscribe(sub, strValues(channels)...)
+	return []interface{}{"unsubscribe", n}, nil
+}
+
+func (self *PubSubCommand) PUnsubscribe(s session.Session, patterns ...core.StrValue) (interface{}, error) {
+	sub, err := self.subscriber(s)
+	if err != nil {
+		return nil, err
+	}
+	n := self.broker.PUnsubscribe(sub, strValues(patterns)...)
+	return []interface{}{"punsubscribe", n}, nil
+}
+
+// replies with the number of the subscribers the message is sent to
+func (self *PubSubCommand) Publish(s session.Session, channel core.StrValue, message core.Value) (interface{}, error) {
+	return self.broker.Publish(channel.Value(), message), nil
+}
+
+func NewPubSubCommand(broker *pubsub.Broker) *PubSubCommand {
+	return &PubSubCommand{broker: broker}
+}
@@ -1,7 +1,20 @@
 package commands
 
+import (
+	"github.com/auvn/go.cache/pubsub"
+	"github.com/auvn/go.cache/snapshot"
+)
+
 type RegistryOptions struct {
-	Auth string
+	Auth     string
+	Snapshot *snapshot.File
+	Journal  *JournalAdapter
+	// nil disables the replication commands
+	Replication *Replication
+	// nil disables the cluster commands
+	Cluster *SlotMigrator
+	// a new broker is created if nil
+	PubSub *pubsub.Broker
 }
 
 func newReflectRegistryOptions(opts *RegistryOptions) *ReflectRegistryOptions {
@@ -15,9 +28,21 @@ func newReflectRegistryOptions(opts *RegistryOptions) *ReflectRegistryOptions {
 func InitReflectRegistry(opts *RegistryOptions) *ReflectRegistry {
 	securityCommand := NewSecurityCommand(opts.Auth)
 	storageCommand := NewStorageCommand()
+	snapshotCommand := NewSnapshotCommand(opts.Snapshot, opts.Journal)
+	journalCommand := NewJournalCommand(opts.Journal)
+	replicationCommand := NewReplicationCommand(opts.Replication)
+	clusterCommand := NewClusterCommand(opts.Cluster)
+	broker := opts.PubSub
+	if broker == nil {
+		broker = pubsub.NewBroker()
+	}
+	pubSubCommand := NewPubSubCommand(broker)
+	transactionCommand := NewTransactionCommand()
 	stringCommand := NewStringCommand()
 	listCommand := NewListCommand()
 	hashCommand := NewHashCommand()
+	sortedSetCommand := NewSortedSetCommand()
+	setCommand := NewSetCommand()
 
 	registryOptions := newReflectRegistryOptions(opts)
 	return NewReflectRegistry(registryOptions).
@@ -26,23 +51,101 @@ func InitReflectRegistry(opts *RegistryOptions) *ReflectRegistry {
 		Cmd("AUTH", securityCommand.Auth, Flags.R).
 		//common
 		Cmd("KEYS", storageCommand.Keys, Flags.RA).
-		Cmd("EXPIRE", storageCommand.Expire, Flags.WA).
+		Cmd("INFO", storageCommand.Info, Flags.RA).
+		Cmd("EXPIRE", storageCommand.Expire, Flags.WTA).
 		Cmd("DEL", storageCommand.Del, Flags.WA).
 		Cmd("TTL", storageCommand.TTL, Flags.RA).
+		Cmd("PEXPIRE", storageCommand.PExpire, Flags.WTA).
+		Cmd("EXPIREAT", storageCommand.ExpireAt, Flags.WA).
+		Cmd("PEXPIREAT", storageCommand.PExpireAt, Flags.WA).
+		Cmd("PERSIST", storageCommand.Persist, Flags.WA).
+		Cmd("PTTL", storageCommand.PTTL, Flags.RA).
+		//snapshot
+		Cmd("SAVE", snapshotCommand.Save, Flags.SA).
+		Cmd("BGSAVE", snapshotCommand.BgSave, Flags.SA).
+		Cmd(rewriteCommand, journalCommand.Rewrite, Flags.SA).
+		//replication
+		Cmd("SYNC", replicationCommand.Sync, Flags.SA).
+		// waits for the writes, so it is not queued in the transactions
+		// and runs outside of the handler loop as the reads
+		Cmd("PSYNC", replicationCommand.PSync, Flags.RSA).
+		Cmd("REPLICAOF", replicationCommand.ReplicaOf, Flags.SA).
+		Cmd("ROLE", replicationCommand.Role, Flags.RA).
+		//cluster
+		Cmd("CLUSTER", clusterCommand.Cluster, Flags.SA).
+		Cmd("ASKING", clusterCommand.Asking, Flags.SA).
+		//pubsub
+		Cmd("SUBSCRIBE", pubSubCommand.Subscribe, Flags.SAP).
+		Cmd("PSUBSCRIBE", pubSubCommand.PSubscribe, Flags.SAP).
+		Cmd("UNSUBSCRIBE", pubSubCommand.Unsubscribe, Flags.SAP).
+		Cmd("PUNSUBSCRIBE", pubSubCommand.PUnsubscribe, Flags.SAP).
+		Cmd("PUBLISH", pubSubCommand.Publish, Flags.RA).
+		//transaction
+		Cmd("MULTI", transactionCommand.Multi, Flags.SAM).
+		Cmd("EXEC", transactionCommand.Exec, Flags.SAM).
+		Cmd("DISCARD", transactionCommand.Discard, Flags.SAM).
+		Cmd("WATCH", transactionCommand.Watch, Flags.SAM).
+		Cmd("UNWATCH", transactionCommand.Unwatch, Flags.SAM).
+		Cmd(transactionEntry, transactionCommand.Transaction, Flags.WAI).
 		//string
-		Cmd("SET", stringCommand.Set, Flags.WA).
+		Cmd("SET", stringCommand.Set, Flags.WTA).
 		Cmd("GET", stringCommand.Get, Flags.RA).
+		Cmd("GETSET", stringCommand.GetSet, Flags.WA).
+		Cmd("INCR", stringCommand.Incr, Flags.WA).
+		Cmd("DECR", stringCommand.Decr, Flags.WA).
+		Cmd("INCRBY", stringCommand.IncrBy, Flags.WA).
+		Cmd("DECRBY", stringCommand.DecrBy, Flags.WA).
+		Cmd("INCRBYFLOAT", stringCommand.IncrByFloat, Flags.WA).
 		//list
 		Cmd("LPUSH", listCommand.LPush, Flags.WA).
 		Cmd("RPUSH", listCommand.RPush, Flags.WA).
 		Cmd("LPOP", listCommand.LPop, Flags.WA).
 		Cmd("RPOP", listCommand.RPop, Flags.WA).
+		Cmd("BLPOP", listCommand.BLPop, Flags.WA).
+		Cmd("BRPOP", listCommand.BRPop, Flags.WA).
+		Cmd("BRPOPLPUSH", listCommand.BRPopLPush, Flags.WA).
 		Cmd("LRANGE", listCommand.LRange, Flags.RA).
 		Cmd("LINDEX", listCommand.LIndex, Flags.RA).
+		Cmd("LLEN", listCommand.LLen, Flags.RA).
+		Cmd("LSET", listCommand.LSet, Flags.WA).
+		Cmd("LINSERT", listCommand.LInsert, Flags.WA).
+		Cmd("LREM", listCommand.LRem, Flags.WA).
+		Cmd("LTRIM", listCommand.LTrim, Flags.WA).
+		Cmd("RPOPLPUSH", listCommand.RPopLPush, Flags.WA).
+		Cmd("LMOVE", listCommand.LMove, Flags.WA).
 		//hash
 		Cmd("HSET", hashCommand.Set, Flags.WA).
+		Cmd("HMSET", hashCommand.MSet, Flags.WA).
+		Cmd("HSETNX", hashCommand.SetNX, Flags.WA).
+		Cmd("HMGET", hashCommand.MGet, Flags.RA).
+		Cmd("HGETALL", hashCommand.GetAll, Flags.RA).
+		Cmd("HVALS", hashCommand.Vals, Flags.RA).
+		Cmd("HLEN", hashCommand.Len, Flags.RA).
+		Cmd("HEXISTS", hashCommand.Exists, Flags.RA).
 		Cmd("HGET", hashCommand.Get, Flags.RA).
 		Cmd("HDEL", hashCommand.Del, Flags.WA).
 		Cmd("HKEYS", hashCommand.Keys, Flags.RA).
+		Cmd("HINCRBY", hashCommand.IncrBy, Flags.WA).
+		Cmd("HEXPIRE", hashCommand.Expire, Flags.WTA).
+		Cmd("HPEXPIREAT", hashCommand.PExpireAt, Flags.WA).
+		Cmd("HTTL", hashCommand.TTL, Flags.RA).
+		Cmd("HPERSIST", hashCommand.Persist, Flags.WA).
+		//set
+		Cmd("SADD", setCommand.Add, Flags.WA).
+		Cmd("SREM", setCommand.Rem, Flags.WA).
+		Cmd("SISMEMBER", setCommand.IsMember, Flags.RA).
+		Cmd("SMEMBERS", setCommand.Members, Flags.RA).
+		Cmd("SCARD", setCommand.Card, Flags.RA).
+		Cmd("SINTER", setCommand.Inter, Flags.RA).
+		Cmd("SUNION", setCommand.Union, Flags.RA).
+		Cmd("SDIFF", setCommand.Diff, Flags.RA).
+		//sorted set
+		Cmd("ZADD", sortedSetCommand.Add, Flags.WA).
+		Cmd("ZREM", sortedSetCommand.Rem, Flags.WA).
+		Cmd("ZSCORE", sortedSetCommand.Score, Flags.RA).
+		Cmd("ZRANK", sortedSetCommand.Rank, Flags.RA).
+		Cmd("ZCARD", sortedSetCommand.Card, Flags.RA).
+		Cmd("ZRANGE", sortedSetCommand.Range, Flags.RA).
+		Cmd("ZRANGEBYSCORE", sortedSetCommand.RangeByScore, Flags.RA).
 		MustEnd()
 }
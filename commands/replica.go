@@ -0,0 +1,247 @@
+package commands
+
+import (
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/auvn/go.cache/client"
+	"github.com/auvn/go.cache/net/serializer"
+	"github.com/auvn/go.cache/server"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/snapshot"
+	"github.com/auvn/go.cache/storage"
+)
+
+var (
+	ErrInvalidSyncReply = errors.New("invalid reply of the leader")
+)
+
+// replica applies the writes of the leader until it is stopped.
+type replica struct {
+	replication *Replication
+	session     session.Session
+	addr        string
+	stop        chan struct{}
+
+	// guarded by the replication
+	up           bool
+	leaderOffset int
+	contact      time.Time
+}
+
+func (self *replica) stopped() bool {
+	select {
+	case <-self.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (self *replica) update(fn func()) {
+	self.replication.mu.Lock()
+	defer self.replication.mu.Unlock()
+	fn()
+}
+
+func (self *replica) call(c net.Conn, conn client.Connection, args ...interface{}) (serializer.Payload, error) {
+	opts := self.replication.opts
+	c.SetDeadline(time.Now().Add(opts.PullTimeout + opts.DialTimeout))
+	if err := conn.Send(client.Payload(args)); err != nil {
+		return nil, err
+	}
+	p, err := conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	if p.IsErr() {
+		return nil, p.Err()
+	}
+	return p, nil
+}
+
+// executes the command in order with the other commands of the handler
+func (self *replica) execute(body [][]byte) error {
+	req := server.NewRequest(body, self.session)
+	self.replication.handler.HandleRequest(req)
+	_, err := req.Get(self.stop)
+	return err
+}
+
+// replaces the storage with the snapshot of the leader
+func (self *replica) fullSync(c net.Conn, conn client.Connection) (string, int, error) {
+	p, err := self.call(c, conn, "SYNC")
+	if err != nil {
+		return "", 0, err
+	}
+	arr, err := p.Array()
+	if err != nil || len(arr) != 3 {
+		return "", 0, ErrInvalidSyncReply
+	}
+	id, err := arr[0].Str()
+	if err != nil {
+		return "", 0, ErrInvalidSyncReply
+	}
+	offset, err := arr[1].Int()
+	if err != nil {
+		return "", 0, ErrInvalidSyncReply
+	}
+	data, err := arr[2].Bytes()
+	if err != nil {
+		return "", 0, ErrInvalidSyncReply
+	}
+	if self.stopped() {
+		return "", 0, server.ErrQuit
+	}
+	_, err = self.session.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		for _, key := range w.Keys() {
+			w.Delete(key)
+		}
+		return snapshot.Decode(data, w)
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	self.replication.reset(id, offset)
+	// the journal of the follower should contain the snapshot
+	if err := self.execute([][]byte{[]byte(rewriteCommand)}); err != nil && err != ErrRewriteUnsupported {
+		log.Println("cannot rewrite the journal after the full sync:", err)
+	}
+	log.Printf("full sync with %s, offset: %d", self.addr, offset)
+	return id, offset, nil
+}
+
+// applies the writes of the PSYNC reply, returns the next offset
+func (self *replica) apply(p serializer.Payload, offset int) (int, error) {
+	arr, err := p.Array()
+	if err != nil || len(arr) != 2 {
+		return offset, ErrInvalidSyncReply
+	}
+	leaderOffset, err := arr[0].Int()
+	if err != nil {
+		return offset, ErrInvalidSyncReply
+	}
+	entries, err := arr[1].Array()
+	if err != nil {
+		return offset, ErrInvalidSyncReply
+	}
+	for _, e := range entries {
+		items, err := e.Array()
+		if err != nil {
+			return offset, ErrInvalidSyncReply
+		}
+		body := make([][]byte, len(items))
+		for i, item := range items {
+			if body[i], err = item.Bytes(); err != nil {
+				return offset, ErrInvalidSyncReply
+			}
+		}
+		if err := self.execute(body); err == server.ErrQuit {
+			return offset, err
+		} else if err != nil {
+			log.Printf("cannot apply the write of the leader %q: %s", body[0], err.Error())
+		}
+		offset += 1
+		// the failed write is kept in the history as it is, so the offsets
+		// of the backlog have no gaps
+		self.update(func() {
+			if self.replication.offset < offset {
+				self.replication.append(body)
+			}
+		})
+	}
+	self.update(func() {
+		self.up = true
+		self.leaderOffset = leaderOffset
+		self.contact = time.Now()
+	})
+	return offset, nil
+}
+
+func (self *replica) replicate() error {
+	opts := self.replication.opts
+	c, err := net.DialTimeout("tcp", self.addr, opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-self.stop:
+		case <-done:
+		}
+		c.Close()
+	}()
+	conn := client.NewConnection(c)
+	if opts.LeaderAuth != "" {
+		if _, err := self.call(c, conn, "AUTH", opts.LeaderAuth); err != nil {
+			return err
+		}
+	}
+
+	id, offset := self.replication.position()
+	for !self.stopped() {
+		p, err := self.call(c, conn, "PSYNC", id, offset, opts.Name)
+		if err != nil && err.Error() == ErrPartialSync.Error() {
+			if id, offset, err = self.fullSync(c, conn); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if offset, err = self.apply(p, offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *replica) run() {
+	log.Println("replicating", self.addr)
+	for {
+		err := self.replicate()
+		self.update(func() { self.up = false })
+		if self.stopped() {
+			log.Println("stopped replicating", self.addr)
+			return
+		}
+		log.Printf("replication of %s failed: %s", self.addr, err)
+		select {
+		case <-self.stop:
+			return
+		case <-time.After(self.replication.opts.RetryDelay):
+		}
+	}
+}
+
+// name/value pairs describing the replica, called by the replication
+func (self *replica) info(offset int) []interface{} {
+	link := "down"
+	if self.up {
+		link = "up"
+	}
+	var contact int
+	if !self.contact.IsZero() {
+		contact = int(time.Since(self.contact) / time.Millisecond)
+	}
+	return []interface{}{
+		"leader", self.addr,
+		"link", link,
+		"leader_offset", self.leaderOffset,
+		"lag", self.leaderOffset - offset,
+		"last_contact_ms", contact,
+	}
+}
+
+func newReplica(replication *Replication, addr string) *replica {
+	return &replica{
+		replication: replication,
+		session:     session.WithReplication(replication.session),
+		addr:        addr,
+		stop:        make(chan struct{}),
+	}
+}
@@ -0,0 +1,317 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/snapshot"
+	"github.com/auvn/go.cache/storage"
+	"github.com/auvn/go.cache/util/sync"
+)
+
+const (
+	// max number of entries sent by a single PSYNC
+	maxSyncEntries = 1000
+	// followers which did not pull for a while are not reported
+	followerTimeout = time.Minute
+)
+
+var (
+	_ (sync.Server) = (*Replication)(nil)
+
+	ErrPartialSync            = errors.New("cannot continue the replication from the offset")
+	ErrReplicationUnsupported = errors.New("replication is not configured")
+
+	DefaultReplicationOptions = &ReplicationOptions{
+		BacklogSize: 1 << 20,
+		PullTimeout: time.Second,
+		RetryDelay:  time.Second,
+		DialTimeout: 5 * time.Second,
+	}
+)
+
+type ReplicationOptions struct {
+	// bytes of the latest writes kept for the followers to catch up
+	BacklogSize int
+	// how long PSYNC waits for new writes
+	PullTimeout time.Duration
+	RetryDelay  time.Duration
+	DialTimeout time.Duration
+	// identifies the follower on the leader
+	Name string
+	// the password of the leader
+	LeaderAuth string
+}
+
+type replicationEntry struct {
+	offset int
+	body   [][]byte
+	size   int
+}
+
+type followerState struct {
+	offset int
+	seen   time.Time
+}
+
+// Replication keeps the latest writes for the followers, and replicates
+// the writes of the leader once the server becomes a follower.
+type Replication struct {
+	opts    *ReplicationOptions
+	session session.Session
+	handler *Handler
+
+	mu gosync.Mutex
+	// the history of the writes, the offset is the number of writes in it
+	id          string
+	offset      int
+	backlog     []*replicationEntry
+	backlogSize int
+	// closed on every write
+	written   chan struct{}
+	followers map[string]*followerState
+
+	replica *replica
+}
+
+func (self *Replication) successCommand(flag int, body [][]byte, reply interface{}) <-chan error {
+	if CheckFlag(flag, NonJournalableFlag) {
+		return nil
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.append(body)
+	return nil
+}
+
+// adds the write to the history, the lock must be held
+func (self *Replication) append(body [][]byte) {
+	entry := &replicationEntry{body: body}
+	for _, item := range body {
+		entry.size += len(item)
+	}
+	self.offset += 1
+	entry.offset = self.offset
+	self.backlog = append(self.backlog, entry)
+	self.backlogSize += entry.size
+	var trimmed int
+	for self.backlogSize > self.opts.BacklogSize && trimmed < len(self.backlog)-1 {
+		self.backlogSize -= self.backlog[trimmed].size
+		trimmed += 1
+	}
+	self.backlog = self.backlog[trimmed:]
+	close(self.written)
+	self.written = make(chan struct{})
+}
+
+// starts the new history, e.g. after the full sync with the leader
+func (self *Replication) reset(id string, offset int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.id = id
+	self.offset = offset
+	self.backlog = nil
+	self.backlogSize = 0
+}
+
+func (self *Replication) position() (string, int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.id, self.offset
+}
+
+// the writes after the offset, the channel is closed on the next write
+// if there are no writes yet
+func (self *Replication) entriesAfter(id string, offset int) ([]*replicationEntry, <-chan struct{}, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if id != self.id || offset > self.offset {
+		return nil, nil, ErrPartialSync
+	}
+	if offset == self.offset {
+		return nil, self.written, nil
+	}
+	if len(self.backlog) == 0 || self.backlog[0].offset > offset+1 {
+		return nil, nil, ErrPartialSync
+	}
+	start := offset + 1 - self.backlog[0].offset
+	end := start + maxSyncEntries
+	if end > len(self.backlog) {
+		end = len(self.backlog)
+	}
+	return self.backlog[start:end], nil, nil
+}
+
+func (self *Replication) seen(name string, offset int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.followers[name] = &followerState{offset: offset, seen: time.Now()}
+}
+
+// Sync is the full sync: the id and the offset of the history with the snapshot
+// of the storage, must be called in order with the writes.
+func (self *Replication) Sync(s storage.Storage) ([]interface{}, error) {
+	data, err := s.Read(func(r storage.Reader) (interface{}, error) {
+		return snapshot.Encode(r, &snapshot.Header{Created: r.TimeNow()})
+	})
+	if err != nil {
+		return nil, err
+	}
+	id, offset := self.position()
+	return []interface{}{id, offset, data}, nil
+}
+
+// PSync waits for the writes after the offset, returns the offset of the history
+// and the writes.
+func (self *Replication) PSync(id string, offset int, name string) ([]interface{}, error) {
+	self.seen(name, offset)
+	entries, written, err := self.entriesAfter(id, offset)
+	if err != nil {
+		return nil, err
+	}
+	if written != nil {
+		select {
+		case <-written:
+			entries, _, err = self.entriesAfter(id, offset)
+			if err != nil {
+				return nil, err
+			}
+		case <-time.After(self.opts.PullTimeout):
+		}
+	}
+	bodies := make([]interface{}, len(entries))
+	for i, e := range entries {
+		bodies[i] = e.body
+	}
+	_, current := self.position()
+	return []interface{}{current, bodies}, nil
+}
+
+// Role describes the replication as name/value pairs.
+func (self *Replication) Role() []interface{} {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.replica != nil {
+		return append([]interface{}{
+			"role", "follower",
+			"repl_id", self.id,
+			"repl_offset", self.offset,
+		}, self.replica.info(self.offset)...)
+	}
+
+	ret := []interface{}{
+		"role", "leader",
+		"repl_id", self.id,
+		"repl_offset", self.offset,
+	}
+	names := make([]string, 0, len(self.followers))
+	for name, state := range self.followers {
+		if time.Since(state.seen) > followerTimeout {
+			delete(self.followers, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ret = append(ret, "followers", len(names))
+	for _, name := range names {
+		state := self.followers[name]
+		ret = append(ret,
+			"follower_"+name,
+			fmt.Sprintf("offset=%d,lag=%d", state.offset, self.offset-state.offset),
+		)
+	}
+	return ret
+}
+
+// Follow replicates the leader at the address, the empty address stops the replication.
+func (self *Replication) Follow(addr string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.replica != nil {
+		close(self.replica.stop)
+		self.replica = nil
+	}
+	if addr == "" {
+		self.handler.SetReadOnly(false)
+		return
+	}
+	self.handler.SetReadOnly(true)
+	self.replica = newReplica(self, addr)
+	go self.replica.run()
+}
+
+func (self *Replication) Serve(quit sync.Quit) error {
+	<-quit
+	self.Follow("")
+	return nil
+}
+
+func (self *Replication) AttachTo(h *Handler) {
+	self.handler = h
+	h.AddSuccessHook(self.successCommand)
+}
+
+func NewReplication(s session.Session, opts *ReplicationOptions) *Replication {
+	if opts == nil {
+		opts = DefaultReplicationOptions
+	}
+	return &Replication{
+		opts:      opts,
+		session:   s,
+		id:        fmt.Sprintf("%x", time.Now().UnixNano()),
+		written:   make(chan struct{}),
+		followers: make(map[string]*followerState),
+	}
+}
+
+type ReplicationCommand struct {
+	replication *Replication
+}
+
+func (self *ReplicationCommand) Sync(s session.Session) (interface{}, error) {
+	if self.replication == nil {
+		return nil, ErrReplicationUnsupported
+	}
+	return self.replication.Sync(s.Storage())
+}
+
+// PSYNC id offset name
+func (self *ReplicationCommand) PSync(s session.Session, id core.StrValue, offset core.IntValue, name core.StrValue) (interface{}, error) {
+	if self.replication == nil {
+		return nil, ErrReplicationUnsupported
+	}
+	return self.replication.PSync(id.Value(), offset.Value(), name.Value())
+}
+
+// REPLICAOF host port, REPLICAOF NO ONE stops the replication
+func (self *ReplicationCommand) ReplicaOf(s session.Session, host core.StrValue, port core.StrValue) (interface{}, error) {
+	if self.replication == nil {
+		return nil, ErrReplicationUnsupported
+	}
+	if strings.ToUpper(host.Value()) == "NO" && strings.ToUpper(port.Value()) == "ONE" {
+		self.replication.Follow("")
+	} else {
+		self.replication.Follow(net.JoinHostPort(host.Value(), port.Value()))
+	}
+	return true, nil
+}
+
+func (self *ReplicationCommand) Role(s session.Session) (interface{}, error) {
+	if self.replication == nil {
+		return nil, ErrReplicationUnsupported
+	}
+	return self.replication.Role(), nil
+}
+
+// replication is nil if the replication is disabled
+func NewReplicationCommand(replication *Replication) *ReplicationCommand {
+	return &ReplicationCommand{replication: replication}
+}
@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/net/serializer"
+	"github.com/auvn/go.cache/server"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/util/sync"
+)
+
+// the requests of the served handler pass the read only check and the hooks
+func request(h *Handler, s session.Session, args ...string) (interface{}, error) {
+	body := make([][]byte, len(args))
+	for i, a := range args {
+		body[i] = []byte(a)
+	}
+	req := server.NewRequest(body, s)
+	h.HandleRequest(req)
+	return req.Get(nil)
+}
+
+func mustRequest(t *testing.T, h *Handler, s session.Session, args ...string) interface{} {
+	ret, err := request(h, s, args...)
+	if err != nil {
+		t.Fatalf("%v error = %v", args, err)
+	}
+	return ret
+}
+
+// the handler serving the requests until the test ends
+func serveHandler(t *testing.T, h *Handler) {
+	quit := make(chan struct{})
+	go h.Serve(sync.Quit(quit))
+	t.Cleanup(func() { close(quit) })
+}
+
+func newTestReplication(t *testing.T, opts *ReplicationOptions) (*Replication, *Handler, session.Session) {
+	h, s := newTestHandler()
+	r := NewReplication(s, opts)
+	r.AttachTo(h)
+	serveHandler(t, h)
+	return r, h, s
+}
+
+func Test_Replication_PSync(t *testing.T) {
+	r, h, s := newTestReplication(t, &ReplicationOptions{BacklogSize: 1 << 10, PullTimeout: time.Millisecond})
+	mustRequest(t, h, s, "SET", "a", "1", "EX", "100")
+	mustRequest(t, h, s, "GET", "a")
+	mustRequest(t, h, s, "LPUSH", "list", "a")
+	id, offset := r.position()
+	if offset != 2 {
+		t.Fatalf("offset = %d, want 2", offset)
+	}
+
+	ret, err := r.PSync(id, 1, "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{2, []interface{}{[][]byte{[]byte("LPUSH"), []byte("list"), []byte("a")}}}
+	if !reflect.DeepEqual(ret, want) {
+		t.Errorf("PSync() = %q, want %q", ret, want)
+	}
+	// the relative TTL is replicated as the deadline
+	ret, _ = r.PSync(id, 0, "follower")
+	if got := string(ret[1].([]interface{})[0].([][]byte)[3]); got != "PXAT" {
+		t.Errorf("PSync() SET option = %s, want PXAT", got)
+	}
+	// nothing new until the timeout
+	if ret, _ = r.PSync(id, 2, "follower"); len(ret[1].([]interface{})) != 0 {
+		t.Errorf("PSync() = %q, want no entries", ret)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		id     string
+		offset int
+	}{
+		{"unknown id", "other", 2},
+		{"offset ahead", id, 3},
+	} {
+		if _, err := r.PSync(tt.id, tt.offset, "follower"); err != ErrPartialSync {
+			t.Errorf("%s: PSync() error = %v, want %v", tt.name, err, ErrPartialSync)
+		}
+	}
+}
+
+func Test_Replication_Backlog(t *testing.T) {
+	r, h, s := newTestReplication(t, &ReplicationOptions{BacklogSize: 20, PullTimeout: time.Millisecond})
+	for i := 0; i < 10; i++ {
+		mustRequest(t, h, s, "SET", "key", "value")
+	}
+	id, offset := r.position()
+	if _, err := r.PSync(id, 0, "follower"); err != ErrPartialSync {
+		t.Errorf("PSync() error = %v, want %v", err, ErrPartialSync)
+	}
+	ret, err := r.PSync(id, offset-1, "follower")
+	if err != nil || len(ret[1].([]interface{})) != 1 {
+		t.Errorf("PSync() = %q, %v, want the last entry", ret, err)
+	}
+}
+
+func Test_replica_ApplyFailed(t *testing.T) {
+	r, _, _ := newTestReplication(t, &ReplicationOptions{BacklogSize: 1 << 10, PullTimeout: time.Millisecond})
+	var buf bytes.Buffer
+	serializer.Write(&buf, []interface{}{3, []interface{}{
+		[]interface{}{[]byte("LPUSH"), []byte("list"), []byte("a")},
+		[]interface{}{[]byte("INCR"), []byte("list")},
+		[]interface{}{[]byte("SET"), []byte("b"), []byte("2")},
+	}})
+	p, err := serializer.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica := newReplica(r, "")
+	if offset, err := replica.apply(p, 0); err != nil || offset != 3 {
+		t.Fatalf("apply() = %v, %v, want 3", offset, err)
+	}
+
+	// the writes after the failed one are found by their offsets
+	id, _ := r.position()
+	ret, err := r.PSync(id, 1, "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := ret[1].([]interface{})
+	if ret[0] != 3 || len(bodies) != 2 || string(bodies[1].([][]byte)[1]) != "b" {
+		t.Errorf("PSync() = %q, want INCR and SET b", ret)
+	}
+}
+
+func Test_Handler_ReadOnly(t *testing.T) {
+	_, h, s := newTestReplication(t, nil)
+	h.SetReadOnly(true)
+	if _, err := request(h, s, "SET", "a", "1"); err != ErrReadOnly {
+		t.Errorf("SET error = %v, want %v", err, ErrReadOnly)
+	}
+	mustRequest(t, h, s, "GET", "a")
+	mustRequest(t, h, session.WithReplication(s), "SET", "a", "1")
+	if got := mustRequest(t, h, s, "GET", "a"); got == nil {
+		t.Errorf("GET = %v, want the replicated value", got)
+	}
+}
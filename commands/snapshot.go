@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/snapshot"
+)
+
+var (
+	ErrNoSnapshot = errors.New("snapshot file is not configured")
+)
+
+type SnapshotCommand struct {
+	file    *snapshot.File
+	journal *JournalAdapter
+}
+
+func (self *SnapshotCommand) header() snapshot.Header {
+	var h snapshot.Header
+	if self.journal != nil {
+		h.JournalID, h.JournalEntries = self.journal.Position()
+	}
+	return h
+}
+
+func (self *SnapshotCommand) Save(s session.Session) (interface{}, error) {
+	if self.file == nil {
+		return nil, ErrNoSnapshot
+	}
+	if err := self.file.Save(s.Storage(), self.header()); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// BGSAVE blocks the commands while the keys are encoded, only the file is written in the background
+func (self *SnapshotCommand) BgSave(s session.Session) (interface{}, error) {
+	if self.file == nil {
+		return nil, ErrNoSnapshot
+	}
+	if err := self.file.BackgroundSave(s.Storage(), self.header()); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// file is nil if snapshots are disabled
+func NewSnapshotCommand(file *snapshot.File, journal *JournalAdapter) *SnapshotCommand {
+	return &SnapshotCommand{file: file, journal: journal}
+}
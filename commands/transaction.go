@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+)
+
+const (
+	// the journal entry of the writes of a transaction:
+	// TRANSACTION <n> <command with n-1 arguments> <n> ...
+	transactionEntry = "TRANSACTION"
+
+	queuedReply = "QUEUED"
+)
+
+var (
+	ErrTxUnsupported       = errors.New("the connection does not support the transactions")
+	ErrNestedMulti         = errors.New("MULTI calls can not be nested")
+	ErrExecWithoutMulti    = errors.New("EXEC without MULTI")
+	ErrDiscardWithoutMulti = errors.New("DISCARD without MULTI")
+	ErrWatchInMulti        = errors.New("WATCH inside MULTI is not allowed")
+	ErrNotAllowedInMulti   = errors.New("the command is not allowed in a transaction")
+	ErrExecAbort           = errors.New("transaction discarded because of previous errors")
+	ErrInvalidTransaction  = errors.New("invalid transaction entry")
+)
+
+// transaction is the reply of EXEC, the commands are executed by the handler
+type transaction struct {
+	bodies [][][]byte
+	// nil if the keys are not watched, e.g. on replay
+	tx *session.Tx
+
+	// nil if a watched key was changed
+	replies []interface{}
+	// the writes passed to the success hooks: a single write as is,
+	// several ones as a transaction entry, nil entry if there are none
+	flag    int
+	entry   [][]byte
+	written interface{}
+}
+
+func (self *transaction) reply() interface{} {
+	if self.replies == nil {
+		return nil
+	}
+	return self.replies
+}
+
+// the entry of the writes passed to the success hooks: a single write as is,
+// several ones as a transaction entry, nil if there are none
+func writtenEntry(bodies [][][]byte, replies []interface{}) ([][]byte, interface{}) {
+	switch len(bodies) {
+	case 0:
+		return nil, nil
+	case 1:
+		return bodies[0], replies[0]
+	default:
+		return encodeTransaction(bodies), replies
+	}
+}
+
+func encodeTransaction(bodies [][][]byte) [][]byte {
+	entry := [][]byte{[]byte(transactionEntry)}
+	for _, body := range bodies {
+		entry = append(entry, []byte(strconv.Itoa(len(body))))
+		entry = append(entry, body...)
+	}
+	return entry
+}
+
+func decodeTransaction(entry [][]byte) ([][][]byte, error) {
+	var bodies [][][]byte
+	for i := 1; i < len(entry); {
+		n, err := strconv.Atoi(string(entry[i]))
+		if err != nil || n < 1 || i+1+n > len(entry) {
+			return nil, ErrInvalidTransaction
+		}
+		bodies = append(bodies, entry[i+1:i+1+n])
+		i += 1 + n
+	}
+	return bodies, nil
+}
+
+func isTransaction(body [][]byte) bool {
+	return len(body) > 0 && string(body[0]) == transactionEntry
+}
+
+type TransactionCommand struct{}
+
+func (self *TransactionCommand) tx(s session.Session) (*session.Tx, error) {
+	tx := session.Transaction(s)
+	if tx == nil {
+		return nil, ErrTxUnsupported
+	}
+	return tx, nil
+}
+
+func (self *TransactionCommand) Multi(s session.Session) (interface{}, error) {
+	tx, err := self.tx(s)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.Begin() {
+		return nil, ErrNestedMulti
+	}
+	return true, nil
+}
+
+func (self *TransactionCommand) Exec(s session.Session) (interface{}, error) {
+	tx, err := self.tx(s)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.Multi() {
+		return nil, ErrExecWithoutMulti
+	}
+	bodies, ok := tx.Take()
+	if !ok {
+		tx.Unwatch()
+		return nil, ErrExecAbort
+	}
+	return &transaction{bodies: bodies, tx: tx}, nil
+}
+
+func (self *TransactionCommand) Discard(s session.Session) (interface{}, error) {
+	tx, err := self.tx(s)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.Multi() {
+		return nil, ErrDiscardWithoutMulti
+	}
+	tx.Discard()
+	return true, nil
+}
+
+// WATCH key [key ...] aborts the next EXEC if the keys are changed meanwhile
+func (self *TransactionCommand) Watch(s session.Session, key core.StrValue, keys ...core.StrValue) (interface{}, error) {
+	tx, err := self.tx(s)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Multi() {
+		return nil, ErrWatchInMulti
+	}
+	w, err := s.Storage().Watch(append([]core.StrValue{key}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	tx.Watch(w)
+	return true, nil
+}
+
+func (self *TransactionCommand) Unwatch(s session.Session) (interface{}, error) {
+	tx, err := self.tx(s)
+	if err != nil {
+		return nil, err
+	}
+	tx.Unwatch()
+	return true, nil
+}
+
+// Transaction replays the journal entry of a transaction
+func (self *TransactionCommand) Transaction(s session.Session, entry ...core.Value) (interface{}, error) {
+	body := make([][]byte, len(entry)+1)
+	body[0] = []byte(transactionEntry)
+	for i, v := range entry {
+		body[i+1] = []byte(v)
+	}
+	bodies, err := decodeTransaction(body)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{bodies: bodies}, nil
+}
+
+func NewTransactionCommand() *TransactionCommand {
+	return &TransactionCommand{}
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/storage"
+)
+
+func Test_decodeTransaction(t *testing.T) {
+	bodies := [][][]byte{
+		{[]byte("SET"), []byte("a"), []byte("1")},
+		{[]byte("DEL"), []byte("b")},
+	}
+	got, err := decodeTransaction(encodeTransaction(bodies))
+	if err != nil || !reflect.DeepEqual(got, bodies) {
+		t.Errorf("decodeTransaction() = %q, %v", got, err)
+	}
+	for _, entry := range [][]string{{"TRANSACTION", "x"}, {"TRANSACTION", "0"}, {"TRANSACTION", "3", "SET", "a"}} {
+		body := make([][]byte, len(entry))
+		for i, e := range entry {
+			body[i] = []byte(e)
+		}
+		if _, err := decodeTransaction(body); err != ErrInvalidTransaction {
+			t.Errorf("decodeTransaction(%q) error = %v", entry, err)
+		}
+	}
+}
+
+func Test_Transaction(t *testing.T) {
+	h, base := newTestHandler()
+	var entries [][][]byte
+	h.AddSuccessHook(func(flag int, body [][]byte, reply interface{}) <-chan error {
+		if !CheckFlag(flag, NonJournalableFlag) {
+			entries = append(entries, body)
+		}
+		return nil
+	})
+	serveHandler(t, h)
+	s, other := session.WithAuth(base), session.WithAuth(base)
+
+	if _, err := request(h, base, "MULTI"); err != ErrTxUnsupported {
+		t.Errorf("MULTI without a connection error = %v, want %v", err, ErrTxUnsupported)
+	}
+	mustRequest(t, h, s, "MULTI")
+	for _, args := range [][]string{{"SET", "a", "1"}, {"INCR", "a"}, {"LPUSH", "a", "x"}, {"GET", "a"}} {
+		if got := mustRequest(t, h, s, args...); got != queuedReply {
+			t.Errorf("%v = %v, want %v", args, got, queuedReply)
+		}
+	}
+	want := []interface{}{true, core.IntValue(2), ErrWrongType, core.Value("2")}
+	if got := mustRequest(t, h, s, "EXEC"); !reflect.DeepEqual(got, want) {
+		t.Errorf("EXEC = %v, want %v", got, want)
+	}
+	// the writes are passed to the hooks as a single entry
+	wantEntry := encodeTransaction([][][]byte{
+		{[]byte("SET"), []byte("a"), []byte("1")},
+		{[]byte("INCR"), []byte("a")},
+	})
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0], wantEntry) {
+		t.Errorf("hook entries = %q, want %q", entries, wantEntry)
+	}
+
+	// PSYNC waits for the writes, so it cannot hold the shards locked
+	mustRequest(t, h, s, "MULTI")
+	if _, err := request(h, s, "PSYNC", "id", "0", "follower"); err != ErrNotAllowedInMulti {
+		t.Errorf("PSYNC in MULTI error = %v, want %v", err, ErrNotAllowedInMulti)
+	}
+	mustRequest(t, h, s, "DISCARD")
+
+	// a command failed to be queued discards the transaction
+	mustRequest(t, h, s, "MULTI")
+	mustRequest(t, h, s, "SET", "a", "3")
+	if _, err := request(h, s, "SAVE"); err != ErrNotAllowedInMulti {
+		t.Errorf("SAVE in MULTI error = %v, want %v", err, ErrNotAllowedInMulti)
+	}
+	if _, err := request(h, s, "EXEC"); err != ErrExecAbort {
+		t.Errorf("EXEC error = %v, want %v", err, ErrExecAbort)
+	}
+
+	// the watched key written by the other connection aborts EXEC
+	mustRequest(t, h, s, "WATCH", "a")
+	mustRequest(t, h, other, "SET", "a", "4")
+	mustRequest(t, h, s, "MULTI")
+	mustRequest(t, h, s, "SET", "a", "5")
+	if got := mustRequest(t, h, s, "EXEC"); got != nil {
+		t.Errorf("EXEC of the changed key = %v, want nil", got)
+	}
+	mustRequest(t, h, s, "WATCH", "a")
+	mustRequest(t, h, other, "SET", "b", "4")
+	mustRequest(t, h, s, "MULTI")
+	mustRequest(t, h, s, "SET", "a", "5")
+	if got := mustRequest(t, h, s, "EXEC"); !reflect.DeepEqual(got, []interface{}{true}) {
+		t.Errorf("EXEC = %v", got)
+	}
+
+	// the entry is replayed as a transaction
+	replayed := session.WithStorage(session.New(), storage.New(nil))
+	execute(t, h, replayed, toStrings(wantEntry)...)
+	if got := execute(t, h, replayed, "GET", "a"); !reflect.DeepEqual(got, core.Value("2")) {
+		t.Errorf("replayed GET = %v, want 2", got)
+	}
+}
+
+func Test_Transaction_Entry(t *testing.T) {
+	h, s := newTestHandler()
+	serveHandler(t, h)
+	if _, err := request(h, s, "TRANSACTION", "3", "SET", "a", "1"); err != ErrInternalCommand {
+		t.Errorf("TRANSACTION of a client error = %v, want %v", err, ErrInternalCommand)
+	}
+	// the commands which are not queued are not executed by the entry either
+	got := mustRequest(t, h, session.WithReplication(s), "TRANSACTION", "1", "SAVE", "3", "SET", "a", "1")
+	if want := []interface{}{ErrNotAllowedInMulti, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TRANSACTION of the leader = %v, want %v", got, want)
+	}
+}
+
+func toStrings(body [][]byte) []string {
+	ret := make([]string, len(body))
+	for i, b := range body {
+		ret[i] = string(b)
+	}
+	return ret
+}
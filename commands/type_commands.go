@@ -2,6 +2,10 @@ package commands
 
 import (
 	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/auvn/go.cache/core"
 	"github.com/auvn/go.cache/session"
@@ -11,8 +15,51 @@ import (
 
 var (
 	ErrForbidden = errors.New("forbidden")
+
+	ErrNotInteger    = errors.New("value is not an integer or out of range")
+	ErrNotFloat      = errors.New("value is not a valid float")
+	ErrIncrOverflow  = errors.New("increment or decrement would overflow")
+	ErrIncrNotFinite = errors.New("increment would produce NaN or Infinity")
+
+	ErrSyntax            = errors.New("syntax error")
+	ErrNoSuchKey         = errors.New("no such key")
+	ErrIndexOutOfRange   = errors.New("index out of range")
+	ErrInvalidExpireTime = errors.New("invalid expire time")
 )
 
+// adds delta to the integer stored in the value
+func incrInt(value core.Value, delta core.IntValue) (core.IntValue, error) {
+	current, err := value.Int()
+	if err != nil {
+		return core.EmptyIntValue, ErrNotInteger
+	}
+	if (delta > 0 && current > math.MaxInt-delta) || (delta < 0 && current < math.MinInt-delta) {
+		return core.EmptyIntValue, ErrIncrOverflow
+	}
+	return current + delta, nil
+}
+
+// adds delta to the float stored in the value
+func incrFloat(value core.Value, delta core.FloatValue) (core.FloatValue, error) {
+	current, err := value.Float()
+	if err != nil || math.IsNaN(current.Value()) {
+		return core.EmptyFloatValue, ErrNotFloat
+	}
+	next := current + delta
+	if math.IsNaN(next.Value()) || math.IsInf(next.Value(), 0) {
+		return core.EmptyFloatValue, ErrIncrNotFinite
+	}
+	return next, nil
+}
+
+func intValue(i core.IntValue) core.Value {
+	return core.Value(strconv.Itoa(i.Value()))
+}
+
+func floatValue(f core.FloatValue) core.Value {
+	return core.Value(f.String())
+}
+
 type SecurityCommand string
 
 func (self *SecurityCommand) Auth(s session.Session, pass core.StrValue) (interface{}, error) {
@@ -34,7 +81,7 @@ func NewSecurityCommand(pass string) *SecurityCommand {
 type StorageCommand struct{}
 
 func (self *StorageCommand) Del(s session.Session, keys ...core.StrValue) (interface{}, error) {
-	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
 		var counter int
 		for _, k := range keys {
 			if w.Delete(k) {
@@ -42,18 +89,79 @@ func (self *StorageCommand) Del(s session.Session, keys ...core.StrValue) (inter
 			}
 		}
 		return counter, nil
-	})
+	}, keys...)
 }
 
 func (self *StorageCommand) Expire(s session.Session, key core.StrValue, ttl core.IntValue) (interface{}, error) {
-	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
 		return w.SetTTL(key, ttl), nil
-	})
+	}, key)
+}
+func (self *StorageCommand) PExpire(s session.Session, key core.StrValue, ttl core.IntValue) (interface{}, error) {
+	if time.Duration(ttl) > storage.MaxTTL/time.Millisecond {
+		return nil, ErrInvalidExpireTime
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		return w.SetDeadline(key, w.TimeNow().Add(time.Duration(ttl)*time.Millisecond)), nil
+	}, key)
 }
+
+// the deadline of the unix timestamp in the units, the deadlines later than the
+// longest TTL are rejected, so they are written as milliseconds without overflow
+func unixDeadline(timestamp core.IntValue, unit time.Duration) (time.Time, error) {
+	perSecond := int64(time.Second / unit)
+	ts := int64(timestamp)
+	latest := time.Now().Add(storage.MaxTTL)
+	// the seconds are checked first, time.Unix overflows for the huge ones
+	if ts/perSecond > latest.Unix() {
+		return time.Time{}, ErrInvalidExpireTime
+	}
+	deadline := time.Unix(ts/perSecond, (ts%perSecond)*int64(unit)).UTC()
+	if deadline.After(latest) {
+		return time.Time{}, ErrInvalidExpireTime
+	}
+	return deadline, nil
+}
+
+func (self *StorageCommand) expireAt(s session.Session, key core.StrValue, timestamp core.IntValue, unit time.Duration) (interface{}, error) {
+	deadline, err := unixDeadline(timestamp, unit)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		return w.SetDeadline(key, deadline), nil
+	}, key)
+}
+
+// EXPIREAT key unix-time-seconds
+func (self *StorageCommand) ExpireAt(s session.Session, key core.StrValue, timestamp core.IntValue) (interface{}, error) {
+	return self.expireAt(s, key, timestamp, time.Second)
+}
+
+// PEXPIREAT key unix-time-milliseconds
+func (self *StorageCommand) PExpireAt(s session.Session, key core.StrValue, timestamp core.IntValue) (interface{}, error) {
+	return self.expireAt(s, key, timestamp, time.Millisecond)
+}
+
+func (self *StorageCommand) Persist(s session.Session, key core.StrValue) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		return w.Persist(key), nil
+	}, key)
+}
+
 func (self *StorageCommand) TTL(s session.Session, key core.StrValue) (interface{}, error) {
 	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
 		return r.TTL(key), nil
-	})
+	}, key)
+}
+
+func (self *StorageCommand) PTTL(s session.Session, key core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		return r.PTTL(key), nil
+	}, key)
 }
 
 func (self *StorageCommand) Keys(s session.Session) (interface{}, error) {
@@ -64,6 +172,24 @@ func (self *StorageCommand) Keys(s session.Session) (interface{}, error) {
 	)
 }
 
+// storage statistics as name/value pairs
+func (self *StorageCommand) Info(s session.Session) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		stats := r.Stats()
+		return []interface{}{
+			"keys", stats.Keys,
+			"expires", stats.Expires,
+			"expired_keys", stats.ExpiredKeys,
+			"active_expired_keys", stats.ActiveExpiredKeys,
+			"expire_cycles", stats.ExpireCycles,
+			"expired_fields", stats.ExpiredFields,
+			"used_memory", stats.UsedMemory,
+			"maxmemory", stats.MaxMemory,
+			"evicted_keys", stats.EvictedKeys,
+		}, nil
+	})
+}
+
 func NewStorageCommand() *StorageCommand {
 	return new(StorageCommand)
 }
@@ -78,15 +204,124 @@ func (self *StringCommand) cast(v interface{}) (types.String, error) {
 	}
 }
 
-func (self *StringCommand) Set(s session.Session, key core.StrValue, value core.Value) (interface{}, error) {
+// SET key value [NX|XX] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds] [GET]
+type SetOptions struct {
+	NX       bool // only if the key does not exist
+	XX       bool // only if the key exists
+	Get      bool // return the old value instead of the status
+	TTL      time.Duration
+	Deadline time.Time
+}
+
+func (self *SetOptions) expirySet() bool {
+	return self.TTL != 0 || !self.Deadline.IsZero()
+}
+
+func (self *SetOptions) parseTTL(iter ArgumentsIterator, unit time.Duration) error {
+	if self.expirySet() {
+		return ErrSyntax
+	}
+	ttl, err := iter.NextInt()
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 || time.Duration(ttl) > storage.MaxTTL/unit {
+		return ErrInvalidExpireTime
+	}
+	self.TTL = time.Duration(ttl) * unit
+	return nil
+}
+
+func (self *SetOptions) parseDeadline(iter ArgumentsIterator, unit time.Duration) error {
+	if self.expirySet() {
+		return ErrSyntax
+	}
+	timestamp, err := iter.NextInt()
+	if err != nil {
+		return err
+	}
+	if timestamp <= 0 {
+		return ErrInvalidExpireTime
+	}
+	self.Deadline, err = unixDeadline(timestamp, unit)
+	return err
+}
+
+func (self *SetOptions) ParseArguments(iter ArgumentsIterator) error {
+	for iter.HasNext() {
+		option, err := iter.NextStr()
+		if err != nil {
+			return err
+		}
+		switch strings.ToUpper(option.Value()) {
+		case "NX":
+			self.NX = true
+		case "XX":
+			self.XX = true
+		case "GET":
+			self.Get = true
+		case "EX":
+			err = self.parseTTL(iter, time.Second)
+		case "PX":
+			err = self.parseTTL(iter, time.Millisecond)
+		case "EXAT":
+			err = self.parseDeadline(iter, time.Second)
+		case "PXAT":
+			err = self.parseDeadline(iter, time.Millisecond)
+		default:
+			err = ErrSyntax
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if self.NX && self.XX {
+		return ErrSyntax
+	}
+	return nil
+}
+
+func (self *StringCommand) set(s session.Session, key core.StrValue, value core.Value, opts *SetOptions) (interface{}, error) {
 	return s.Storage().Write(
 		func(w storage.Writer) (interface{}, error) {
-			w.Set(key, types.NewString(value))
-			return true, nil
+			var old interface{}
+			current, exists := w.Get(key)
+			if exists && opts.Get {
+				str, err := self.cast(current)
+				if err != nil {
+					return nil, err
+				}
+				old = str.Get()
+			}
+
+			set := !(opts.NX && exists) && !(opts.XX && !exists)
+			if set {
+				w.Set(key, types.NewString(value))
+				if opts.TTL > 0 {
+					w.SetDeadline(key, w.TimeNow().Add(opts.TTL))
+				} else if !opts.Deadline.IsZero() {
+					// a passed deadline removes the key at once
+					w.SetDeadline(key, opts.Deadline)
+				}
+			}
+
+			if opts.Get {
+				return old, nil
+			}
+			return set, nil
 		},
+		key,
 	)
 }
 
+func (self *StringCommand) Set(s session.Session, key core.StrValue, value core.Value, opts *SetOptions) (interface{}, error) {
+	return self.set(s, key, value, opts)
+}
+
+func (self *StringCommand) GetSet(s session.Session, key core.StrValue, value core.Value) (interface{}, error) {
+	return self.set(s, key, value, &SetOptions{Get: true})
+}
+
 func (self *StringCommand) Get(s session.Session, key core.StrValue) (interface{}, error) {
 	return s.Storage().Read(
 		func(r storage.Reader) (interface{}, error) {
@@ -99,9 +334,75 @@ func (self *StringCommand) Get(s session.Session, key core.StrValue) (interface{
 			}
 			return nil, nil
 		},
+		key,
 	)
 }
 
+// stored value of the string with the key, "0" if the key is missing
+func (self *StringCommand) value(r storage.Reader, key core.StrValue) (types.String, core.Value, error) {
+	if value, ok := r.Get(key); ok {
+		str, err := self.cast(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		return str, str.Get(), nil
+	}
+	return nil, core.Value("0"), nil
+}
+
+func (self *StringCommand) store(w storage.Writer, key core.StrValue, str types.String, value core.Value) {
+	if str == nil {
+		w.Set(key, types.NewString(value))
+	} else {
+		str.Set(value)
+	}
+}
+
+func (self *StringCommand) IncrBy(s session.Session, key core.StrValue, delta core.IntValue) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		str, value, err := self.value(w, key)
+		if err != nil {
+			return nil, err
+		}
+		next, err := incrInt(value, delta)
+		if err != nil {
+			return nil, err
+		}
+		self.store(w, key, str, intValue(next))
+		return next, nil
+	}, key)
+}
+
+func (self *StringCommand) DecrBy(s session.Session, key core.StrValue, delta core.IntValue) (interface{}, error) {
+	if delta == math.MinInt {
+		return nil, ErrIncrOverflow
+	}
+	return self.IncrBy(s, key, -delta)
+}
+
+func (self *StringCommand) Incr(s session.Session, key core.StrValue) (interface{}, error) {
+	return self.IncrBy(s, key, 1)
+}
+
+func (self *StringCommand) Decr(s session.Session, key core.StrValue) (interface{}, error) {
+	return self.IncrBy(s, key, -1)
+}
+
+func (self *StringCommand) IncrByFloat(s session.Session, key core.StrValue, delta core.FloatValue) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		str, value, err := self.value(w, key)
+		if err != nil {
+			return nil, err
+		}
+		next, err := incrFloat(value, delta)
+		if err != nil {
+			return nil, err
+		}
+		self.store(w, key, str, floatValue(next))
+		return next, nil
+	}, key)
+}
+
 func NewStringCommand() *StringCommand {
 	return new(StringCommand)
 }
@@ -130,7 +431,7 @@ func (self *HashCommand) Set(s session.Session, key core.StrValue, hashKey core.
 			w.Set(key, h)
 		}
 		return h.Set(hashKey, hashValue), nil
-	})
+	}, key)
 
 }
 
@@ -147,19 +448,24 @@ func (self *HashCommand) Get(s session.Session, key core.StrValue, hashKey core.
 			}
 		}
 		return nil, nil
-	})
+	}, key)
 }
 
 func (self *HashCommand) Del(s session.Session, key core.StrValue, hashKeys ...core.StrValue) (interface{}, error) {
-	return s.Storage().Write(
+	return s.Storage().Free(
 		func(w storage.Writer) (interface{}, error) {
 			if value, ok := w.Get(key); ok {
 				if h, err := self.cast(value); err == nil {
-					return h.Del(hashKeys...), nil
+					deleted := h.Del(hashKeys...)
+					if h.Len() == 0 {
+						w.Delete(key)
+					}
+					return deleted, nil
 				}
 			}
 			return nil, nil
 		},
+		key,
 	)
 }
 
@@ -173,9 +479,270 @@ func (self *HashCommand) Keys(s session.Session, key core.StrValue) (interface{}
 			}
 			return nil, nil
 		},
+		key,
 	)
 }
 
+// gets the hash of the key for a write, creates it if there is no hash
+func (self *HashCommand) getOrCreate(w storage.Writer, key core.StrValue) (types.Hash, error) {
+	if value, ok := w.Get(key); ok {
+		return self.cast(value)
+	}
+	h := types.NewHash()
+	w.Set(key, h)
+	return h, nil
+}
+
+// reads the hash of the key, nil if there is no hash
+func (self *HashCommand) read(s session.Session, key core.StrValue, fn func(h types.Hash) interface{}) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		value, ok := r.Get(key)
+		if !ok {
+			return fn(nil), nil
+		}
+		h, err := self.cast(value)
+		if err != nil {
+			return nil, err
+		}
+		return fn(h), nil
+	}, key)
+}
+
+// HMSET key hashKey value [hashKey value ...]
+func (self *HashCommand) MSet(s session.Session, key core.StrValue, hashKey core.StrValue, hashValue core.Value, pairs ...core.Value) (interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, ErrNumberOfArguments
+	}
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		h, err := self.getOrCreate(w, key)
+		if err != nil {
+			return nil, err
+		}
+		h.Set(hashKey, hashValue)
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(core.StrValue(pairs[i]), pairs[i+1])
+		}
+		return true, nil
+	}, key)
+}
+
+// HMGET key hashKey [hashKey ...] replies nil for the missing keys
+func (self *HashCommand) MGet(s session.Session, key core.StrValue, hashKeys ...core.StrValue) (interface{}, error) {
+	return self.read(s, key, func(h types.Hash) interface{} {
+		values := make([]interface{}, len(hashKeys))
+		for i, k := range hashKeys {
+			if h == nil {
+				continue
+			}
+			if v, ok := h.Get(k); ok {
+				values[i] = v
+			}
+		}
+		return values
+	})
+}
+
+// HGETALL key replies with the keys followed by their values
+func (self *HashCommand) GetAll(s session.Session, key core.StrValue) (interface{}, error) {
+	return self.read(s, key, func(h types.Hash) interface{} {
+		if h == nil {
+			return nil
+		}
+		keys := h.Keys()
+		pairs := make([]core.Value, 0, 2*len(keys))
+		for _, k := range keys {
+			v, _ := h.Get(k)
+			pairs = append(pairs, core.Value(k), v)
+		}
+		return pairs
+	})
+}
+
+func (self *HashCommand) Vals(s session.Session, key core.StrValue) (interface{}, error) {
+	return self.read(s, key, func(h types.Hash) interface{} {
+		if h == nil {
+			return nil
+		}
+		return h.Values()
+	})
+}
+
+func (self *HashCommand) Len(s session.Session, key core.StrValue) (interface{}, error) {
+	return self.read(s, key, func(h types.Hash) interface{} {
+		if h == nil {
+			return core.IntValue(0)
+		}
+		return h.Len()
+	})
+}
+
+func (self *HashCommand) Exists(s session.Session, key core.StrValue, hashKey core.StrValue) (interface{}, error) {
+	return self.read(s, key, func(h types.Hash) interface{} {
+		if h == nil {
+			return false
+		}
+		_, ok := h.Get(hashKey)
+		return ok
+	})
+}
+
+// HSETNX key hashKey value sets the value only if there is no hash key
+func (self *HashCommand) SetNX(s session.Session, key core.StrValue, hashKey core.StrValue, hashValue core.Value) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		h, err := self.getOrCreate(w, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := h.Get(hashKey); ok {
+			return false, nil
+		}
+		return h.Set(hashKey, hashValue), nil
+	}, key)
+}
+
+func (self *HashCommand) IncrBy(s session.Session, key core.StrValue, hashKey core.StrValue, delta core.IntValue) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		var h types.Hash
+		var err error
+		value, exists := w.Get(key)
+		if exists {
+			if h, err = self.cast(value); err != nil {
+				return nil, err
+			}
+		} else {
+			h = types.NewHash()
+		}
+
+		current, ok := h.Get(hashKey)
+		if !ok {
+			current = core.Value("0")
+		}
+		next, err := incrInt(current, delta)
+		if err != nil {
+			return nil, err
+		}
+		h.Set(hashKey, intValue(next))
+		if !exists {
+			w.Set(key, h)
+		}
+		return next, nil
+	}, key)
+}
+
+// the replies of the hash key expiry commands for every key
+const (
+	hashKeyMissing core.IntValue = -2
+	hashKeyNoTTL   core.IntValue = -1
+	hashKeyUpdated core.IntValue = 1
+	hashKeyDeleted core.IntValue = 2
+)
+
+// gets the hash of the key for a write, nil if there is no hash
+func (self *HashCommand) get(w storage.Writer, key core.StrValue) (types.Hash, error) {
+	if value, ok := w.Get(key); ok {
+		return self.cast(value)
+	}
+	return nil, nil
+}
+
+// sets the deadline of the hash keys, the keys which deadline has passed are deleted
+func (self *HashCommand) expireAt(s session.Session, key core.StrValue, deadline time.Time, hashKeys []core.StrValue) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		h, err := self.get(w, key)
+		if err != nil {
+			return nil, err
+		}
+		expired := !deadline.After(w.TimeNow())
+		replies := make([]core.IntValue, len(hashKeys))
+		for i, k := range hashKeys {
+			if h == nil {
+				replies[i] = hashKeyMissing
+			} else if expired && h.Del(k) > 0 {
+				replies[i] = hashKeyDeleted
+			} else if !expired && h.SetDeadline(k, deadline) {
+				replies[i] = hashKeyUpdated
+			} else {
+				replies[i] = hashKeyMissing
+			}
+		}
+		// the hash without keys is the same as no hash
+		if h != nil && h.Len() == 0 {
+			w.Delete(key)
+		}
+		return replies, nil
+	}, key)
+}
+
+// HEXPIRE key seconds hashKey [hashKey ...]
+func (self *HashCommand) Expire(s session.Session, key core.StrValue, ttl core.IntValue, hashKey core.StrValue, hashKeys ...core.StrValue) (interface{}, error) {
+	if ttl < 0 || time.Duration(ttl) > storage.MaxTTL/time.Second {
+		return nil, ErrInvalidExpireTime
+	}
+	deadline := time.Now().UTC().Add(time.Duration(ttl) * time.Second)
+	return self.expireAt(s, key, deadline, append([]core.StrValue{hashKey}, hashKeys...))
+}
+
+// HPEXPIREAT key unix-time-milliseconds hashKey [hashKey ...]
+func (self *HashCommand) PExpireAt(s session.Session, key core.StrValue, timestamp core.IntValue, hashKey core.StrValue, hashKeys ...core.StrValue) (interface{}, error) {
+	if timestamp < 0 {
+		return nil, ErrInvalidExpireTime
+	}
+	deadline, err := unixDeadline(timestamp, time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	return self.expireAt(s, key, deadline, append([]core.StrValue{hashKey}, hashKeys...))
+}
+
+// HTTL key hashKey [hashKey ...] replies with the remaining seconds of every key
+func (self *HashCommand) TTL(s session.Session, key core.StrValue, hashKey core.StrValue, hashKeys ...core.StrValue) (interface{}, error) {
+	hashKeys = append([]core.StrValue{hashKey}, hashKeys...)
+	return self.read(s, key, func(h types.Hash) interface{} {
+		now := time.Now()
+		replies := make([]core.IntValue, len(hashKeys))
+		for i, k := range hashKeys {
+			if h == nil {
+				replies[i] = hashKeyMissing
+			} else if _, ok := h.Get(k); !ok {
+				replies[i] = hashKeyMissing
+			} else if deadline := h.Deadline(k); deadline.IsZero() {
+				replies[i] = hashKeyNoTTL
+			} else {
+				replies[i] = core.IntValue(deadline.Sub(now) / time.Second)
+			}
+		}
+		return replies
+	})
+}
+
+// HPERSIST key hashKey [hashKey ...]
+func (self *HashCommand) Persist(s session.Session, key core.StrValue, hashKey core.StrValue, hashKeys ...core.StrValue) (interface{}, error) {
+	hashKeys = append([]core.StrValue{hashKey}, hashKeys...)
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		h, err := self.get(w, key)
+		if err != nil {
+			return nil, err
+		}
+		replies := make([]core.IntValue, len(hashKeys))
+		for i, k := range hashKeys {
+			if h == nil {
+				replies[i] = hashKeyMissing
+			} else if _, ok := h.Get(k); !ok {
+				replies[i] = hashKeyMissing
+			} else if h.Persist(k) {
+				replies[i] = hashKeyUpdated
+			} else {
+				replies[i] = hashKeyNoTTL
+			}
+		}
+		// the keys expired meanwhile are removed by Persist
+		if h != nil && h.Len() == 0 {
+			w.Delete(key)
+		}
+		return replies, nil
+	}, key)
+}
+
 func NewHashCommand() *HashCommand {
 	return new(HashCommand)
 }
@@ -206,30 +773,35 @@ func (self *ListCommand) push(s session.Session, beginning bool, key core.StrVal
 		if beginning {
 			return l.LPush(values...), nil
 		} else {
-			return l.LPush(values...), nil
+			return l.RPush(values...), nil
 		}
-	})
+	}, key)
 }
 
 func (self *ListCommand) pop(s session.Session, beginning bool, key core.StrValue) (interface{}, error) {
-	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
 		var err error
 		var l types.List
 		if value, ok := w.Get(key); ok {
 			if l, err = self.cast(value); err != nil {
 				return nil, err
 			} else {
+				var v core.Value
+				var ok bool
 				if beginning {
-					v, _ := l.LPop()
-					return v, nil
+					v, ok = l.LPop()
 				} else {
-					v, _ := l.RPop()
-					return v, nil
+					v, ok = l.RPop()
 				}
+				// the empty list is the same as no list
+				if !ok {
+					return nil, nil
+				}
+				return v, nil
 			}
 		}
 		return nil, nil
-	})
+	}, key)
 }
 
 func (self *ListCommand) LPush(s session.Session, key core.StrValue, values ...core.Value) (interface{}, error) {
@@ -248,6 +820,202 @@ func (self *ListCommand) RPop(s session.Session, key core.StrValue) (interface{}
 	return self.pop(s, false, key)
 }
 
+// LLEN key
+func (self *ListCommand) LLen(s session.Session, key core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			l, err := self.cast(value)
+			if err != nil {
+				return nil, err
+			}
+			return l.Len(), nil
+		}
+		return core.IntValue(0), nil
+	}, key)
+}
+
+// LSET key index value
+func (self *ListCommand) LSet(s session.Session, key core.StrValue, index core.IntValue, value core.Value) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		v, ok := w.Get(key)
+		if !ok {
+			return nil, ErrNoSuchKey
+		}
+		l, err := self.cast(v)
+		if err != nil {
+			return nil, err
+		}
+		if !l.Set(index, value) {
+			return nil, ErrIndexOutOfRange
+		}
+		return true, nil
+	}, key)
+}
+
+// LINSERT key BEFORE|AFTER pivot value replies with the length of the list,
+// -1 if there is no pivot, 0 if there is no list
+func (self *ListCommand) LInsert(s session.Session, key core.StrValue, where core.StrValue, pivot, value core.Value) (interface{}, error) {
+	var before bool
+	switch strings.ToUpper(where.Value()) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+	default:
+		return nil, ErrSyntax
+	}
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		v, ok := w.Get(key)
+		if !ok {
+			return core.IntValue(0), nil
+		}
+		l, err := self.cast(v)
+		if err != nil {
+			return nil, err
+		}
+		return l.Insert(before, pivot, value), nil
+	}, key)
+}
+
+// LREM key count value
+func (self *ListCommand) LRem(s session.Session, key core.StrValue, count core.IntValue, value core.Value) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		v, ok := w.Get(key)
+		if !ok {
+			return core.IntValue(0), nil
+		}
+		l, err := self.cast(v)
+		if err != nil {
+			return nil, err
+		}
+		return l.Remove(count, value), nil
+	}, key)
+}
+
+// LTRIM key start stop replies false if there is no list
+func (self *ListCommand) LTrim(s session.Session, key core.StrValue, start, stop core.IntValue) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		v, ok := w.Get(key)
+		if !ok {
+			return false, nil
+		}
+		l, err := self.cast(v)
+		if err != nil {
+			return nil, err
+		}
+		l.Trim(start, stop)
+		return true, nil
+	}, key)
+}
+
+// pops an element of the source and pushes it to the destination within
+// a single write, so no one sees the element in neither of them
+func (self *ListCommand) move(s session.Session, source, destination core.StrValue, fromBeginning, toBeginning bool) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		value, ok := w.Get(source)
+		if !ok {
+			return nil, nil
+		}
+		src, err := self.cast(value)
+		if err != nil {
+			return nil, err
+		}
+		var dst types.List
+		if value, ok := w.Get(destination); ok {
+			if dst, err = self.cast(value); err != nil {
+				return nil, err
+			}
+		}
+		var v core.Value
+		if fromBeginning {
+			v, ok = src.LPop()
+		} else {
+			v, ok = src.RPop()
+		}
+		if !ok {
+			return nil, nil
+		}
+		if dst == nil {
+			dst = types.NewList()
+			w.Set(destination, dst)
+		}
+		if toBeginning {
+			dst.LPush(v)
+		} else {
+			dst.RPush(v)
+		}
+		return v, nil
+	}, source, destination)
+}
+
+// RPOPLPUSH source destination
+func (self *ListCommand) RPopLPush(s session.Session, source, destination core.StrValue) (interface{}, error) {
+	return self.move(s, source, destination, false, true)
+}
+
+func parseListEnd(where core.StrValue) (bool, error) {
+	switch strings.ToUpper(where.Value()) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, ErrSyntax
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func (self *ListCommand) LMove(s session.Session, source, destination, from, to core.StrValue) (interface{}, error) {
+	fromBeginning, err := parseListEnd(from)
+	if err != nil {
+		return nil, err
+	}
+	toBeginning, err := parseListEnd(to)
+	if err != nil {
+		return nil, err
+	}
+	return self.move(s, source, destination, fromBeginning, toBeginning)
+}
+
+func (self *ListCommand) blockingPop(beginning bool, key core.StrValue, args []core.Value) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, ErrNumberOfArguments
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	keys := []core.StrValue{key}
+	for _, arg := range args[:len(args)-1] {
+		keys = append(keys, core.StrValue(arg))
+	}
+	return &blockingPop{list: self, keys: keys, beginning: beginning, timeout: timeout}, nil
+}
+
+// BLPOP key [key ...] timeout pops the head of the first non-empty list,
+// the session is blocked until an element arrives or the timeout elapses
+func (self *ListCommand) BLPop(s session.Session, key core.StrValue, args ...core.Value) (interface{}, error) {
+	return self.blockingPop(true, key, args)
+}
+
+// BRPOP key [key ...] timeout
+func (self *ListCommand) BRPop(s session.Session, key core.StrValue, args ...core.Value) (interface{}, error) {
+	return self.blockingPop(false, key, args)
+}
+
+// BRPOPLPUSH source destination timeout
+func (self *ListCommand) BRPopLPush(s session.Session, source, destination core.StrValue, timeout core.Value) (interface{}, error) {
+	t, err := parseTimeout(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &blockingPop{
+		list:        self,
+		keys:        []core.StrValue{source},
+		move:        true,
+		destination: destination,
+		timeout:     t,
+	}, nil
+}
+
 func (self *ListCommand) LRange(s session.Session, key core.StrValue, start, stop core.IntValue) (interface{}, error) {
 	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
 		var l types.List
@@ -259,7 +1027,7 @@ func (self *ListCommand) LRange(s session.Session, key core.StrValue, start, sto
 			return l.Range(start, stop), nil
 		}
 		return nil, nil
-	})
+	}, key)
 }
 
 func (self *ListCommand) LIndex(s session.Session, key core.StrValue, index core.IntValue) (interface{}, error) {
@@ -273,9 +1041,281 @@ func (self *ListCommand) LIndex(s session.Session, key core.StrValue, index core
 			return l.Get(index), nil
 		}
 		return nil, nil
-	})
+	}, key)
 }
 
 func NewListCommand() *ListCommand {
 	return new(ListCommand)
 }
+
+type SortedSetCommand struct{}
+
+func (self *SortedSetCommand) cast(v interface{}) (types.SortedSet, error) {
+	if z, ok := v.(types.SortedSet); ok {
+		return z, nil
+	} else {
+		return nil, ErrWrongType
+	}
+}
+
+func (self *SortedSetCommand) items(pairs []core.Value) ([]types.SortedSetItem, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, ErrNumberOfArguments
+	}
+	items := make([]types.SortedSetItem, len(pairs)/2)
+	iter := NewArguments(pairs...).Iter()
+	for i, _ := range items {
+		score, err := iter.NextFloat()
+		if err != nil {
+			return nil, err
+		}
+		member, err := iter.NextStr()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = types.SortedSetItem{Member: member, Score: score}
+	}
+	return items, nil
+}
+
+func (self *SortedSetCommand) members(items []types.SortedSetItem) []core.StrValue {
+	members := make([]core.StrValue, len(items))
+	for i, item := range items {
+		members[i] = item.Member
+	}
+	return members
+}
+
+func (self *SortedSetCommand) Add(s session.Session, key core.StrValue, pairs ...core.Value) (interface{}, error) {
+	items, err := self.items(pairs)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		var z types.SortedSet
+		var err error
+		value, ok := w.Get(key)
+		if ok {
+			if z, err = self.cast(value); err != nil {
+				return nil, err
+			}
+		} else {
+			z = types.NewSortedSet()
+			w.Set(key, z)
+		}
+		var counter int
+		for _, item := range items {
+			if z.Add(item.Score, item.Member) {
+				counter += 1
+			}
+		}
+		return core.IntValue(counter), nil
+	}, key)
+}
+
+func (self *SortedSetCommand) Rem(s session.Session, key core.StrValue, members ...core.StrValue) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		if value, ok := w.Get(key); ok {
+			if z, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return z.Rem(members...), nil
+			}
+		}
+		return core.EmptyIntValue, nil
+	}, key)
+}
+
+func (self *SortedSetCommand) Score(s session.Session, key core.StrValue, member core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if z, err := self.cast(value); err != nil {
+				return nil, err
+			} else if score, ok := z.Score(member); ok {
+				return score, nil
+			}
+		}
+		return nil, nil
+	}, key)
+}
+
+func (self *SortedSetCommand) Rank(s session.Session, key core.StrValue, member core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if z, err := self.cast(value); err != nil {
+				return nil, err
+			} else if rank, ok := z.Rank(member); ok {
+				return rank, nil
+			}
+		}
+		return nil, nil
+	}, key)
+}
+
+func (self *SortedSetCommand) Card(s session.Session, key core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if z, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return z.Len(), nil
+			}
+		}
+		return core.EmptyIntValue, nil
+	}, key)
+}
+
+func (self *SortedSetCommand) Range(s session.Session, key core.StrValue, start, stop core.IntValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if z, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return self.members(z.Range(start, stop)), nil
+			}
+		}
+		return nil, nil
+	}, key)
+}
+
+func (self *SortedSetCommand) RangeByScore(s session.Session, key core.StrValue, min, max core.FloatValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if z, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return self.members(z.RangeByScore(min, max)), nil
+			}
+		}
+		return nil, nil
+	}, key)
+}
+
+func NewSortedSetCommand() *SortedSetCommand {
+	return new(SortedSetCommand)
+}
+
+type SetCommand struct{}
+
+func (self *SetCommand) cast(v interface{}) (types.Set, error) {
+	if set, ok := v.(types.Set); ok {
+		return set, nil
+	} else {
+		return nil, ErrWrongType
+	}
+}
+
+// collects sets stored with the keys, a missing key is treated as an empty set
+func (self *SetCommand) sets(r storage.Reader, keys []core.StrValue) ([]types.Set, error) {
+	sets := make([]types.Set, len(keys))
+	for i, k := range keys {
+		if value, ok := r.Get(k); ok {
+			set, err := self.cast(value)
+			if err != nil {
+				return nil, err
+			}
+			sets[i] = set
+		} else {
+			sets[i] = types.NewSet()
+		}
+	}
+	return sets, nil
+}
+
+func (self *SetCommand) algebra(s session.Session, fn func(...types.Set) []core.StrValue, keys []core.StrValue) (interface{}, error) {
+	if len(keys) == 0 {
+		return nil, ErrNumberOfArguments
+	}
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		sets, err := self.sets(r, keys)
+		if err != nil {
+			return nil, err
+		}
+		return fn(sets...), nil
+	}, keys...)
+}
+
+func (self *SetCommand) Add(s session.Session, key core.StrValue, members ...core.StrValue) (interface{}, error) {
+	return s.Storage().Write(func(w storage.Writer) (interface{}, error) {
+		var set types.Set
+		var err error
+		value, ok := w.Get(key)
+		if ok {
+			if set, err = self.cast(value); err != nil {
+				return nil, err
+			}
+		} else {
+			set = types.NewSet()
+			w.Set(key, set)
+		}
+		return set.Add(members...), nil
+	}, key)
+}
+
+func (self *SetCommand) Rem(s session.Session, key core.StrValue, members ...core.StrValue) (interface{}, error) {
+	return s.Storage().Free(func(w storage.Writer) (interface{}, error) {
+		if value, ok := w.Get(key); ok {
+			if set, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return set.Rem(members...), nil
+			}
+		}
+		return core.EmptyIntValue, nil
+	}, key)
+}
+
+func (self *SetCommand) IsMember(s session.Session, key core.StrValue, member core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if set, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return set.IsMember(member), nil
+			}
+		}
+		return false, nil
+	}, key)
+}
+
+func (self *SetCommand) Members(s session.Session, key core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if set, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return set.Members(), nil
+			}
+		}
+		return nil, nil
+	}, key)
+}
+
+func (self *SetCommand) Card(s session.Session, key core.StrValue) (interface{}, error) {
+	return s.Storage().Read(func(r storage.Reader) (interface{}, error) {
+		if value, ok := r.Get(key); ok {
+			if set, err := self.cast(value); err != nil {
+				return nil, err
+			} else {
+				return set.Len(), nil
+			}
+		}
+		return core.EmptyIntValue, nil
+	}, key)
+}
+
+func (self *SetCommand) Inter(s session.Session, keys ...core.StrValue) (interface{}, error) {
+	return self.algebra(s, types.SetInter, keys)
+}
+
+func (self *SetCommand) Union(s session.Session, keys ...core.StrValue) (interface{}, error) {
+	return self.algebra(s, types.SetUnion, keys)
+}
+
+func (self *SetCommand) Diff(s session.Session, keys ...core.StrValue) (interface{}, error) {
+	return self.algebra(s, types.SetDiff, keys)
+}
+
+func NewSetCommand() *SetCommand {
+	return new(SetCommand)
+}
@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/pubsub"
+	"github.com/auvn/go.cache/session"
+)
+
+func Test_incrInt(t *testing.T) {
+	type args struct {
+		value core.Value
+		delta core.IntValue
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    core.IntValue
+		wantErr error
+	}{
+		{
+			name: "Incr",
+			args: args{value: core.Value("10"), delta: 5},
+			want: 15,
+		},
+		{
+			name: "Decr",
+			args: args{value: core.Value("-10"), delta: -5},
+			want: -15,
+		},
+		{
+			name:    "NotInteger",
+			args:    args{value: core.Value("1.5"), delta: 1},
+			wantErr: ErrNotInteger,
+		},
+		{
+			name:    "Overflow",
+			args:    args{value: core.Value(strconv.Itoa(math.MaxInt)), delta: 1},
+			wantErr: ErrIncrOverflow,
+		},
+		{
+			name:    "Underflow",
+			args:    args{value: core.Value(strconv.Itoa(math.MinInt)), delta: -1},
+			wantErr: ErrIncrOverflow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := incrInt(tt.args.value, tt.args.delta)
+			if err != tt.wantErr {
+				t.Errorf("incrInt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("incrInt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_incrFloat(t *testing.T) {
+	type args struct {
+		value core.Value
+		delta core.FloatValue
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    core.FloatValue
+		wantErr error
+	}{
+		{
+			name: "Incr",
+			args: args{value: core.Value("10.5"), delta: 0.25},
+			want: 10.75,
+		},
+		{
+			name: "IntegerValue",
+			args: args{value: core.Value("3"), delta: -0.5},
+			want: 2.5,
+		},
+		{
+			name:    "NotFloat",
+			args:    args{value: core.Value("abc"), delta: 1},
+			wantErr: ErrNotFloat,
+		},
+		{
+			name:    "Infinity",
+			args:    args{value: core.Value("1"), delta: core.FloatValue(math.Inf(1))},
+			wantErr: ErrIncrNotFinite,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := incrFloat(tt.args.value, tt.args.delta)
+			if err != tt.wantErr {
+				t.Errorf("incrFloat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("incrFloat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_PubSubCommand(t *testing.T) {
+	h, base := newTestHandler()
+	serveHandler(t, h)
+	s := session.WithAuth(base)
+	sub := pubsub.NewSubscriber(0)
+	session.SetSubscriber(s, sub)
+
+	if _, err := request(h, base, "SUBSCRIBE", "a"); err != ErrPushUnsupported {
+		t.Errorf("SUBSCRIBE without push mode error = %v, want %v", err, ErrPushUnsupported)
+	}
+	want := []interface{}{"subscribe", 2}
+	if got := mustRequest(t, h, s, "SUBSCRIBE", "a", "b"); !reflect.DeepEqual(got, want) {
+		t.Errorf("SUBSCRIBE = %v, want %v", got, want)
+	}
+	mustRequest(t, h, s, "PSUBSCRIBE", "c*")
+	if _, err := request(h, s, "GET", "a"); err != ErrPushMode {
+		t.Errorf("GET in push mode error = %v, want %v", err, ErrPushMode)
+	}
+
+	if got := mustRequest(t, h, base, "PUBLISH", "c1", "x"); got != 1 {
+		t.Errorf("PUBLISH = %v, want 1", got)
+	}
+	m := <-sub.Messages()
+	if payload := m.Payload(); !reflect.DeepEqual(payload, []interface{}{"pmessage", "c*", "c1", []byte("x")}) {
+		t.Errorf("message = %v", payload)
+	}
+
+	mustRequest(t, h, s, "UNSUBSCRIBE")
+	want = []interface{}{"punsubscribe", 0}
+	if got := mustRequest(t, h, s, "PUNSUBSCRIBE", "c*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("PUNSUBSCRIBE = %v, want %v", got, want)
+	}
+	mustRequest(t, h, s, "GET", "a")
+}
+
+func Test_ListCommand(t *testing.T) {
+	h, s := newTestHandler()
+	list := func(key string) []core.Value {
+		got, _ := execute(t, h, s, "LRANGE", key, "0", "-1").([]core.Value)
+		return got
+	}
+	values := func(vs ...string) []core.Value {
+		ret := make([]core.Value, len(vs))
+		for i, v := range vs {
+			ret[i] = core.Value(v)
+		}
+		return ret
+	}
+
+	execute(t, h, s, "RPUSH", "l", "a", "b", "c")
+	execute(t, h, s, "LPUSH", "l", "z")
+	if got := list("l"); !reflect.DeepEqual(got, values("z", "a", "b", "c")) {
+		t.Errorf("RPUSH and LPUSH = %q", got)
+	}
+	execute(t, h, s, "LSET", "l", "-1", "x")
+	execute(t, h, s, "LINSERT", "l", "before", "b", "a")
+	execute(t, h, s, "LREM", "l", "-1", "a")
+	if got := list("l"); !reflect.DeepEqual(got, values("z", "a", "b", "x")) {
+		t.Errorf("LSET, LINSERT and LREM = %q", got)
+	}
+	execute(t, h, s, "LTRIM", "l", "1", "-1")
+	if got := execute(t, h, s, "LLEN", "l"); got != core.IntValue(3) {
+		t.Errorf("LLEN after LTRIM = %v, want 3", got)
+	}
+	if got := execute(t, h, s, "LMOVE", "l", "m", "LEFT", "RIGHT"); !reflect.DeepEqual(got, core.Value("a")) {
+		t.Errorf("LMOVE = %v, want a", got)
+	}
+	if got := execute(t, h, s, "RPOPLPUSH", "l", "m"); !reflect.DeepEqual(got, core.Value("x")) {
+		t.Errorf("RPOPLPUSH = %v, want x", got)
+	}
+	if got := list("m"); !reflect.DeepEqual(got, values("x", "a")) {
+		t.Errorf("destination = %q", got)
+	}
+	// rotates the list
+	execute(t, h, s, "RPOPLPUSH", "m", "m")
+	if got := list("m"); !reflect.DeepEqual(got, values("a", "x")) {
+		t.Errorf("rotated list = %q", got)
+	}
+
+	execute(t, h, s, "SET", "str", "1")
+	for _, args := range [][]string{
+		{"LSET", "missing", "0", "a"},
+		{"LSET", "l", "5", "a"},
+		{"LINSERT", "l", "inside", "b", "a"},
+		{"LMOVE", "l", "str", "LEFT", "LEFT"},
+	} {
+		resp := make(chan interface{}, 1)
+		body := make([][]byte, len(args))
+		for i, a := range args {
+			body[i] = []byte(a)
+		}
+		h.Handle(s, body, resp)
+		if _, ok := (<-resp).(error); !ok {
+			t.Errorf("%v did not fail", args)
+		}
+	}
+	// the element is not popped if it cannot be pushed
+	if got := list("l"); !reflect.DeepEqual(got, values("b")) {
+		t.Errorf("source after the failed LMOVE = %q", got)
+	}
+}
+
+func Test_HashCommand(t *testing.T) {
+	h, s := newTestHandler()
+	if got := execute(t, h, s, "HMSET", "h", "a", "1", "b", "2"); got != true {
+		t.Errorf("HMSET = %v, want true", got)
+	}
+	if got := execute(t, h, s, "HSETNX", "h", "a", "3"); got != false {
+		t.Errorf("HSETNX of the existing key = %v, want false", got)
+	}
+	if got := execute(t, h, s, "HSETNX", "h", "c", "3"); got != true {
+		t.Errorf("HSETNX = %v, want true", got)
+	}
+	want := []interface{}{core.Value("1"), nil, core.Value("3")}
+	if got := execute(t, h, s, "HMGET", "h", "a", "missing", "c"); !reflect.DeepEqual(got, want) {
+		t.Errorf("HMGET = %v, want %v", got, want)
+	}
+	pairs := map[string]string{}
+	all := execute(t, h, s, "HGETALL", "h").([]core.Value)
+	for i := 0; i+1 < len(all); i += 2 {
+		pairs[string(all[i])] = string(all[i+1])
+	}
+	if wantPairs := map[string]string{"a": "1", "b": "2", "c": "3"}; !reflect.DeepEqual(pairs, wantPairs) {
+		t.Errorf("HGETALL = %v, want %v", pairs, wantPairs)
+	}
+	if got := execute(t, h, s, "HVALS", "h"); len(got.([]core.Value)) != 3 {
+		t.Errorf("HVALS = %v", got)
+	}
+	if got := execute(t, h, s, "HLEN", "h"); got != core.IntValue(3) {
+		t.Errorf("HLEN = %v, want 3", got)
+	}
+	if got := execute(t, h, s, "HEXISTS", "h", "b"); got != true {
+		t.Errorf("HEXISTS = %v, want true", got)
+	}
+	if got := execute(t, h, s, "HLEN", "missing"); got != core.IntValue(0) {
+		t.Errorf("HLEN of the missing key = %v, want 0", got)
+	}
+	if got := execute(t, h, s, "HGETALL", "missing"); got != nil {
+		t.Errorf("HGETALL of the missing key = %v, want nil", got)
+	}
+
+	execute(t, h, s, "SET", "str", "1")
+	resp := make(chan interface{}, 1)
+	h.Handle(s, [][]byte{[]byte("HMSET"), []byte("h"), []byte("a")}, resp)
+	if err := <-resp; err != ErrNumberOfArguments {
+		t.Errorf("HMSET without a value error = %v, want %v", err, ErrNumberOfArguments)
+	}
+	h.Handle(s, [][]byte{[]byte("HGETALL"), []byte("str")}, resp)
+	if err := <-resp; err != ErrWrongType {
+		t.Errorf("HGETALL of a string error = %v, want %v", err, ErrWrongType)
+	}
+}
+
+func Test_HashCommand_Expire(t *testing.T) {
+	h, s := newTestHandler()
+	execute(t, h, s, "HMSET", "h", "a", "1", "b", "2", "c", "3")
+
+	ints := func(values ...int) []core.IntValue {
+		ret := make([]core.IntValue, len(values))
+		for i, v := range values {
+			ret[i] = core.IntValue(v)
+		}
+		return ret
+	}
+	if got, want := execute(t, h, s, "HEXPIRE", "h", "100", "a", "b", "missing"), ints(1, 1, -2); !reflect.DeepEqual(got, want) {
+		t.Errorf("HEXPIRE = %v, want %v", got, want)
+	}
+	if got, want := execute(t, h, s, "HTTL", "h", "a", "c", "missing"), ints(99, -1, -2); !reflect.DeepEqual(got, want) {
+		t.Errorf("HTTL = %v, want %v", got, want)
+	}
+	if got, want := execute(t, h, s, "HPERSIST", "h", "b", "c"), ints(1, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("HPERSIST = %v, want %v", got, want)
+	}
+	// the passed deadline deletes the key
+	if got, want := execute(t, h, s, "HEXPIRE", "h", "0", "c"), ints(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("HEXPIRE with zero TTL = %v, want %v", got, want)
+	}
+	if got, want := execute(t, h, s, "HTTL", "missing", "a"), ints(-2); !reflect.DeepEqual(got, want) {
+		t.Errorf("HTTL of the missing key = %v, want %v", got, want)
+	}
+
+	soon := strconv.FormatInt(time.Now().Add(50*time.Millisecond).UnixNano()/int64(time.Millisecond), 10)
+	execute(t, h, s, "HPEXPIREAT", "h", soon, "a")
+	time.Sleep(100 * time.Millisecond)
+	if got := execute(t, h, s, "HGET", "h", "a"); got != nil {
+		t.Errorf("HGET of the expired key = %v, want nil", got)
+	}
+	if got := execute(t, h, s, "HLEN", "h"); got != core.IntValue(1) {
+		t.Errorf("HLEN = %v, want 1", got)
+	}
+
+	resp := make(chan interface{}, 1)
+	h.Handle(s, [][]byte{[]byte("HEXPIRE"), []byte("h"), []byte("-1"), []byte("b")}, resp)
+	if err := <-resp; err != ErrInvalidExpireTime {
+		t.Errorf("HEXPIRE with negative TTL error = %v, want %v", err, ErrInvalidExpireTime)
+	}
+	for _, timestamp := range []string{"-1", "9223372036854775807"} {
+		h.Handle(s, [][]byte{[]byte("HPEXPIREAT"), []byte("h"), []byte(timestamp), []byte("b")}, resp)
+		if err := <-resp; err != ErrInvalidExpireTime {
+			t.Errorf("HPEXPIREAT %v error = %v, want %v", timestamp, err, ErrInvalidExpireTime)
+		}
+	}
+
+	// the hash goes away with its last key
+	execute(t, h, s, "HEXPIRE", "h", "0", "b")
+	if got := execute(t, h, s, "KEYS"); len(got.([]core.StrValue)) != 0 {
+		t.Errorf("KEYS with the expired hash = %v, want none", got)
+	}
+	execute(t, h, s, "HSET", "h", "a", "1")
+	execute(t, h, s, "HDEL", "h", "a")
+	if got := execute(t, h, s, "KEYS"); len(got.([]core.StrValue)) != 0 {
+		t.Errorf("KEYS with the emptied hash = %v, want none", got)
+	}
+}
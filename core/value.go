@@ -25,6 +25,11 @@ func (self Value) int(base int, bitSize int) (int64, error) {
 	return strconv.ParseInt(self.String(), base, bitSize)
 }
 
+func (self Value) Float() (FloatValue, error) {
+	f, err := strconv.ParseFloat(self.String(), 64)
+	return FloatValue(f), err
+}
+
 func (self Value) Bytes() []byte {
 	return []byte(self)
 }
@@ -35,6 +40,16 @@ func (self IntValue) Value() int {
 	return int(self)
 }
 
+type FloatValue float64
+
+func (self FloatValue) Value() float64 {
+	return float64(self)
+}
+
+func (self FloatValue) String() string {
+	return strconv.FormatFloat(float64(self), 'f', -1, 64)
+}
+
 type StrValue string
 
 func (self StrValue) Value() string {
@@ -50,7 +65,8 @@ func (self ValueArray) Value() []Value {
 }
 
 var (
-	EmptyIntValue = IntValue(0)
-	EmptyStrValue = StrValue("")
-	EmptyValue    = Value{}
+	EmptyIntValue   = IntValue(0)
+	EmptyFloatValue = FloatValue(0)
+	EmptyStrValue   = StrValue("")
+	EmptyValue      = Value{}
 )
@@ -8,9 +8,21 @@ const (
 	rollback        = 4
 
 	statusOffset int = 1 //byte
+
+	// the journal without the header and checksums
+	versionNoHeader byte = 1
+	version         byte = 2
+
+	crcSize = 4
+
+	// sanity limits, so a damaged length does not allocate all of the memory
+	MaxEntryLen     = 1 << 20   // items in an entry
+	MaxEntryItemLen = 512 << 20 // bytes in an item
 )
 
 var (
+	magic = []byte("GOCACHEJRNL")
+
 	emptyEntry     = [][]byte{}
 	emptyEntryItem = []byte{}
 
@@ -30,6 +42,10 @@ type Writer interface {
 type Journal interface {
 	Reader
 	Writer
+	// Sync flushes the committed entries to the disk.
+	Sync() error
+	Size() int64
+	Close() error
 }
 
 type emptyJournal bool
@@ -49,3 +65,15 @@ func (self emptyJournal) Rollback() error {
 func (self emptyJournal) Commit() error {
 	return nil
 }
+
+func (self emptyJournal) Sync() error {
+	return nil
+}
+
+func (self emptyJournal) Size() int64 {
+	return 0
+}
+
+func (self emptyJournal) Close() error {
+	return nil
+}
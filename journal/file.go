@@ -13,29 +13,74 @@ var (
 	filePerm      os.FileMode = 0666
 
 	ErrNonEmptyJournal = errors.New("the journal is not empty")
+
+	DefaultFileOptions = &FileOptions{}
 )
 
+type FileOptions struct {
+	// truncates the journal at the last valid entry instead of failing to read it
+	Recover bool
+}
+
 func openJournalFile(path string, flag int) (*os.File, error) {
 	return os.OpenFile(path, flag, filePerm)
 }
 
-func InitFile(path string) (Journal, error) {
+func InitFile(path string, opts *FileOptions) (Journal, error) {
+	if opts == nil {
+		opts = DefaultFileOptions
+	}
 	fileReader, err := openJournalFile(path, fileReadFlag)
 	if err != nil {
 		return nil, err
 	}
+	info, err := fileReader.Stat()
+	if err != nil {
+		fileReader.Close()
+		return nil, err
+	}
 	fileWriter, err := openJournalFile(path, fileWriteFlag)
 	if err != nil {
+		fileReader.Close()
 		return nil, err
 	}
-	jReader := &reader{r: fileReader}
-	jWriter := &writer{ws: fileWriter}
-	journal := &fileJournal{r: jReader, w: jWriter, wf: fileWriter}
+	jReader := NewLimitedReader(fileReader, info.Size())
+	jWriter := NewWriter(fileWriter)
+	journal := &fileJournal{r: jReader, w: jWriter, rf: fileReader, wf: fileWriter, opts: opts}
 	return journal, nil
 }
 
-func MustInitFile(path string) Journal {
-	if j, err := InitFile(path); err != nil {
+// CreateFile writes the entries into a new journal file at once and
+// returns the journal ready for appending.
+func CreateFile(path string, entries [][][]byte) (Journal, error) {
+	f, err := openJournalFile(path, fileFlag|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	jWriter := NewWriter(f)
+	if err := jWriter.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, e := range entries {
+		if err := jWriter.Write(e); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := jWriter.Commit(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileJournal{readerDone: true, r: NewReader(f), w: jWriter, wf: f, opts: DefaultFileOptions}, nil
+}
+
+func MustInitFile(path string, opts *FileOptions) Journal {
+	if j, err := InitFile(path, opts); err != nil {
 		log.Fatal("cannot init journal:", err)
 	} else {
 		return j
@@ -47,19 +92,57 @@ type fileJournal struct {
 	readerDone bool
 	r          *reader
 	w          *writer
+	rf         *os.File
 	wf         *os.File
+	opts       *FileOptions
+}
+
+// drops the damaged entry and everything after it
+func (self *fileJournal) truncate(err *CorruptedError) error {
+	log.Printf("%s, truncating %d bytes", err.Error(), self.r.size-err.Offset)
+	if err := self.wf.Truncate(err.Offset); err != nil {
+		return err
+	}
+	self.r.pos = err.Offset
+	if err.Offset == 0 {
+		// the header is damaged
+		self.r.version = version
+		self.r.header = false
+	}
+	return nil
+}
+
+// prepares the writer to append after the last read entry
+func (self *fileJournal) readDone() error {
+	self.w.version = self.r.version
+	if !self.r.header && self.r.version != versionNoHeader {
+		if err := self.w.writeHeader(); err != nil {
+			return err
+		}
+	} else if err := self.w.seekStart(self.r.pos); err != nil {
+		return err
+	}
+	self.readerDone = true
+	return nil
 }
 
 func (self *fileJournal) NextEntry() ([][]byte, error) {
-	if entry, err := self.r.NextEntry(); err != nil && err == ErrEmpty {
-		if werr := self.w.seekStart(self.r.pos); werr != nil {
+	entry, err := self.r.NextEntry()
+	if err == nil {
+		return entry, nil
+	}
+	if cerr, ok := err.(*CorruptedError); ok && self.opts.Recover {
+		if terr := self.truncate(cerr); terr != nil {
+			return emptyEntry, terr
+		}
+		err = ErrEmpty
+	}
+	if err == ErrEmpty {
+		if werr := self.readDone(); werr != nil {
 			return emptyEntry, werr
 		}
-		self.readerDone = true
-		return entry, err
-	} else {
-		return entry, nil
 	}
+	return emptyEntry, err
 }
 
 func (self *fileJournal) Write(e [][]byte) error {
@@ -74,11 +157,20 @@ func (self *fileJournal) Rollback() error {
 }
 
 func (self *fileJournal) Commit() error {
-	if err := self.w.Commit(); err != nil {
-		return err
-	}
-	if err := self.wf.Sync(); err != nil {
-		return err
+	return self.w.Commit()
+}
+
+func (self *fileJournal) Sync() error {
+	return self.wf.Sync()
+}
+
+func (self *fileJournal) Size() int64 {
+	return self.w.pos
+}
+
+func (self *fileJournal) Close() error {
+	if self.rf != nil {
+		self.rf.Close()
 	}
-	return nil
+	return self.wf.Close()
 }
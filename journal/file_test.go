@@ -0,0 +1,176 @@
+package journal
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempJournal(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "journal"), func() { os.RemoveAll(dir) }
+}
+
+func entries(values ...string) [][][]byte {
+	ret := make([][][]byte, len(values))
+	for i, v := range values {
+		ret[i] = [][]byte{[]byte("SET"), []byte(v), []byte(v)}
+	}
+	return ret
+}
+
+// reads all of the entries and appends the new ones
+func openJournal(t *testing.T, path string, opts *FileOptions, appended ...[][]byte) ([][][]byte, error) {
+	j, err := InitFile(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	ret := make([][][]byte, 0)
+	for {
+		entry, err := j.NextEntry()
+		if err == ErrEmpty {
+			break
+		} else if err != nil {
+			return ret, err
+		}
+		ret = append(ret, entry)
+	}
+	for _, entry := range appended {
+		if err := j.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ret, nil
+}
+
+func mustOpenJournal(t *testing.T, path string, opts *FileOptions, appended ...[][]byte) [][][]byte {
+	ret, err := openJournal(t, path, opts, appended...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func updateFile(t *testing.T, path string, fn func([]byte) []byte) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, fn(data), filePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_File(t *testing.T) {
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	mustOpenJournal(t, path, nil, entries("a", "b")...)
+	mustOpenJournal(t, path, nil, entries("c")...)
+	if got := mustOpenJournal(t, path, nil); !reflect.DeepEqual(got, entries("a", "b", "c")) {
+		t.Errorf("NextEntry() = %q", got)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data[:len(magic)]) != string(magic) || data[len(magic)] != version {
+		t.Errorf("the journal has no header: %q", data[:len(magic)+1])
+	}
+}
+
+func Test_File_NoHeader(t *testing.T) {
+	path, cleanup := tempJournal(t)
+	defer cleanup()
+
+	f, _ := os.Create(path)
+	w := &writer{ws: f, version: versionNoHeader}
+	for _, entry := range entries("a", "b") {
+		w.Write(entry)
+		w.Commit()
+	}
+	f.Close()
+
+	mustOpenJournal(t, path, nil, entries("c")...)
+	if got := mustOpenJournal(t, path, nil); !reflect.DeepEqual(got, entries("a", "b", "c")) {
+		t.Errorf("NextEntry() = %q", got)
+	}
+}
+
+func Test_File_Corrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func([]byte) []byte
+		reason error
+	}{
+		{
+			name: "checksum",
+			damage: func(data []byte) []byte {
+				data[len(data)-crcSize-2] ^= 0xff
+				return data
+			},
+			reason: ErrChecksumMismatch,
+		},
+		{
+			name: "length",
+			damage: func(data []byte) []byte {
+				// the length of the last item
+				binary.BigEndian.PutUint64(data[len(data)-crcSize-2-8:], 1<<40)
+				return data
+			},
+			reason: ErrInvalidLength,
+		},
+		{
+			name: "torn write",
+			damage: func(data []byte) []byte {
+				return data[:len(data)-crcSize-2]
+			},
+			reason: nil, // the length exceeds the rest of the journal or EOF
+		},
+		{
+			name: "header",
+			damage: func(data []byte) []byte {
+				data[1] = 'x'
+				return data
+			},
+			reason: ErrInvalidHeader,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cleanup := tempJournal(t)
+			defer cleanup()
+			mustOpenJournal(t, path, nil, entries("a", "b")...)
+			updateFile(t, path, tt.damage)
+
+			want := entries("a")
+			if tt.reason == ErrInvalidHeader {
+				want = entries()
+			}
+			got, err := openJournal(t, path, nil)
+			cerr, ok := err.(*CorruptedError)
+			if !ok {
+				t.Fatalf("NextEntry() error = %v, want corrupted", err)
+			}
+			if tt.reason != nil && cerr.Reason != tt.reason {
+				t.Errorf("NextEntry() error = %v, want %v", cerr.Reason, tt.reason)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("NextEntry() = %q, want %q", got, want)
+			}
+
+			opts := &FileOptions{Recover: true}
+			mustOpenJournal(t, path, opts, entries("c")...)
+			if got := mustOpenJournal(t, path, nil); !reflect.DeepEqual(got, append(want, entries("c")...)) {
+				t.Errorf("NextEntry() recovered = %q", got)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package journal
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 )
 
@@ -10,12 +15,36 @@ var (
 	ErrEmpty = errors.New("empty journal")
 	ErrEOF   = errors.New("end of journal")
 
+	ErrInvalidHeader      = errors.New("invalid header")
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	ErrInvalidStatus      = errors.New("invalid entry status")
+	ErrInvalidLength      = errors.New("invalid length")
+	ErrChecksumMismatch   = errors.New("checksum mismatch")
+
 	_ Reader = (*reader)(nil)
 )
 
+// CorruptedError is returned when the journal cannot be read past the offset.
+type CorruptedError struct {
+	Offset int64 // the start of the damaged entry
+	Reason error
+}
+
+func (self *CorruptedError) Error() string {
+	return fmt.Sprintf("journal is corrupted at offset %d: %s", self.Offset, self.Reason.Error())
+}
+
 type reader struct {
-	pos int64
-	r   io.Reader
+	pos  int64
+	size int64 // the size of the journal, negative if unknown
+	r    *bufio.Reader
+
+	version byte // zero until the header is read
+	header  bool // false if the journal is empty or has no header
+
+	// the offset of the last read entry
+	entryPos int64
+	crc      hash.Hash32
 }
 
 func (self *reader) readBytes(bs []byte) error {
@@ -24,6 +53,9 @@ func (self *reader) readBytes(bs []byte) error {
 		return err
 	}
 	self.pos += int64(len(bs))
+	if self.crc != nil {
+		self.crc.Write(bs)
+	}
 	return nil
 }
 
@@ -39,17 +71,46 @@ func (self *reader) readStatus() (byte, error) {
 	return statusValue[0], nil
 }
 
-func (self *reader) readLen() (int64, error) {
+func (self *reader) readHeader() error {
+	first, err := self.r.Peek(1)
+	if err == io.EOF {
+		self.version = version
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// the journal without the header starts with the status of an entry
+	if first[0] != magic[0] {
+		self.version = versionNoHeader
+		return nil
+	}
+	prefix := make([]byte, len(magic)+1)
+	if err := self.readBytes(prefix); err != nil || !bytes.Equal(prefix[:len(magic)], magic) {
+		return &CorruptedError{Offset: 0, Reason: ErrInvalidHeader}
+	}
+	if v := prefix[len(magic)]; v != version {
+		return &CorruptedError{Offset: 0, Reason: ErrUnsupportedVersion}
+	}
+	self.version = version
+	self.header = true
+	return nil
+}
+
+// reads the length which cannot exceed the limit and the rest of the journal
+func (self *reader) readLen(limit int64, itemSize int64) (int64, error) {
 	llenValue := make([]byte, 8)
 	if err := self.readBytes(llenValue); err != nil {
 		return 0, err
 	}
-	val := binary.BigEndian.Uint64(llenValue)
-	return int64(val), nil
+	val := int64(binary.BigEndian.Uint64(llenValue))
+	if val < 0 || val > limit || (self.size >= 0 && val > (self.size-self.pos)/itemSize) {
+		return 0, ErrInvalidLength
+	}
+	return val, nil
 }
 
 func (self *reader) readEntryItem() ([]byte, error) {
-	itemLen, err := self.readLen()
+	itemLen, err := self.readLen(MaxEntryItemLen, 1)
 	if err != nil {
 		return emptyEntryItem, err
 	}
@@ -61,7 +122,12 @@ func (self *reader) readEntryItem() ([]byte, error) {
 }
 
 func (self *reader) readEntry() ([][]byte, error) {
-	llen, err := self.readLen()
+	if self.version != versionNoHeader {
+		self.crc = crc32.NewIEEE()
+		defer func() { self.crc = nil }()
+	}
+	// every item takes at least its length
+	llen, err := self.readLen(MaxEntryLen, 8)
 	if err != nil {
 		return emptyEntry, err
 	}
@@ -73,21 +139,55 @@ func (self *reader) readEntry() ([][]byte, error) {
 			return emptyEntry, err
 		}
 	}
+	if self.crc != nil {
+		sum := self.crc.Sum32()
+		self.crc = nil
+		crcValue := make([]byte, crcSize)
+		if err := self.readBytes(crcValue); err != nil {
+			return emptyEntry, err
+		}
+		if binary.BigEndian.Uint32(crcValue) != sum {
+			return emptyEntry, ErrChecksumMismatch
+		}
+	}
 	return entry, nil
 }
 
+func (self *reader) corrupted(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &CorruptedError{Offset: self.entryPos, Reason: err}
+}
+
 func (self *reader) NextEntry() ([][]byte, error) {
+	if self.version == 0 {
+		if err := self.readHeader(); err != nil {
+			return emptyEntry, err
+		}
+	}
+	self.entryPos = self.pos
 	status, err := self.readStatus()
-	if err != nil && err != ErrEOF {
+	if err == ErrEOF {
+		return emptyEntry, ErrEmpty
+	} else if err != nil {
 		return emptyEntry, err
 	}
 
 	switch status {
 	case commited:
-		return self.readEntry()
-	default:
-		self.pos -= int64(statusOffset)
+		entry, err := self.readEntry()
+		if err != nil {
+			return emptyEntry, self.corrupted(err)
+		}
+		return entry, nil
+	case notCreated, initiated, progress, rollback:
+		// the end of the journal or an entry which was not committed,
+		// it is overwritten by the next one
+		self.pos = self.entryPos
 		return emptyEntry, ErrEmpty
+	default:
+		return emptyEntry, self.corrupted(ErrInvalidStatus)
 	}
 }
 
@@ -95,6 +195,21 @@ func (self *reader) Tell() int64 {
 	return self.pos
 }
 
+// Offset is the offset of the last read entry.
+func (self *reader) Offset() int64 {
+	return self.entryPos
+}
+
+// Version is the format of the journal, it is known after the first entry is read.
+func (self *reader) Version() byte {
+	return self.version
+}
+
 func NewReader(r io.Reader) *reader {
-	return &reader{r: r}
+	return NewLimitedReader(r, -1)
+}
+
+// NewLimitedReader does not accept lengths exceeding the size of the journal.
+func NewLimitedReader(r io.Reader, size int64) *reader {
+	return &reader{r: bufio.NewReader(r), size: size}
 }
@@ -2,10 +2,15 @@ package journal
 
 import (
 	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
 	"io"
 )
 
 var (
+	ErrEntryTooLarge = errors.New("journal entry is too large")
+
 	_ Writer = (*writer)(nil)
 )
 
@@ -15,6 +20,8 @@ type writer struct {
 	statusPos int64
 	endPos    int64
 	ws        io.WriteSeeker
+	version   byte
+	crc       hash.Hash32
 }
 
 func (self *writer) seekStart(offset int64) error {
@@ -35,9 +42,26 @@ func (self *writer) writeBytes(bs []byte) error {
 		return err
 	}
 	self.pos += int64(n)
+	if self.crc != nil {
+		self.crc.Write(bs)
+	}
 	return nil
 }
 
+func (self *writer) writeHeader() error {
+	if err := self.seekStart(0); err != nil {
+		return err
+	}
+	return self.writeBytes(append(append([]byte{}, magic...), self.version))
+}
+
+func (self *writer) writeChecksum() error {
+	crcValue := make([]byte, crcSize)
+	binary.BigEndian.PutUint32(crcValue, self.crc.Sum32())
+	self.crc = nil
+	return self.writeBytes(crcValue)
+}
+
 func (self *writer) writeStatus(status byte) error {
 	if err := self.writeBytes([]byte{status}); err != nil {
 		return err
@@ -73,11 +97,24 @@ func (self *writer) Write(entry [][]byte) error {
 	if entrySize <= 0 {
 		return nil
 	}
+	if entrySize > MaxEntryLen {
+		return ErrEntryTooLarge
+	}
+	for _, item := range entry {
+		if len(item) > MaxEntryItemLen {
+			return ErrEntryTooLarge
+		}
+	}
 
 	self.statusPos = self.pos
+	// a failed write could leave the checksum of the previous entry
+	self.crc = nil
 	if err := self.writeStatus(initiated); err != nil {
 		return err
 	}
+	if self.version != versionNoHeader {
+		self.crc = crc32.NewIEEE()
+	}
 	if err := self.writeLen(int64(entrySize)); err != nil {
 		return err
 	}
@@ -93,6 +130,11 @@ func (self *writer) Write(entry [][]byte) error {
 			return err
 		}
 	}
+	if self.crc != nil {
+		if err := self.writeChecksum(); err != nil {
+			return err
+		}
+	}
 
 	// writing status for the next journal item
 	if err := self.writeStatus(notCreated); err != nil {
@@ -128,5 +170,5 @@ func (self *writer) Commit() error {
 }
 
 func NewWriter(ws io.WriteSeeker) *writer {
-	return &writer{ws: ws}
+	return &writer{ws: ws, version: version}
 }
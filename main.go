@@ -3,25 +3,42 @@ package main
 import (
 	"flag"
 	"log"
+	"time"
 
 	"os"
 	"os/signal"
 
+	"github.com/auvn/go.cache/cluster"
 	. "github.com/auvn/go.cache/commands"
 	"github.com/auvn/go.cache/journal"
+	"github.com/auvn/go.cache/pubsub"
 	"github.com/auvn/go.cache/server"
 	"github.com/auvn/go.cache/session"
+	"github.com/auvn/go.cache/snapshot"
 	"github.com/auvn/go.cache/storage"
 	"github.com/auvn/go.cache/util/sync"
 )
 
 type Options struct {
-	JournalFile string
+	JournalFile  string
+	SnapshotFile string
 
 	server.TelnetOptions
 	server.HttpOptions
+	storage.ExpirerOptions
+	storage.Options
+	JournalAdapterOptions
+	journal.FileOptions
+	ReplicationOptions
+	KeyspaceNotifierOptions
+	Cluster cluster.Options
 
-	Pass string
+	EvictionPolicy string
+	FsyncPolicy    string
+	Pass           string
+	ReplicaOf      string
+	ClusterNodes   string
+	NotifyClasses  string
 }
 
 var (
@@ -30,34 +47,185 @@ var (
 
 func parseFlags() {
 	flag.StringVar(&opts.JournalFile, "journal", "", "Journal file for cache")
+	flag.StringVar(&opts.SnapshotFile, "snapshot", "", "Snapshot file for cache")
+	flag.IntVar(&opts.RewritePercentage, "journal-rewrite-percentage", 100, "Rewrite the journal once it grows by the percentage since the last rewrite, 0 disables the automatic rewrite")
+	flag.Int64Var(&opts.RewriteMinSize, "journal-rewrite-min-size", 64<<20, "Min size of the journal in bytes to be rewritten automatically")
+	flag.BoolVar(&opts.Recover, "journal-recover", false, "Truncate the damaged journal at the last valid entry instead of failing to start")
+	flag.StringVar(&opts.FsyncPolicy, "appendfsync", "everysec", "When the journal is flushed to the disk: always, everysec, no")
 
 	flag.StringVar(&opts.TelnetOptions.Addr, "telnet", "0.0.0.0:1234", "Addr to listen telnet on")
 	flag.StringVar(&opts.HttpOptions.Addr, "http", "", "Addr to listen http on")
 
 	flag.StringVar(&opts.Pass, "pass", "", "Password for cache auth")
 
+	flag.StringVar(&opts.ReplicaOf, "replicaof", "", "Addr of the leader to replicate, host:port")
+	flag.StringVar(&opts.LeaderAuth, "leader-pass", "", "Password of the leader")
+	flag.IntVar(&opts.BacklogSize, "repl-backlog-size", 1<<20, "Bytes of the latest writes kept for the followers to catch up without the full sync")
+
+	flag.StringVar(&opts.Cluster.Addr, "cluster-addr", "", "Addr of the node announced to the clients and other nodes, enables the cluster mode")
+	flag.StringVar(&opts.ClusterNodes, "cluster-nodes", "", "Slots of the nodes: host:port=0-8191,host:port=8192-16383")
+	flag.StringVar(&opts.Cluster.ConfigFile, "cluster-config", "", "File keeping the slots of the nodes across restarts, it takes precedence over -cluster-nodes")
+
+	flag.DurationVar(&opts.ExpirerOptions.Interval, "expire-interval", 100*time.Millisecond, "Interval of the active expiry cycle")
+	flag.DurationVar(&opts.ExpirerOptions.Budget, "expire-budget", 25*time.Millisecond, "Max time spent in a single active expiry cycle")
+
+	flag.IntVar(&opts.MaxMemory, "maxmemory", 0, "Memory limit for keys and values in bytes, 0 means no limit")
+	flag.IntVar(&opts.Shards, "shards", 16, "Number of independently locked storage shards")
+	flag.StringVar(&opts.EvictionPolicy, "maxmemory-policy", "noeviction", "Eviction policy once the memory limit is reached: noeviction, allkeys-lru, allkeys-lfu, volatile-ttl")
+
+	flag.StringVar(&opts.NotifyClasses, "notify-keyspace-events", "", "Classes of the keyspace events published: generic, string, list, hash, set, zset, expired, evicted or all, comma separated")
+
 	flag.Parse()
 }
 
-func initJournal(handler *Handler, s session.Session, group sync.ServeGroup) error {
-	if opts.JournalFile == "" {
+func initSnapshot() *snapshot.File {
+	if opts.SnapshotFile == "" {
 		return nil
+	}
+	return snapshot.NewFile(opts.SnapshotFile)
+}
+
+func initJournal(s session.Session) (*JournalAdapter, error) {
+	if opts.JournalFile == "" {
+		return nil, nil
 	} else {
+		policy, err := LookupFsyncPolicy(opts.FsyncPolicy)
+		if err != nil {
+			return nil, err
+		}
+		opts.JournalAdapterOptions.Fsync = policy
 		log.Println("initializing journal file:", opts.JournalFile)
-		journal := journal.MustInitFile(opts.JournalFile)
-		journalAdapter := NewJournalAdapter(journal, s)
-		if err := journalAdapter.Restore(handler); err != nil {
+		journal := journal.MustInitFile(opts.JournalFile, &opts.FileOptions)
+		opts.JournalAdapterOptions.Path = opts.JournalFile
+		return NewJournalAdapter(journal, s, &opts.JournalAdapterOptions), nil
+	}
+}
+
+// loads the snapshot and replays the journal entries written after it
+func restore(handler *Handler, s storage.Storage, snapshotFile *snapshot.File, journalAdapter *JournalAdapter, group sync.ServeGroup) error {
+	var journalID, journalEntries uint64
+	if journalAdapter != nil {
+		id, err := journalAdapter.Open()
+		if err != nil {
+			return err
+		}
+		journalID = id
+	}
+	if snapshotFile != nil {
+		log.Println("loading snapshot file:", snapshotFile.Path())
+		header, err := snapshotFile.Load(s, journalID)
+		if err == snapshot.ErrJournalMismatch {
+			// the rewritten journal contains the whole dataset
+			log.Println("ignoring the snapshot:", err)
+		} else if err != nil {
+			return err
+		} else {
+			journalEntries = header.JournalEntries
+		}
+	}
+	if journalAdapter != nil {
+		if err := journalAdapter.Restore(handler, journalEntries); err != nil {
 			return err
 		}
 		journalAdapter.AttachTo(handler)
 		group.Serve(journalAdapter)
-		return nil
 	}
+	return nil
+}
+
+func initStorage(notifier *KeyspaceNotifier) (storage.Storage, error) {
+	policy, err := storage.LookupEvictionPolicy(opts.EvictionPolicy)
+	if err != nil {
+		return nil, err
+	}
+	opts.Options.Eviction = policy
+	if notifier != nil {
+		opts.Options.OnRemove = notifier.Removed
+	}
+	return storage.New(&opts.Options), nil
+}
+
+// nil if the keyspace notifications are disabled
+func initNotifier(broker *pubsub.Broker) (*KeyspaceNotifier, error) {
+	classes, err := ParseNotifyClasses(opts.NotifyClasses)
+	if err != nil || classes == 0 {
+		return nil, err
+	}
+	opts.KeyspaceNotifierOptions.Classes = classes
+	return NewKeyspaceNotifier(broker, &opts.KeyspaceNotifierOptions), nil
 }
 
-func initRegistry() Registry {
+func startNotifier(handler *Handler, notifier *KeyspaceNotifier) {
+	if notifier != nil {
+		notifier.AttachTo(handler)
+	}
+}
+
+func initExpirer(s storage.Storage, group sync.ServeGroup) {
+	group.Serve(storage.NewExpirer(s, &opts.ExpirerOptions))
+}
+
+func initReplication(s session.Session) *Replication {
+	opts.ReplicationOptions.PullTimeout = DefaultReplicationOptions.PullTimeout
+	opts.ReplicationOptions.RetryDelay = DefaultReplicationOptions.RetryDelay
+	opts.ReplicationOptions.DialTimeout = DefaultReplicationOptions.DialTimeout
+	hostname, _ := os.Hostname()
+	opts.ReplicationOptions.Name = hostname + "/" + opts.TelnetOptions.Addr
+	return NewReplication(s, &opts.ReplicationOptions)
+}
+
+func startReplication(handler *Handler, replication *Replication, group sync.ServeGroup) {
+	replication.AttachTo(handler)
+	group.Serve(replication)
+	if opts.ReplicaOf != "" {
+		log.Println("replicating leader at:", opts.ReplicaOf)
+		replication.Follow(opts.ReplicaOf)
+	}
+}
+
+func initCluster(s session.Session) (*SlotMigrator, error) {
+	if opts.Cluster.Addr == "" {
+		return nil, nil
+	}
+	c := cluster.New(&opts.Cluster)
+	loaded, err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+	if !loaded {
+		ranges, err := cluster.ParseRanges(opts.ClusterNodes)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ranges {
+			if err := c.Assign(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	log.Println("cluster node at:", opts.Cluster.Addr)
+	return NewSlotMigrator(c, s, &SlotMigratorOptions{
+		Auth:        opts.Pass,
+		DialTimeout: DefaultSlotMigratorOptions.DialTimeout,
+		Timeout:     DefaultSlotMigratorOptions.Timeout,
+	}), nil
+}
+
+func startCluster(handler *Handler, migrator *SlotMigrator, group sync.ServeGroup) {
+	if migrator != nil {
+		migrator.AttachTo(handler)
+		group.Serve(migrator)
+	}
+}
+
+func initRegistry(snapshotFile *snapshot.File, journalAdapter *JournalAdapter, replication *Replication, migrator *SlotMigrator, broker *pubsub.Broker) Registry {
 	options := new(RegistryOptions)
+	options.PubSub = broker
 	options.Auth = opts.Pass
+	options.Snapshot = snapshotFile
+	options.Journal = journalAdapter
+	options.Replication = replication
+	options.Cluster = migrator
 	return InitReflectRegistry(options)
 }
 
@@ -100,15 +268,38 @@ func waitForInterrupt(group sync.ServeGroup) {
 func main() {
 	parseFlags()
 	group := initServeGroup()
-	baseSession := session.WithStorage(session.New(), storage.New())
+	broker := pubsub.NewBroker()
+	notifier, err := initNotifier(broker)
+	if err != nil {
+		fatal(err, group)
+	}
+	baseStorage, err := initStorage(notifier)
+	if err != nil {
+		fatal(err, group)
+	}
+	baseSession := session.WithStorage(session.New(), baseStorage)
 
-	registry := initRegistry()
+	snapshotFile := initSnapshot()
+	journalAdapter, err := initJournal(baseSession)
+	if err != nil {
+		fatal(err, group)
+	}
+	replication := initReplication(baseSession)
+	migrator, err := initCluster(baseSession)
+	if err != nil {
+		fatal(err, group)
+	}
+	registry := initRegistry(snapshotFile, journalAdapter, replication, migrator, broker)
 	handler := NewHandler(registry)
 
-	if err := initJournal(handler, baseSession, group); err != nil {
+	if err := restore(handler, baseStorage, snapshotFile, journalAdapter, group); err != nil {
 		fatal(err, group)
 	}
 	group.Serve(handler)
+	startReplication(handler, replication, group)
+	startCluster(handler, migrator, group)
+	startNotifier(handler, notifier)
+	initExpirer(baseStorage, group)
 
 	initTelnet(handler, baseSession, group)
 	initHttp(handler, baseSession, group)
@@ -8,12 +8,7 @@ import (
 )
 
 var (
-	emptyBytesBuffer    = bytes.NewBuffer([]byte{})
-	bufferedReadersPool = &sync.Pool{
-		New: func() interface{} {
-			return bufio.NewReader(emptyBytesBuffer)
-		},
-	}
+	emptyBytesBuffer     = bytes.NewBuffer([]byte{})
 	bufferredWritersPool = &sync.Pool{
 		New: func() interface{} {
 			return bufio.NewWriter(emptyBytesBuffer)
@@ -21,17 +16,6 @@ var (
 	}
 )
 
-func getBufferedReader(r io.Reader) *bufio.Reader {
-	buf := bufferedReadersPool.Get().(*bufio.Reader)
-	buf.Reset(r)
-	return buf
-}
-
-func putBufferedReader(buf *bufio.Reader) {
-	buf.Reset(emptyBytesBuffer)
-	bufferedReadersPool.Put(buf)
-}
-
 func getBufferedWriter(w io.Writer) *bufio.Writer {
 	buf := bufferredWritersPool.Get().(*bufio.Writer)
 	buf.Reset(w)
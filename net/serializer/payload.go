@@ -7,6 +7,7 @@ var (
 	ErrPayloadNonValue  = NewError("not-value payload received")
 	ErrPayloadNonString = NewError("not-string payload received")
 	ErrPayloadNonInt    = NewError("not-int payload received")
+	ErrPayloadNonFloat  = NewError("not-float payload received")
 	ErrPayloadNonBool   = NewError("not-bool payload received")
 	ErrPayloadNonError  = NewError("not-error payload received")
 )
@@ -16,6 +17,7 @@ type Payload interface {
 	Bytes() ([]byte, error)
 	Str() (string, error)
 	Int() (int, error)
+	Float() (float64, error)
 	Bool() (bool, error)
 	Err() error
 
@@ -58,6 +60,15 @@ func (self *payload) Int() (int, error) {
 	return 0, ErrPayloadNonInt
 }
 
+func (self *payload) Float() (float64, error) {
+	if s, err := self.Str(); err == nil {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, ErrPayloadNonFloat
+}
+
 func (self *payload) Bool() (bool, error) {
 	if bs, err := self.Bytes(); err == nil && len(bs) == 1 {
 		return bs[0] != '0', nil
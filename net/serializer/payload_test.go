@@ -209,6 +209,64 @@ func Test_payload_Int(t *testing.T) {
 	}
 }
 
+func Test_payload_Float(t *testing.T) {
+	type fields struct {
+		v interface{}
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    float64
+		wantErr bool
+	}{
+		{
+			name:    "BytesValue",
+			fields:  fields{v: []byte("1.25")},
+			want:    1.25,
+			wantErr: false,
+		},
+		{
+			name:    "IntBytesValue",
+			fields:  fields{v: []byte("-3")},
+			want:    -3,
+			wantErr: false,
+		},
+		{
+			name:    "NonConvertableBytesValue",
+			fields:  fields{v: []byte("1.2b")},
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "NonBytesValue",
+			fields:  fields{v: 1.5},
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "NilValue",
+			fields:  fields{v: nil},
+			want:    0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := &payload{
+				v: tt.fields.v,
+			}
+			got, err := self.Float()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("payload.Float() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("payload.Float() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_payload_Bool(t *testing.T) {
 	type fields struct {
 		v interface{}
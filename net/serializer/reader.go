@@ -203,25 +203,28 @@ func Read(r io.Reader) (Payload, error) {
 type Reader interface {
 	ReadArray() (Payload, error)
 	Read() (Payload, error)
+	// Peek waits until the next payload starts or the reading fails,
+	// nothing is consumed.
+	Peek() error
 }
 
+// the buffer is kept between the reads, so the payloads sent one after
+// another are not lost
 type reader struct {
-	r io.Reader
+	buffer *bufio.Reader
 }
 
-//todo: pool for bufffers
-
 func (self *reader) Read() (Payload, error) {
-	buffer := getBufferedReader(self.r)
-	defer putBufferedReader(buffer)
+	return readPayload(self.buffer)
+}
 
-	return readPayload(buffer)
+func (self *reader) Peek() error {
+	_, err := self.buffer.Peek(1)
+	return err
 }
 
 func (self *reader) ReadArray() (Payload, error) {
-	buffer := getBufferedReader(self.r)
-	defer putBufferedReader(buffer)
-
+	buffer := self.buffer
 	prefix, err := lookupPrefix(buffer, ArrayPrefix)
 	if err != nil {
 		return nil, err
@@ -237,5 +240,5 @@ func (self *reader) ReadArray() (Payload, error) {
 }
 
 func NewReader(r io.Reader) Reader {
-	return &reader{r: r}
+	return &reader{buffer: bufio.NewReader(r)}
 }
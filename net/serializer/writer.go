@@ -153,6 +153,8 @@ func writeInterface(w io.Writer, v interface{}) error {
 		return writeBoolValue(w, vValue.Bool())
 	case reflect.Int:
 		return writeIntValue(w, vValue.Int())
+	case reflect.Float32, reflect.Float64:
+		return writeBytesValue(w, []byte(strconv.FormatFloat(vValue.Float(), 'f', -1, vType.Bits())))
 	case reflect.String:
 		return writeBytesValue(w, []byte(vValue.String()))
 	case reflect.Slice:
@@ -709,6 +709,18 @@ func Test_writeInterface(t *testing.T) {
 			wantW:   "",
 			wantErr: true,
 		},
+		{
+			name:    "Float",
+			args:    args{v: 1.5, w: &bytes.Buffer{}},
+			wantW:   "V3\r\n1.5\r\n",
+			wantErr: false,
+		},
+		{
+			name:    "WriteFloatErr",
+			args:    args{v: 1.5, w: &fakeWriter{}},
+			wantW:   "",
+			wantErr: true,
+		},
 		{
 			name:    "String",
 			args:    args{v: "str", w: &bytes.Buffer{}},
@@ -0,0 +1,84 @@
+package pubsub
+
+// Match reports whether the channel matches the glob pattern: * matches any
+// sequence of bytes, ? a single byte, [abc], [a-z] and [^a] a byte of the
+// class, \ escapes the next byte.
+func Match(pattern, channel string) bool {
+	var p, c int
+	// the position after the last * and the byte it is matched up to
+	star, mark := -1, 0
+	for c < len(channel) {
+		if p < len(pattern) && pattern[p] == '*' {
+			p++
+			star, mark = p, c
+			continue
+		}
+		if p < len(pattern) {
+			if next, ok := matchByte(pattern, p, channel[c]); ok {
+				p, c = next, c+1
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// the last * takes one more byte
+		mark++
+		p, c = star, mark
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matches the byte with the element of the pattern at p, returns the
+// position of the next element
+func matchByte(pattern string, p int, b byte) (int, bool) {
+	switch pattern[p] {
+	case '?':
+		return p + 1, true
+	case '[':
+		return matchClass(pattern, p+1, b)
+	case '\\':
+		if p+1 < len(pattern) {
+			p++
+		}
+	}
+	return p + 1, pattern[p] == b
+}
+
+// p is the position after [, the class not closed with ] ends at the end of the pattern
+func matchClass(pattern string, p int, b byte) (int, bool) {
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+	var matched bool
+	for ; p < len(pattern) && pattern[p] != ']'; p++ {
+		lo := pattern[p]
+		if lo == '\\' && p+1 < len(pattern) {
+			p++
+			lo = pattern[p]
+		}
+		hi := lo
+		if p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']' {
+			p += 2
+			hi = pattern[p]
+			if hi == '\\' && p+1 < len(pattern) {
+				p++
+				hi = pattern[p]
+			}
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= b && b <= hi {
+			matched = true
+		}
+	}
+	if p < len(pattern) {
+		p++
+	}
+	return p, matched != negate
+}
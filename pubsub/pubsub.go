@@ -0,0 +1,213 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// max number of the messages waiting to be pushed to a subscriber
+	DefaultBufferSize = 1024
+)
+
+var (
+	ErrClosed = errors.New("the subscriber is closed")
+)
+
+type Message struct {
+	// the pattern the channel is matched with, empty for the channel subscriptions
+	Pattern string
+	Channel string
+	Data    []byte
+}
+
+// Payload is the message as it is pushed to the connection:
+// [message, channel, data] or [pmessage, pattern, channel, data]
+func (self *Message) Payload() interface{} {
+	if self.Pattern == "" {
+		return []interface{}{"message", self.Channel, self.Data}
+	}
+	return []interface{}{"pmessage", self.Pattern, self.Channel, self.Data}
+}
+
+// Subscriber receives the messages of the channels it is subscribed to.
+// The subscriber not reading the messages fast enough is closed, so a slow
+// connection does not hold the memory of the server.
+type Subscriber struct {
+	size int
+
+	mu       sync.Mutex
+	broker   *Broker
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	messages chan *Message
+	closed   bool
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (self *Subscriber) stop() {
+	self.once.Do(func() {
+		close(self.done)
+	})
+}
+
+// Count is the number of the channels and the patterns the subscriber is subscribed to.
+func (self *Subscriber) Count() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return len(self.channels) + len(self.patterns)
+}
+
+// Messages is nil until the first subscription.
+func (self *Subscriber) Messages() <-chan *Message {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.messages
+}
+
+// Done is closed once the subscriber is closed or falls behind the messages.
+func (self *Subscriber) Done() <-chan struct{} {
+	return self.done
+}
+
+// Close unsubscribes from all the channels and the patterns.
+func (self *Subscriber) Close() {
+	self.mu.Lock()
+	broker := self.broker
+	self.closed = true
+	self.mu.Unlock()
+	if broker != nil {
+		broker.Unsubscribe(self)
+		broker.PUnsubscribe(self)
+	}
+	self.stop()
+}
+
+func (self *Subscriber) push(m *Message) {
+	select {
+	case self.messages <- m:
+	default:
+		self.stop()
+	}
+}
+
+func NewSubscriber(size int) *Subscriber {
+	if size < 1 {
+		size = DefaultBufferSize
+	}
+	return &Subscriber{
+		size:     size,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// the subscribers of the channels or the patterns
+type subscriptions map[string]map[*Subscriber]struct{}
+
+// Broker delivers the published messages to the subscribers.
+type Broker struct {
+	mu       sync.RWMutex
+	channels subscriptions
+	patterns subscriptions
+}
+
+// the subscriptions of the subscriber to the names are in own
+func (self *Broker) subscribe(subs subscriptions, sub *Subscriber, own map[string]struct{}, names []string) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return 0, ErrClosed
+	}
+	sub.broker = self
+	if sub.messages == nil {
+		sub.messages = make(chan *Message, sub.size)
+	}
+	for _, name := range names {
+		if subs[name] == nil {
+			subs[name] = make(map[*Subscriber]struct{})
+		}
+		subs[name][sub] = struct{}{}
+		own[name] = struct{}{}
+	}
+	return len(sub.channels) + len(sub.patterns), nil
+}
+
+// no names removes all the subscriptions
+func (self *Broker) unsubscribe(subs subscriptions, sub *Subscriber, own map[string]struct{}, names []string) int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		delete(own, name)
+		delete(subs[name], sub)
+		if len(subs[name]) == 0 {
+			delete(subs, name)
+		}
+	}
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// Subscribe returns the number of the subscriptions of the subscriber.
+func (self *Broker) Subscribe(sub *Subscriber, channels ...string) (int, error) {
+	return self.subscribe(self.channels, sub, sub.channels, channels)
+}
+
+// PSubscribe subscribes to the channels matching the glob patterns.
+func (self *Broker) PSubscribe(sub *Subscriber, patterns ...string) (int, error) {
+	return self.subscribe(self.patterns, sub, sub.patterns, patterns)
+}
+
+// Unsubscribe unsubscribes from all the channels if none are passed.
+func (self *Broker) Unsubscribe(sub *Subscriber, channels ...string) int {
+	return self.unsubscribe(self.channels, sub, sub.channels, channels)
+}
+
+// PUnsubscribe unsubscribes from all the patterns if none are passed.
+func (self *Broker) PUnsubscribe(sub *Subscriber, patterns ...string) int {
+	return self.unsubscribe(self.patterns, sub, sub.patterns, patterns)
+}
+
+// Publish returns the number of the subscribers the message is sent to,
+// a subscriber matching several patterns receives the message for every one.
+func (self *Broker) Publish(channel string, data []byte) int {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var n int
+	if subs, ok := self.channels[channel]; ok {
+		m := &Message{Channel: channel, Data: data}
+		for sub := range subs {
+			sub.push(m)
+			n += 1
+		}
+	}
+	for pattern, subs := range self.patterns {
+		if !Match(pattern, channel) {
+			continue
+		}
+		m := &Message{Pattern: pattern, Channel: channel, Data: data}
+		for sub := range subs {
+			sub.push(m)
+			n += 1
+		}
+	}
+	return n
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		channels: make(subscriptions),
+		patterns: make(subscriptions),
+	}
+}
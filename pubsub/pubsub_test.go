@@ -0,0 +1,112 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		channel string
+		want    bool
+	}{
+		{"news.*", "news.sport", true},
+		{"news.*", "news.", true},
+		{"news.*", "news", false},
+		{"*", "", true},
+		{"", "a", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"*a*b", "xaxxbxb", true},
+		{"*a*b", "xaxxbxc", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`[\]]`, "]", true},
+		{"a[bc", "ab", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.channel); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.channel, got, tt.want)
+		}
+	}
+}
+
+func receive(t *testing.T, sub *Subscriber) *Message {
+	select {
+	case m := <-sub.Messages():
+		return m
+	default:
+		t.Fatalf("no message")
+		return nil
+	}
+}
+
+func Test_Broker(t *testing.T) {
+	b := NewBroker()
+	sub := NewSubscriber(0)
+	if n, err := b.Subscribe(sub, "a", "b"); err != nil || n != 2 {
+		t.Fatalf("Subscribe() = %d, %v", n, err)
+	}
+	if n, _ := b.PSubscribe(sub, "a*"); n != 3 {
+		t.Fatalf("PSubscribe() = %d", n)
+	}
+
+	if n := b.Publish("a", []byte("x")); n != 2 {
+		t.Errorf("Publish() = %d, want 2", n)
+	}
+	want := []*Message{{Channel: "a", Data: []byte("x")}, {Pattern: "a*", Channel: "a", Data: []byte("x")}}
+	for _, m := range want {
+		if got := receive(t, sub); !reflect.DeepEqual(got, m) {
+			t.Errorf("message = %+v, want %+v", got, m)
+		}
+	}
+	if n := b.Publish("c", []byte("x")); n != 0 {
+		t.Errorf("Publish() to no subscribers = %d", n)
+	}
+
+	if n := b.Unsubscribe(sub); n != 1 {
+		t.Errorf("Unsubscribe() = %d, want 1", n)
+	}
+	if n := b.Publish("b", nil); n != 0 {
+		t.Errorf("Publish() after Unsubscribe() = %d", n)
+	}
+	sub.Close()
+	if n := b.Publish("ab", nil); n != 0 {
+		t.Errorf("Publish() after Close() = %d", n)
+	}
+	if _, err := b.Subscribe(sub, "a"); err != ErrClosed {
+		t.Errorf("Subscribe() after Close() error = %v", err)
+	}
+	if len(b.channels) != 0 || len(b.patterns) != 0 {
+		t.Errorf("subscriptions are left: %v, %v", b.channels, b.patterns)
+	}
+}
+
+func Test_Subscriber_Overflow(t *testing.T) {
+	b := NewBroker()
+	sub := NewSubscriber(2)
+	b.Subscribe(sub, "a")
+	for i := 0; i < 2; i++ {
+		b.Publish("a", nil)
+	}
+	select {
+	case <-sub.Done():
+		t.Fatalf("Done() before overflow")
+	default:
+	}
+	b.Publish("a", nil)
+	select {
+	case <-sub.Done():
+	default:
+		t.Errorf("Done() is not closed after overflow")
+	}
+}
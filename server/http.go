@@ -39,6 +39,10 @@ func (self *payload) Int() (int, error) {
 	return 0, errEmptyPayload
 }
 
+func (self *payload) Float() (float64, error) {
+	return 0, errEmptyPayload
+}
+
 func (self *payload) Bool() (bool, error) {
 	return false, errEmptyPayload
 }
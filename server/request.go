@@ -48,6 +48,11 @@ func (self *Request) Response() chan<- interface{} {
 	return self.response
 }
 
+// Get waits for the response to the request.
+func (self *Request) Get(quit sync.Quit) (interface{}, error) {
+	return self.response.Get(quit)
+}
+
 func NewRequest(body [][]byte, s session.Session) *Request {
 	return &Request{
 		body:     body,
@@ -2,9 +2,11 @@ package server
 
 import (
 	"net"
+	gosync "sync"
 	"time"
 
 	"github.com/auvn/go.cache/net/serializer"
+	"github.com/auvn/go.cache/pubsub"
 	"github.com/auvn/go.cache/session"
 	"github.com/auvn/go.cache/util/sync"
 )
@@ -95,14 +97,19 @@ func Telnet(handler Handler, session session.Session, opts *TelnetOptions) *Teln
 
 var (
 	DefaultTelnetClientOptions = &TelnetClientOptions{
-		WriteTimeout: 5 * time.Second,
-		ReadTimeout:  5 * time.Minute,
+		WriteTimeout:   5 * time.Second,
+		ReadTimeout:    5 * time.Minute,
+		PushBufferSize: pubsub.DefaultBufferSize,
 	}
 )
 
 type TelnetClientOptions struct {
 	WriteTimeout time.Duration
-	ReadTimeout  time.Duration
+	// not applied in the push mode, the subscriber may not send commands for long
+	ReadTimeout time.Duration
+	// max number of the messages waiting to be pushed, the connection
+	// is closed once it is exceeded
+	PushBufferSize int
 }
 
 type TelnetClient struct {
@@ -111,6 +118,56 @@ type TelnetClient struct {
 	session session.Session
 	handler Handler
 	opts    *TelnetClientOptions
+
+	// the messages are pushed while the commands are served
+	mu      gosync.Mutex
+	sub     *pubsub.Subscriber
+	pushing bool
+
+	// nil until the close of the connection is watched for the pending request
+	watchMu gosync.Mutex
+	watch   *closeWatch
+}
+
+// closeWatch peeks the connection while the loop waits for the response,
+// so the close is detected without consuming the next commands
+type closeWatch struct {
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// Closed starts watching the connection until the response to the pending
+// request is written. A pipelined command stops the watch, since the client
+// is alive then.
+func (self *TelnetClient) Closed() <-chan struct{} {
+	self.watchMu.Lock()
+	defer self.watchMu.Unlock()
+	if self.watch == nil {
+		w := &closeWatch{closed: make(chan struct{}), done: make(chan struct{})}
+		self.watch = w
+		go func() {
+			defer close(w.done)
+			err := self.rw.Peek()
+			if nerr, ok := err.(net.Error); err != nil && !(ok && nerr.Timeout()) {
+				close(w.closed)
+			}
+		}()
+	}
+	return self.watch.closed
+}
+
+// interrupts the peek of the connection, so the loop reads it again
+func (self *TelnetClient) stopWatch() {
+	self.watchMu.Lock()
+	w := self.watch
+	self.watch = nil
+	self.watchMu.Unlock()
+	if w == nil {
+		return
+	}
+	self.conn.SetReadDeadline(self.timeNow())
+	<-w.done
+	self.conn.SetReadDeadline(ZeroTime)
 }
 
 func (self *TelnetClient) timeNow() time.Time {
@@ -126,17 +183,45 @@ func (self *TelnetClient) nextReadDeadline() time.Time {
 }
 
 func (self *TelnetClient) write(i interface{}) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	self.conn.SetWriteDeadline(self.nextWriteDeadline())
 	defer self.conn.SetWriteDeadline(ZeroTime)
 	self.rw.Write(i)
 }
 
 func (self *TelnetClient) readArray() (serializer.Payload, error) {
-	self.conn.SetReadDeadline(self.nextReadDeadline())
-	defer self.conn.SetReadDeadline(ZeroTime)
+	if self.sub.Count() == 0 {
+		self.conn.SetReadDeadline(self.nextReadDeadline())
+		defer self.conn.SetReadDeadline(ZeroTime)
+	}
 	return self.rw.ReadArray()
 }
 
+func (self *TelnetClient) push(messages <-chan *pubsub.Message, quit sync.Quit) {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-self.sub.Done():
+			// closed or cannot keep up with the messages
+			self.conn.Close()
+			return
+		case m := <-messages:
+			self.write(m.Payload())
+		}
+	}
+}
+
+// enters the push mode once the connection is subscribed
+func (self *TelnetClient) startPush(quit sync.Quit) {
+	if self.pushing || self.sub.Count() == 0 {
+		return
+	}
+	self.pushing = true
+	go self.push(self.sub.Messages(), quit)
+}
+
 func (self *TelnetClient) waitForQuit(quit sync.Quit) {
 	go func() {
 		select {
@@ -146,8 +231,17 @@ func (self *TelnetClient) waitForQuit(quit sync.Quit) {
 	}()
 }
 
+// drops the transaction of the closed connection, so its keys are not watched
+func (self *TelnetClient) discard() {
+	if tx := session.Transaction(self.session); tx != nil {
+		tx.Discard()
+	}
+}
+
 func (self *TelnetClient) loopCommands(quit sync.Quit) {
 	defer self.conn.Close()
+	defer self.sub.Close()
+	defer self.discard()
 	for {
 		select {
 		case <-quit:
@@ -172,11 +266,13 @@ func (self *TelnetClient) loopCommands(quit sync.Quit) {
 			}
 
 			value, err := handleRequest(self.handler, req, quit)
+			self.stopWatch()
 			if err != nil {
 				self.write(err)
 			} else {
 				self.write(value)
 			}
+			self.startPush(quit)
 		}
 	}
 }
@@ -205,12 +301,18 @@ func (self *TelnetClient) prepareRequest(p serializer.Payload, s session.Session
 	return NewRequest(body, s), nil
 }
 
-func NewTelnetClient(handler Handler, conn net.Conn, session session.Session) *TelnetClient {
-	return &TelnetClient{
+func NewTelnetClient(handler Handler, conn net.Conn, s session.Session) *TelnetClient {
+	opts := DefaultTelnetClientOptions
+	sub := pubsub.NewSubscriber(opts.PushBufferSize)
+	session.SetSubscriber(s, sub)
+	client := &TelnetClient{
 		rw:      serializer.NewReadWriter(conn, conn),
 		handler: handler,
 		conn:    conn,
-		session: session,
-		opts:    DefaultTelnetClientOptions,
+		session: s,
+		opts:    opts,
+		sub:     sub,
 	}
+	session.SetConn(s, client)
+	return client
 }
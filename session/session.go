@@ -4,6 +4,8 @@ import (
 	"errors"
 	"sync"
 
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/pubsub"
 	"github.com/auvn/go.cache/storage"
 )
 
@@ -38,10 +40,15 @@ func New() Session {
 	return Empty
 }
 
+// authSession is the state of a client connection
 type authSession struct {
 	Session
-	rw   sync.RWMutex
-	auth bool
+	rw     sync.RWMutex
+	auth   bool
+	asking bool
+	sub    *pubsub.Subscriber
+	tx     *Tx
+	conn   Conn
 }
 
 func (self *authSession) Authenticated() bool {
@@ -56,19 +63,74 @@ func (self *authSession) SetAuthenticated(auth bool) {
 	self.auth = auth
 }
 
+func (self *authSession) SetAsking(asking bool) {
+	self.rw.Lock()
+	defer self.rw.Unlock()
+	self.asking = asking
+}
+
+func (self *authSession) TakeAsking() bool {
+	self.rw.Lock()
+	defer self.rw.Unlock()
+	asking := self.asking
+	self.asking = false
+	return asking
+}
+
+func (self *authSession) SetSubscriber(sub *pubsub.Subscriber) {
+	self.rw.Lock()
+	defer self.rw.Unlock()
+	self.sub = sub
+}
+
+func (self *authSession) Subscriber() *pubsub.Subscriber {
+	self.rw.RLock()
+	defer self.rw.RUnlock()
+	return self.sub
+}
+
+func (self *authSession) SetConn(conn Conn) {
+	self.rw.Lock()
+	defer self.rw.Unlock()
+	self.conn = conn
+}
+
+func (self *authSession) Conn() Conn {
+	self.rw.RLock()
+	defer self.rw.RUnlock()
+	return self.conn
+}
+
+func (self *authSession) Transaction() *Tx {
+	return self.tx
+}
+
 func WithAuth(s Session) Session {
 	return &authSession{
 		Session: s,
+		tx:      new(Tx),
 	}
 }
 
 type emptyStorageObj struct{}
 
-func (self *emptyStorageObj) Write(fn storage.WriteFn) (interface{}, error) {
+func (self *emptyStorageObj) Write(fn storage.WriteFn, keys ...core.StrValue) (interface{}, error) {
+	return nil, ErrEmptyStorage
+}
+
+func (self *emptyStorageObj) Free(fn storage.WriteFn, keys ...core.StrValue) (interface{}, error) {
 	return nil, ErrEmptyStorage
 }
 
-func (self *emptyStorageObj) Read(fn storage.ReadFn) (interface{}, error) {
+func (self *emptyStorageObj) Read(fn storage.ReadFn, keys ...core.StrValue) (interface{}, error) {
+	return nil, ErrEmptyStorage
+}
+
+func (self *emptyStorageObj) Watch(keys ...core.StrValue) (*storage.Watch, error) {
+	return nil, ErrEmptyStorage
+}
+
+func (self *emptyStorageObj) Atomic(fn storage.AtomicFn) (interface{}, error) {
 	return nil, ErrEmptyStorage
 }
 
@@ -87,3 +149,110 @@ func WithStorage(s Session, stor storage.Storage) Session {
 		s:       stor,
 	}
 }
+
+type replicationSession struct {
+	Session
+}
+
+// Replication marks the session applying the writes of the leader.
+func (self *replicationSession) Replication() bool {
+	return true
+}
+
+func WithReplication(s Session) Session {
+	return &replicationSession{Session: s}
+}
+
+// IsReplication checks if the session applies the writes of the leader,
+// which are allowed on the read only follower.
+func IsReplication(s Session) bool {
+	r, ok := s.(interface {
+		Replication() bool
+	})
+	return ok && r.Replication()
+}
+
+type asker interface {
+	SetAsking(bool)
+	TakeAsking() bool
+}
+
+// SetAsking allows the next command of the connection to access the slot
+// being imported by the node, returns false if the session is not of a connection.
+func SetAsking(s Session, asking bool) bool {
+	a, ok := s.(asker)
+	if ok {
+		a.SetAsking(asking)
+	}
+	return ok
+}
+
+// TakeAsking checks if the previous command of the connection was ASKING.
+func TakeAsking(s Session) bool {
+	a, ok := s.(asker)
+	return ok && a.TakeAsking()
+}
+
+type subscriberHolder interface {
+	SetSubscriber(*pubsub.Subscriber)
+	Subscriber() *pubsub.Subscriber
+}
+
+// SetSubscriber enables the push mode of the connection, returns false if
+// the session is not of a connection.
+func SetSubscriber(s Session, sub *pubsub.Subscriber) bool {
+	h, ok := s.(subscriberHolder)
+	if ok {
+		h.SetSubscriber(sub)
+	}
+	return ok
+}
+
+// Subscriber returns nil if the connection does not support the push mode.
+func Subscriber(s Session) *pubsub.Subscriber {
+	if h, ok := s.(subscriberHolder); ok {
+		return h.Subscriber()
+	}
+	return nil
+}
+
+// Conn is the client connection of a session.
+type Conn interface {
+	// Closed is closed once the client disconnects while a request
+	// of the session is pending.
+	Closed() <-chan struct{}
+}
+
+type connHolder interface {
+	SetConn(Conn)
+	Conn() Conn
+}
+
+// SetConn returns false if the session is not of a connection.
+func SetConn(s Session, conn Conn) bool {
+	h, ok := s.(connHolder)
+	if ok {
+		h.SetConn(conn)
+	}
+	return ok
+}
+
+// Closed returns nil, which is never closed, if the session is not of a connection.
+func Closed(s Session) <-chan struct{} {
+	if h, ok := s.(connHolder); ok && h.Conn() != nil {
+		return h.Conn().Closed()
+	}
+	return nil
+}
+
+type transactionHolder interface {
+	Transaction() *Tx
+}
+
+// Transaction returns nil if the session is not of a connection.
+func Transaction(s Session) *Tx {
+	if h, ok := s.(transactionHolder); ok {
+		return h.Transaction()
+	}
+	return nil
+}
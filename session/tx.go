@@ -0,0 +1,92 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/auvn/go.cache/storage"
+)
+
+// Tx is the MULTI/EXEC state of a connection: the queued commands
+// and the watched keys.
+type Tx struct {
+	mu      sync.Mutex
+	multi   bool
+	failed  bool
+	queued  [][][]byte
+	watches []*storage.Watch
+}
+
+// Begin starts queueing the commands, false if they are queued already.
+func (self *Tx) Begin() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.multi {
+		return false
+	}
+	self.multi = true
+	return true
+}
+
+// Multi checks if the commands are queued.
+func (self *Tx) Multi() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.multi
+}
+
+func (self *Tx) Queue(body [][]byte) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.queued = append(self.queued, body)
+}
+
+// Fail discards the queued commands on EXEC, e.g. once a command cannot be queued.
+func (self *Tx) Fail() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.failed = true
+}
+
+// Take stops queueing the commands and returns them, false if the
+// transaction failed. The keys are still watched.
+func (self *Tx) Take() ([][][]byte, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	queued, failed := self.queued, self.failed
+	self.multi, self.failed, self.queued = false, false, nil
+	return queued, !failed
+}
+
+func (self *Tx) Watch(w *storage.Watch) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.watches = append(self.watches, w)
+}
+
+// Changed checks if a watched key was changed since it was watched.
+func (self *Tx) Changed() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, w := range self.watches {
+		if w.Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Tx) Unwatch() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, w := range self.watches {
+		w.Close()
+	}
+	self.watches = nil
+}
+
+// Discard drops the queued commands and unwatches the keys,
+// e.g. once the connection is closed.
+func (self *Tx) Discard() {
+	self.Take()
+	self.Unwatch()
+}
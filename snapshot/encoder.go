@@ -0,0 +1,408 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/storage"
+	"github.com/auvn/go.cache/types"
+)
+
+const (
+	version byte = 4
+	// the version with the deadlines in nanoseconds, they overflow after 2262
+	versionNanoDeadlines byte = 3
+	// the version without the deadlines of the hash keys
+	versionNoHashTTLs byte = 2
+	// the version without JournalID
+	versionNoJournalID byte = 1
+
+	typeString    byte = 1
+	typeList      byte = 2
+	typeHash      byte = 3
+	typeSet       byte = 4
+	typeSortedSet byte = 5
+	typeEnd       byte = 0xff
+
+	crcSize = 4
+)
+
+var (
+	magic = []byte("GOCACHESNAP")
+
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	ErrUnsupportedType = errors.New("unsupported type of value")
+	ErrJournalMismatch = errors.New("snapshot was taken from another journal")
+)
+
+// Header describes the point in time of the snapshot.
+type Header struct {
+	// the journal which entries are counted, it changes when the journal is rewritten
+	JournalID uint64
+	// number of journal entries applied to the storage when the snapshot was taken
+	JournalEntries uint64
+	Created        time.Time
+}
+
+type encoder struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (self *encoder) writeUint(v uint64) {
+	n := binary.PutUvarint(self.tmp[:], v)
+	self.buf.Write(self.tmp[:n])
+}
+
+func (self *encoder) writeBytes(bs []byte) {
+	self.writeUint(uint64(len(bs)))
+	self.buf.Write(bs)
+}
+
+func (self *encoder) writeStr(s core.StrValue) {
+	self.writeUint(uint64(len(s)))
+	self.buf.WriteString(string(s))
+}
+
+func (self *encoder) writeDeadline(deadline time.Time) {
+	if deadline.IsZero() {
+		self.writeUint(0)
+	} else {
+		self.writeUint(uint64(deadline.Unix()*1000 + int64(deadline.Nanosecond()/1e6)))
+	}
+}
+
+func (self *encoder) writeHeader(h *Header) {
+	self.buf.Write(magic)
+	self.buf.WriteByte(version)
+	self.writeUint(h.JournalID)
+	self.writeUint(h.JournalEntries)
+	self.writeUint(uint64(h.Created.UnixNano()))
+}
+
+func (self *encoder) writeValue(key core.StrValue, v interface{}, deadline time.Time) error {
+	switch value := v.(type) {
+	case types.String:
+		self.buf.WriteByte(typeString)
+		self.writeStr(key)
+		self.writeDeadline(deadline)
+		self.writeBytes(value.Get())
+	case types.List:
+		items := value.Range(0, -1)
+		self.buf.WriteByte(typeList)
+		self.writeStr(key)
+		self.writeDeadline(deadline)
+		self.writeUint(uint64(len(items)))
+		for _, item := range items {
+			self.writeBytes(item)
+		}
+	case types.Hash:
+		keys := value.Keys()
+		self.buf.WriteByte(typeHash)
+		self.writeStr(key)
+		self.writeDeadline(deadline)
+		self.writeUint(uint64(len(keys)))
+		for _, k := range keys {
+			hashValue, _ := value.Get(k)
+			self.writeStr(k)
+			self.writeBytes(hashValue)
+			self.writeDeadline(value.Deadline(k))
+		}
+	case types.Set:
+		members := value.Members()
+		self.buf.WriteByte(typeSet)
+		self.writeStr(key)
+		self.writeDeadline(deadline)
+		self.writeUint(uint64(len(members)))
+		for _, m := range members {
+			self.writeStr(m)
+		}
+	case types.SortedSet:
+		items := value.Range(0, -1)
+		self.buf.WriteByte(typeSortedSet)
+		self.writeStr(key)
+		self.writeDeadline(deadline)
+		self.writeUint(uint64(len(items)))
+		for _, item := range items {
+			self.writeStr(item.Member)
+			self.writeUint(math.Float64bits(float64(item.Score)))
+		}
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+func (self *encoder) end() []byte {
+	self.buf.WriteByte(typeEnd)
+	crc := crc32.ChecksumIEEE(self.buf.Bytes())
+	binary.BigEndian.PutUint32(self.tmp[:crcSize], crc)
+	self.buf.Write(self.tmp[:crcSize])
+	return self.buf.Bytes()
+}
+
+// Encode serializes all of the keys of the storage, the reader should
+// hold all of the shards.
+func Encode(r storage.Reader, h *Header) ([]byte, error) {
+	e := new(encoder)
+	e.writeHeader(h)
+	var err error
+	r.Scan(func(key core.StrValue, v interface{}, deadline time.Time) {
+		if err == nil {
+			err = e.writeValue(key, v, deadline)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.end(), nil
+}
+
+type decoder struct {
+	r       *bytes.Reader
+	version byte
+	// the values expired by now are skipped
+	now time.Time
+}
+
+func (self *decoder) readUint() (uint64, error) {
+	v, err := binary.ReadUvarint(self.r)
+	if err != nil {
+		return 0, ErrInvalidSnapshot
+	}
+	return v, nil
+}
+
+func (self *decoder) readBytes() ([]byte, error) {
+	n, err := self.readUint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(self.r.Len()) {
+		return nil, ErrInvalidSnapshot
+	}
+	bs := make([]byte, n)
+	self.r.Read(bs)
+	return bs, nil
+}
+
+func (self *decoder) readStr() (core.StrValue, error) {
+	bs, err := self.readBytes()
+	return core.StrValue(bs), err
+}
+
+func (self *decoder) readDeadline() (time.Time, error) {
+	v, err := self.readUint()
+	if err != nil || v == 0 {
+		return time.Time{}, err
+	}
+	if self.version <= versionNanoDeadlines {
+		return time.Unix(0, int64(v)).UTC(), nil
+	}
+	ms := int64(v)
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC(), nil
+}
+
+func (self *decoder) readHeader() (*Header, error) {
+	prefix := make([]byte, len(magic)+1)
+	if _, err := self.r.Read(prefix); err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	v := prefix[len(magic)]
+	if !bytes.Equal(prefix[:len(magic)], magic) || v < versionNoJournalID || v > version {
+		return nil, ErrInvalidSnapshot
+	}
+	self.version = v
+	h := new(Header)
+	var err error
+	if v != versionNoJournalID {
+		if h.JournalID, err = self.readUint(); err != nil {
+			return nil, err
+		}
+	}
+	if h.JournalEntries, err = self.readUint(); err != nil {
+		return nil, err
+	}
+	created, err := self.readUint()
+	if err != nil {
+		return nil, err
+	}
+	h.Created = time.Unix(0, int64(created)).UTC()
+	return h, nil
+}
+
+func (self *decoder) readList() (interface{}, error) {
+	n, err := self.readUint()
+	if err != nil {
+		return nil, err
+	}
+	list := types.NewList()
+	for i := uint64(0); i < n; i++ {
+		item, err := self.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		list.RPush(item)
+	}
+	return list, nil
+}
+
+func (self *decoder) readHash() (interface{}, error) {
+	n, err := self.readUint()
+	if err != nil {
+		return nil, err
+	}
+	hash := types.NewHash()
+	for i := uint64(0); i < n; i++ {
+		key, err := self.readStr()
+		if err != nil {
+			return nil, err
+		}
+		value, err := self.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		var deadline time.Time
+		if self.version > versionNoHashTTLs {
+			if deadline, err = self.readDeadline(); err != nil {
+				return nil, err
+			}
+		}
+		if !deadline.IsZero() && deadline.Before(self.now) {
+			continue
+		}
+		hash.Set(key, value)
+		if !deadline.IsZero() {
+			hash.SetDeadline(key, deadline)
+		}
+	}
+	// all of the keys have expired, so there is no hash
+	if hash.Len() == 0 {
+		return nil, nil
+	}
+	return hash, nil
+}
+
+func (self *decoder) readSet() (interface{}, error) {
+	n, err := self.readUint()
+	if err != nil {
+		return nil, err
+	}
+	set := types.NewSet()
+	for i := uint64(0); i < n; i++ {
+		member, err := self.readStr()
+		if err != nil {
+			return nil, err
+		}
+		set.Add(member)
+	}
+	return set, nil
+}
+
+func (self *decoder) readSortedSet() (interface{}, error) {
+	n, err := self.readUint()
+	if err != nil {
+		return nil, err
+	}
+	sortedSet := types.NewSortedSet()
+	for i := uint64(0); i < n; i++ {
+		member, err := self.readStr()
+		if err != nil {
+			return nil, err
+		}
+		score, err := self.readUint()
+		if err != nil {
+			return nil, err
+		}
+		sortedSet.Add(core.FloatValue(math.Float64frombits(score)), member)
+	}
+	return sortedSet, nil
+}
+
+func (self *decoder) readValue(t byte) (interface{}, error) {
+	switch t {
+	case typeString:
+		bs, err := self.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return types.NewString(bs), nil
+	case typeList:
+		return self.readList()
+	case typeHash:
+		return self.readHash()
+	case typeSet:
+		return self.readSet()
+	case typeSortedSet:
+		return self.readSortedSet()
+	default:
+		return nil, ErrInvalidSnapshot
+	}
+}
+
+func newDecoder(data []byte) (*decoder, error) {
+	if len(data) < crcSize {
+		return nil, ErrInvalidSnapshot
+	}
+	body := data[:len(data)-crcSize]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return nil, ErrInvalidSnapshot
+	}
+	return &decoder{r: bytes.NewReader(body)}, nil
+}
+
+// DecodeHeader reads only the header of the snapshot.
+func DecodeHeader(data []byte) (*Header, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	return d.readHeader()
+}
+
+// Decode restores the keys into the storage, keys with passed deadlines are skipped.
+func Decode(data []byte, w storage.Writer) (*Header, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	h, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	now := w.TimeNow()
+	d.now = now
+	for {
+		t, err := d.r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidSnapshot
+		}
+		if t == typeEnd {
+			return h, nil
+		}
+		key, err := d.readStr()
+		if err != nil {
+			return nil, err
+		}
+		deadline, err := d.readDeadline()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readValue(t)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil || !deadline.IsZero() && deadline.Before(now) {
+			continue
+		}
+		w.Set(key, value)
+		if !deadline.IsZero() {
+			w.SetDeadline(key, deadline)
+		}
+	}
+}
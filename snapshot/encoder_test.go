@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+	"github.com/auvn/go.cache/storage"
+	"github.com/auvn/go.cache/types"
+)
+
+func newTestStorage() storage.Storage {
+	s := storage.New(nil)
+	s.Write(func(w storage.Writer) (interface{}, error) {
+		w.Set("string", types.NewString(core.Value("value")))
+
+		list := types.NewList()
+		list.RPush(core.Value("a"), core.Value("b"))
+		w.Set("list", list)
+
+		hash := types.NewHash()
+		hash.Set("field", core.Value("value"))
+		hash.Set("expiring", core.Value("value"))
+		hash.SetDeadline("expiring", w.TimeNow().Add(time.Hour))
+		w.Set("hash", hash)
+
+		set := types.NewSet()
+		set.Add("member")
+		w.Set("set", set)
+
+		sortedSet := types.NewSortedSet()
+		sortedSet.Add(1.5, "one")
+		sortedSet.Add(-2, "two")
+		w.Set("zset", sortedSet)
+
+		w.SetDeadline("string", w.TimeNow().Add(time.Hour))
+		return nil, nil
+	})
+	return s
+}
+
+func encode(t *testing.T, s storage.Storage, h *Header) []byte {
+	data, err := s.Read(func(r storage.Reader) (interface{}, error) {
+		return Encode(r, h)
+	})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	return data.([]byte)
+}
+
+func decode(s storage.Storage, data []byte) (*Header, error) {
+	h, err := s.Write(func(w storage.Writer) (interface{}, error) {
+		return Decode(data, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.(*Header), nil
+}
+
+func Test_EncodeDecode(t *testing.T) {
+	data := encode(t, newTestStorage(), &Header{JournalEntries: 42, Created: time.Now()})
+
+	restored := storage.New(nil)
+	h, err := decode(restored, data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if h.JournalEntries != 42 {
+		t.Errorf("Decode() JournalEntries = %v, want %v", h.JournalEntries, 42)
+	}
+
+	restored.Read(func(r storage.Reader) (interface{}, error) {
+		if v, ok := r.Get("string"); !ok || string(v.(types.String).Get()) != "value" {
+			t.Errorf("Decode() string = %v", v)
+		}
+		if ttl := r.TTL("string"); ttl <= 0 {
+			t.Errorf("Decode() string TTL = %v, want positive", ttl)
+		}
+		if v, ok := r.Get("list"); !ok || !reflect.DeepEqual(v.(types.List).Range(0, -1), []core.Value{core.Value("a"), core.Value("b")}) {
+			t.Errorf("Decode() list = %v", v)
+		}
+		if v, ok := r.Get("hash"); !ok {
+			t.Errorf("Decode() hash is missing")
+		} else if value, _ := v.(types.Hash).Get("field"); string(value) != "value" {
+			t.Errorf("Decode() hash field = %v", value)
+		} else if v.(types.Hash).Deadline("expiring").IsZero() {
+			t.Errorf("Decode() hash field has no deadline")
+		}
+		if v, ok := r.Get("set"); !ok || !v.(types.Set).IsMember("member") {
+			t.Errorf("Decode() set = %v", v)
+		}
+		wantItems := []types.SortedSetItem{{Member: "two", Score: -2}, {Member: "one", Score: 1.5}}
+		if v, ok := r.Get("zset"); !ok || !reflect.DeepEqual(v.(types.SortedSet).Range(0, -1), wantItems) {
+			t.Errorf("Decode() zset = %v", v)
+		}
+		return nil, nil
+	})
+}
+
+func Test_Decode_Expired(t *testing.T) {
+	e := new(encoder)
+	e.writeHeader(new(Header))
+	e.writeValue("expired", types.NewString(core.Value("a")), time.Now().Add(-time.Second))
+	e.writeValue("alive", types.NewString(core.Value("b")), time.Time{})
+	data := e.end()
+
+	restored := storage.New(nil)
+	if _, err := decode(restored, data); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	keys, _ := restored.Read(func(r storage.Reader) (interface{}, error) {
+		return r.Keys(), nil
+	})
+	if want := []core.StrValue{"alive"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Decode() keys = %v, want %v", keys, want)
+	}
+}
+
+func Test_Decode_ExpiredHash(t *testing.T) {
+	hash := types.NewHash()
+	hash.Set("field", core.Value("value"))
+	hash.SetDeadline("field", time.Now().Add(20*time.Millisecond))
+	e := new(encoder)
+	e.writeHeader(new(Header))
+	e.writeValue("hash", hash, time.Time{})
+	e.writeValue("alive", types.NewString(core.Value("b")), time.Time{})
+	data := e.end()
+	time.Sleep(40 * time.Millisecond)
+
+	restored := storage.New(nil)
+	if _, err := decode(restored, data); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	keys, _ := restored.Read(func(r storage.Reader) (interface{}, error) {
+		return r.Keys(), nil
+	})
+	if want := []core.StrValue{"alive"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Decode() keys = %v, want %v", keys, want)
+	}
+}
+
+func Test_Decode_FarDeadline(t *testing.T) {
+	// the deadline in nanoseconds overflows
+	deadline := time.Date(2286, 11, 20, 17, 46, 40, 123456789, time.UTC)
+	hash := types.NewHash()
+	hash.Set("field", core.Value("value"))
+	hash.SetDeadline("field", deadline)
+	e := new(encoder)
+	e.writeHeader(new(Header))
+	e.writeValue("string", types.NewString(core.Value("a")), deadline)
+	e.writeValue("hash", hash, time.Time{})
+	data := e.end()
+
+	restored := storage.New(nil)
+	if _, err := decode(restored, data); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := deadline.Truncate(time.Millisecond)
+	restored.Read(func(r storage.Reader) (interface{}, error) {
+		if _, ok := r.Get("string"); !ok {
+			t.Errorf("Decode() string is missing")
+		}
+		if v, ok := r.Get("hash"); !ok {
+			t.Errorf("Decode() hash is missing")
+		} else if got := v.(types.Hash).Deadline("field"); !got.Equal(want) {
+			t.Errorf("Decode() hash field deadline = %v, want %v", got, want)
+		}
+		return nil, nil
+	})
+}
+
+func Test_Decode_Invalid(t *testing.T) {
+	data := encode(t, newTestStorage(), new(Header))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: []byte{}},
+		{name: "Truncated", data: data[:len(data)/2]},
+		{name: "Corrupted", data: append([]byte{data[0] + 1}, data[1:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decode(storage.New(nil), tt.data); err != ErrInvalidSnapshot {
+				t.Errorf("Decode() error = %v, want %v", err, ErrInvalidSnapshot)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package snapshot
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/auvn/go.cache/storage"
+)
+
+var (
+	filePerm os.FileMode = 0666
+
+	ErrSaveInProgress = errors.New("background save is already in progress")
+)
+
+// File keeps the snapshot of a storage on the disk.
+type File struct {
+	path   string
+	saving int32
+	mu     sync.Mutex
+}
+
+func (self *File) encode(s storage.Storage, h Header) ([]byte, error) {
+	data, err := s.Read(func(r storage.Reader) (interface{}, error) {
+		h.Created = r.TimeNow()
+		return Encode(r, &h)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// replaces the file at once, so a failed save does not damage the previous snapshot
+func (self *File) write(data []byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	tmpPath := self.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, self.path)
+}
+
+// Save writes the snapshot of the storage, the header describes the journal
+// entries applied to the storage at the moment.
+func (self *File) Save(s storage.Storage, h Header) error {
+	data, err := self.encode(s, h)
+	if err != nil {
+		return err
+	}
+	return self.write(data)
+}
+
+// BackgroundSave takes the snapshot of the storage at once and writes
+// it to the disk in the background. Only the writing is in the background,
+// the keys are encoded by the caller with the storage locked, so the
+// snapshot matches the journal offset of its header.
+func (self *File) BackgroundSave(s storage.Storage, h Header) error {
+	if !atomic.CompareAndSwapInt32(&self.saving, 0, 1) {
+		return ErrSaveInProgress
+	}
+	data, err := self.encode(s, h)
+	if err != nil {
+		atomic.StoreInt32(&self.saving, 0)
+		return err
+	}
+	go func() {
+		defer atomic.StoreInt32(&self.saving, 0)
+		start := time.Now()
+		if err := self.write(data); err != nil {
+			log.Println("cannot save the snapshot:", err)
+		} else {
+			log.Println("snapshot saved in", time.Since(start))
+		}
+	}()
+	return nil
+}
+
+// Load restores the storage from the snapshot, the returned header is empty
+// if there is no snapshot yet. The snapshot is not loaded if it was taken
+// from another journal.
+func (self *File) Load(s storage.Storage, journalID uint64) (*Header, error) {
+	data, err := ioutil.ReadFile(self.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return new(Header), nil
+		}
+		return nil, err
+	}
+	header, err := DecodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.JournalID != journalID {
+		return nil, ErrJournalMismatch
+	}
+	h, err := s.Free(func(w storage.Writer) (interface{}, error) {
+		return Decode(data, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.(*Header), nil
+}
+
+func (self *File) Path() string {
+	return self.path
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
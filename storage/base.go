@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/auvn/go.cache/core"
@@ -8,25 +9,80 @@ import (
 
 const (
 	MaxTTL time.Duration = 1<<63 - 1
+
+	// how many keys are reclaimed between checks of the cleanup budget
+	cleanupBudgetCheck = 20
+)
+
+var (
+	DefaultOptions = &Options{Eviction: NoEviction, Shards: 16}
 )
 
+type Options struct {
+	MaxMemory int // in bytes, zero means no limit
+	Eviction  EvictionPolicy
+	Shards    int // independently locked parts of the storage
+	// called for every removed key, optional
+	OnRemove RemoveHook
+}
+
+// Removal is the reason the key is removed for.
+type Removal int
+
+const (
+	Deleted Removal = iota
+	Expired
+	Evicted
+)
+
+// RemoveHook is called with the shard of the key locked, so it must not
+// access the storage.
+type RemoveHook func(key core.StrValue, reason Removal)
+
 type RawStorage interface {
 	Get(ket core.StrValue) interface{}
 	Set(key core.StrValue, v interface{})
 	Del(key core.StrValue) bool
 	TTL(key core.StrValue) core.IntValue
+	PTTL(key core.StrValue) core.IntValue
 	SetTTL(key core.StrValue, ttl core.IntValue) bool
+	SetDeadline(key core.StrValue, deadline time.Time) bool
+	Persist(key core.StrValue) bool
 	Keys() []core.StrValue
+	Scan(fn ScanFn)
 	TimeNow() time.Time
+	Cleanup(budget time.Duration) core.IntValue
+	Stats() Stats
+	Account(keys []core.StrValue)
+	FreeMemory() error
 }
 
 type rawStorage struct {
-	m map[core.StrValue]*ValueObject
-	h *TTLHeap
+	m     map[core.StrValue]*ValueObject
+	h     *TTLHeap
+	stats Stats
+	opts  *Options
+	// the memory used by all of the shards, it is checked against the limit
+	used *int64
+	// the keys which values have expiring parts by the nearest deadline of the parts
+	parts *TTLHeap
+	// nil until a key of the shard is watched
+	watches watches
 }
 
 func (self *rawStorage) del(key core.StrValue) {
-	delete(self.m, key)
+	if v, ok := self.m[key]; ok {
+		self.grow(-v.size)
+		self.parts.Delete(&v.parts)
+		delete(self.m, key)
+	}
+}
+
+func (self *rawStorage) removed(key core.StrValue, reason Removal) {
+	self.touch(key)
+	if self.opts.OnRemove != nil {
+		self.opts.OnRemove(key, reason)
+	}
 }
 
 func (self *rawStorage) get(key core.StrValue, checkExpired bool) *ValueObject {
@@ -44,19 +100,21 @@ func (self *rawStorage) get(key core.StrValue, checkExpired bool) *ValueObject {
 
 func (self *rawStorage) Get(key core.StrValue) interface{} {
 	if v := self.get(key, true); v != nil {
+		v.Touch(self.TimeNow())
 		return v.Object
 	} else {
 		return nil
 	}
 }
 
-func (self *rawStorage) TTL(key core.StrValue) core.IntValue {
+// the remaining TTL in the units, -1 if the key has no TTL, -2 if the key does not exist
+func (self *rawStorage) ttl(key core.StrValue, unit time.Duration) core.IntValue {
 	var ret core.IntValue
 	if v := self.get(key, true); v != nil {
 		if v.Deadline().IsZero() {
 			ret = -1
 		} else {
-			ret = core.IntValue(v.Deadline().Sub(self.TimeNow()).Seconds())
+			ret = core.IntValue(v.Deadline().Sub(self.TimeNow()) / unit)
 		}
 	} else {
 		ret = -2
@@ -64,19 +122,29 @@ func (self *rawStorage) TTL(key core.StrValue) core.IntValue {
 	return ret
 }
 
-func (self *rawStorage) Set(key core.StrValue, v interface{}) {
-	self.Cleanup()
-	self.m[key] = NewValueObject(v)
+func (self *rawStorage) TTL(key core.StrValue) core.IntValue {
+	return self.ttl(key, time.Second)
 }
 
-func (self *rawStorage) SetTTL(key core.StrValue, ttl core.IntValue) bool {
-	defer self.Cleanup()
+func (self *rawStorage) PTTL(key core.StrValue) core.IntValue {
+	return self.ttl(key, time.Millisecond)
+}
 
-	v := self.get(key, true)
-	if v == nil {
-		return false
+func (self *rawStorage) Set(key core.StrValue, v interface{}) {
+	self.cleanup(0)
+	if old, ok := self.m[key]; ok {
+		self.h.Delete(old)
+		self.del(key)
 	}
+	value := NewValueObject(v)
+	value.Touch(self.TimeNow())
+	value.size = sizeOf(key, v)
+	self.grow(value.size)
+	self.m[key] = value
+	self.touch(key)
+}
 
+func (self *rawStorage) SetTTL(key core.StrValue, ttl core.IntValue) bool {
 	ttlValue := ttl.Value()
 
 	if ttlValue < 0 {
@@ -87,12 +155,35 @@ func (self *rawStorage) SetTTL(key core.StrValue, ttl core.IntValue) bool {
 	if ttlDuration < 0 {
 		ttlDuration = MaxTTL
 	}
-	deadline := self.TimeNow().Add(ttlDuration)
+	return self.SetDeadline(key, self.TimeNow().Add(ttlDuration))
+}
+
+func (self *rawStorage) SetDeadline(key core.StrValue, deadline time.Time) bool {
+	defer self.cleanup(0)
+
+	v := self.get(key, true)
+	if v == nil {
+		return false
+	}
+
 	if v.UpdateDeadline(deadline) {
 		self.h.Fix(v)
 	} else {
 		self.h.Push(key, v)
 	}
+	self.touch(key)
+	return true
+}
+
+// removes the TTL of the key, false if the key does not exist or has no TTL
+func (self *rawStorage) Persist(key core.StrValue) bool {
+	v := self.get(key, true)
+	if v == nil || v.Deadline().IsZero() {
+		return false
+	}
+	self.h.Delete(v)
+	v.UpdateDeadline(time.Time{})
+	self.touch(key)
 	return true
 }
 
@@ -100,6 +191,7 @@ func (self *rawStorage) Del(key core.StrValue) bool {
 	if v := self.get(key, true); v != nil {
 		self.del(key)
 		self.h.Delete(v)
+		self.removed(key, Deleted)
 		return true
 	}
 	return false
@@ -119,49 +211,285 @@ func (self *rawStorage) Keys() []core.StrValue {
 	return keys
 }
 
-func (self *rawStorage) Cleanup() {
-	for {
-		if key, ok := self.h.PopExpired(self.TimeNow()); ok {
-			// making sure the heap has fresh information about the key
-			if v := self.get(key, false); v != nil && v.Expired(self.TimeNow()) {
-				self.Del(key)
+func (self *rawStorage) Scan(fn ScanFn) {
+	now := self.TimeNow()
+	for k, v := range self.m {
+		if !v.Expired(now) {
+			fn(k, v.Object, v.Deadline())
+		}
+	}
+}
+
+// removes expired keys until there are none left or the budget is spent,
+// zero budget means no limit
+func (self *rawStorage) cleanup(budget time.Duration) int {
+	now := self.TimeNow()
+	stop := now.Add(budget)
+	var counter int
+	for i := 1; ; i++ {
+		key, ok := self.h.PopExpired(now)
+		if !ok {
+			break
+		}
+		// making sure the heap has fresh information about the key
+		if v := self.get(key, false); v != nil && v.Expired(now) {
+			self.del(key)
+			self.removed(key, Expired)
+			counter += 1
+		}
+		if budget > 0 && i%cleanupBudgetCheck == 0 && self.TimeNow().After(stop) {
+			self.stats.ExpiredKeys += counter
+			return counter
+		}
+	}
+	self.stats.ExpiredKeys += counter
+	self.cleanupParts(now, stop, budget)
+	return counter
+}
+
+// removes expired parts of the values the same way the expired keys are removed
+func (self *rawStorage) cleanupParts(now, stop time.Time, budget time.Duration) {
+	for i := 1; ; i++ {
+		key, ok := self.parts.PopExpired(now)
+		if !ok {
+			break
+		}
+		if v := self.get(key, false); v != nil {
+			e, ok := v.Object.(Expiring)
+			if ok {
+				self.stats.ExpiredFields += e.ExpireParts(now)
 			}
-		} else {
+			if ok && e.Len() == 0 {
+				self.h.Delete(v)
+				self.del(key)
+				self.removed(key, Expired)
+				self.stats.ExpiredKeys += 1
+			} else {
+				self.account(key)
+				self.touch(key)
+			}
+		}
+		if budget > 0 && i%cleanupBudgetCheck == 0 && self.TimeNow().After(stop) {
+			break
+		}
+	}
+}
+
+// active expiry cycle
+func (self *rawStorage) Cleanup(budget time.Duration) core.IntValue {
+	counter := self.cleanup(budget)
+	self.stats.ExpireCycles += 1
+	self.stats.ActiveExpiredKeys += counter
+	return core.IntValue(counter)
+}
+
+func (self *rawStorage) Stats() Stats {
+	stats := self.stats
+	stats.Keys = len(self.m)
+	stats.Expires = self.h.Len()
+	stats.MaxMemory = self.opts.MaxMemory
+	return stats
+}
+
+func (self *rawStorage) grow(size int) {
+	self.stats.UsedMemory += size
+	atomic.AddInt64(self.used, int64(size))
+}
+
+func (self *rawStorage) fits() bool {
+	return self.opts.MaxMemory <= 0 || atomic.LoadInt64(self.used) <= int64(self.opts.MaxMemory)
+}
+
+// updates the memory used by the values of the keys, which might have been
+// modified in place, the keys are changed for the watches
+func (self *rawStorage) Account(keys []core.StrValue) {
+	for _, key := range keys {
+		self.account(key)
+		self.touch(key)
+	}
+}
+
+func (self *rawStorage) account(key core.StrValue) {
+	v, ok := self.m[key]
+	if !ok {
+		return
+	}
+	size := sizeOf(key, v.Object)
+	self.grow(size - v.size)
+	v.size = size
+	self.trackParts(key, v)
+}
+
+// keeps the nearest deadline of the expiring parts of the value in the heap
+func (self *rawStorage) trackParts(key core.StrValue, v *ValueObject) {
+	e, ok := v.Object.(Expiring)
+	if !ok {
+		return
+	}
+	deadline := e.NextDeadline()
+	switch {
+	case deadline.IsZero():
+		self.parts.Delete(&v.parts)
+		v.parts.deadline = deadline
+	case v.parts.index < 0:
+		v.parts.deadline = deadline
+		self.parts.Push(key, &v.parts)
+	case !deadline.Equal(v.parts.deadline):
+		v.parts.deadline = deadline
+		self.parts.Fix(&v.parts)
+	}
+}
+
+// evicts keys of the shard until the memory used by all of the shards fits the limit
+func (self *rawStorage) FreeMemory() error {
+	if !self.evict() {
+		return ErrOutOfMemory
+	}
+	return nil
+}
+
+// false if the shard has no keys to evict, but the limit is still exceeded
+func (self *rawStorage) evict() bool {
+	for !self.fits() {
+		key, ok := self.opts.Eviction.Victim(self)
+		if !ok {
+			return false
+		}
+		if v, ok := self.m[key]; ok {
+			self.h.Delete(v)
+			self.del(key)
+			self.removed(key, Evicted)
+			self.stats.EvictedKeys += 1
+		}
+	}
+	return true
+}
+
+func (self *rawStorage) Sample(n int) []EvictionCandidate {
+	candidates := make([]EvictionCandidate, 0, n)
+	for k, v := range self.m {
+		if len(candidates) == n {
 			break
 		}
+		candidates = append(candidates, EvictionCandidate{Key: k, Value: v})
 	}
+	return candidates
+}
+
+func (self *rawStorage) Soonest() (core.StrValue, bool) {
+	return self.h.Peek()
 }
 
+// zero deadline means the key has no TTL
+type ScanFn func(key core.StrValue, v interface{}, deadline time.Time)
 type WriteFn func(Writer) (interface{}, error)
 type ReadFn func(Reader) (interface{}, error)
+type AtomicFn func(Storage) (interface{}, error)
 
+// Storage is split into shards by the hash of keys. The functions lock only the
+// shards of the given keys and must not access other keys, without keys all of
+// the shards are locked.
 type Storage interface {
-	Write(fn WriteFn) (interface{}, error)
-	Read(fn ReadFn) (interface{}, error)
+	// fails with ErrOutOfMemory if the memory limit is reached and
+	// no keys can be evicted
+	Write(fn WriteFn, keys ...core.StrValue) (interface{}, error)
+	// a write which does not allocate memory, e.g. removal of keys,
+	// it is allowed when the memory limit is reached
+	Free(fn WriteFn, keys ...core.StrValue) (interface{}, error)
+	Read(fn ReadFn, keys ...core.StrValue) (interface{}, error)
+	// Watch starts tracking the changes of the keys until the watch is closed.
+	Watch(keys ...core.StrValue) (*Watch, error)
+	// Atomic runs fn with all of the shards locked, so the accesses of fn are not
+	// interleaved with the other ones. The storage passed to fn must not be used after it returns.
+	Atomic(fn AtomicFn) (interface{}, error)
 }
 
 type BaseStorage struct {
-	reader Reader
-	writer Writer
+	shards []*shard
 }
 
-func (self *BaseStorage) Write(fn WriteFn) (interface{}, error) {
-	return fn(self.writer)
+func (self *BaseStorage) shardSet(keys []core.StrValue) *shardSet {
+	set := &shardSet{all: self.shards}
+	set.locked = set.pick(keys)
+	return set
 }
 
-func (self *BaseStorage) Read(fn ReadFn) (interface{}, error) {
-	return fn(self.reader)
+func (self *BaseStorage) lock(keys []core.StrValue) *shardSet {
+	set := self.shardSet(keys)
+	for _, s := range set.locked {
+		s.rw.Lock()
+	}
+	return set
+}
+
+func (self *BaseStorage) unlock(set *shardSet) {
+	for i := len(set.locked) - 1; i >= 0; i-- {
+		set.locked[i].rw.Unlock()
+	}
+}
+
+func (self *BaseStorage) rlock(keys []core.StrValue) *shardSet {
+	set := self.shardSet(keys)
+	for _, s := range set.locked {
+		s.rw.RLock()
+	}
+	return set
 }
 
-func New() Storage {
-	rawStorage := &rawStorage{
-		m: map[core.StrValue]*ValueObject{},
-		h: NewTTLHeap(),
+func (self *BaseStorage) runlock(set *shardSet) {
+	for i := len(set.locked) - 1; i >= 0; i-- {
+		set.locked[i].rw.RUnlock()
 	}
-	reader := &reader{storage: rawStorage}
-	writer := &writer{Reader: reader, storage: rawStorage}
-	return &BaseStorage{
-		reader: reader,
-		writer: writer,
+}
+
+func (self *BaseStorage) write(set *shardSet, fn WriteFn) (interface{}, error) {
+	w := &writer{Reader: &reader{storage: set}, storage: set}
+	defer w.account()
+	return fn(w)
+}
+
+func (self *BaseStorage) Write(fn WriteFn, keys ...core.StrValue) (interface{}, error) {
+	set := self.lock(keys)
+	defer self.unlock(set)
+	if err := set.FreeMemory(); err != nil {
+		return nil, err
+	}
+	return self.write(set, fn)
+}
+
+func (self *BaseStorage) Free(fn WriteFn, keys ...core.StrValue) (interface{}, error) {
+	set := self.lock(keys)
+	defer self.unlock(set)
+	return self.write(set, fn)
+}
+
+func (self *BaseStorage) Read(fn ReadFn, keys ...core.StrValue) (interface{}, error) {
+	set := self.rlock(keys)
+	defer self.runlock(set)
+	return fn(&reader{storage: set})
+}
+
+func New(opts *Options) Storage {
+	if opts == nil {
+		opts = DefaultOptions
+	}
+	n := opts.Shards
+	if n < 1 {
+		n = 1
+	}
+	// the memory limit is shared by the shards
+	used := new(int64)
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{
+			storage: &rawStorage{
+				m:     map[core.StrValue]*ValueObject{},
+				h:     NewTTLHeap(),
+				parts: NewTTLHeap(),
+				opts:  opts,
+				used:  used,
+			},
+		}
 	}
+	return &BaseStorage{shards: shards}
 }
@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+func newTestRawStorage() *rawStorage {
+	return &rawStorage{
+		m:     map[core.StrValue]*ValueObject{},
+		h:     NewTTLHeap(),
+		opts:  DefaultOptions,
+		parts: NewTTLHeap(),
+		used:  new(int64),
+	}
+}
+
+func Test_rawStorage_Cleanup(t *testing.T) {
+	tests := []struct {
+		name        string
+		expired     []core.StrValue
+		alive       []core.StrValue
+		persisted   []core.StrValue
+		wantCleaned core.IntValue
+		wantKeys    int
+	}{
+		{
+			name:        "Expired",
+			expired:     []core.StrValue{"a", "b", "c"},
+			alive:       []core.StrValue{"d"},
+			wantCleaned: 3,
+			wantKeys:    1,
+		},
+		{
+			name:        "Persisted",
+			expired:     []core.StrValue{"a", "b"},
+			persisted:   []core.StrValue{"b"},
+			wantCleaned: 1,
+			wantKeys:    1,
+		},
+		{
+			name:        "Nothing",
+			alive:       []core.StrValue{"a", "b"},
+			wantCleaned: 0,
+			wantKeys:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := newTestRawStorage()
+			for _, k := range tt.alive {
+				self.Set(k, k)
+				self.SetDeadline(k, self.TimeNow().Add(time.Hour))
+			}
+			for _, k := range tt.expired {
+				self.m[k] = NewValueObject(k)
+				self.m[k].UpdateDeadline(self.TimeNow().Add(-time.Second))
+				self.h.Push(k, self.m[k])
+			}
+			for _, k := range tt.persisted {
+				self.m[k].UpdateDeadline(time.Time{})
+				self.h.Delete(self.m[k])
+			}
+			if got := self.Cleanup(0); got != tt.wantCleaned {
+				t.Errorf("rawStorage.Cleanup() = %v, want %v", got, tt.wantCleaned)
+			}
+			stats := self.Stats()
+			if stats.Keys != tt.wantKeys {
+				t.Errorf("rawStorage.Stats().Keys = %v, want %v", stats.Keys, tt.wantKeys)
+			}
+			if stats.ActiveExpiredKeys != int(tt.wantCleaned) {
+				t.Errorf("rawStorage.Stats().ActiveExpiredKeys = %v, want %v", stats.ActiveExpiredKeys, tt.wantCleaned)
+			}
+		})
+	}
+}
+
+// the parts are the deadlines ordered from the nearest one
+type testExpiringValue struct {
+	deadlines []time.Time
+}
+
+func (self *testExpiringValue) NextDeadline() time.Time {
+	if len(self.deadlines) == 0 {
+		return time.Time{}
+	}
+	return self.deadlines[0]
+}
+
+func (self *testExpiringValue) ExpireParts(now time.Time) int {
+	var counter int
+	for len(self.deadlines) > 0 && self.deadlines[0].Before(now) {
+		self.deadlines = self.deadlines[1:]
+		counter += 1
+	}
+	return counter
+}
+
+func (self *testExpiringValue) Len() core.IntValue {
+	return core.IntValue(len(self.deadlines))
+}
+
+func (self *testExpiringValue) Size() int {
+	return 10 * len(self.deadlines)
+}
+
+func Test_rawStorage_CleanupParts(t *testing.T) {
+	s := newTestRawStorage()
+	now := s.TimeNow()
+	v := &testExpiringValue{deadlines: []time.Time{now.Add(-2 * time.Second), now.Add(-time.Second), now.Add(time.Hour)}}
+	s.Set("a", v)
+	s.Set("b", &testExpiringValue{})
+	// the value without parts left is removed
+	s.Set("c", &testExpiringValue{deadlines: []time.Time{now.Add(-time.Second)}})
+	s.Account([]core.StrValue{"a", "b", "c"})
+	if got := s.parts.Len(); got != 2 {
+		t.Fatalf("parts heap len = %d, want 2", got)
+	}
+
+	if got := s.Cleanup(0); got != 0 {
+		t.Errorf("Cleanup() = %v, want no expired keys", got)
+	}
+	stats := s.Stats()
+	if stats.ExpiredFields != 3 || len(v.deadlines) != 1 {
+		t.Errorf("ExpiredFields = %v, parts left = %v, want 3 and 1", stats.ExpiredFields, len(v.deadlines))
+	}
+	if _, ok := s.m["c"]; ok || stats.ExpiredKeys != 1 {
+		t.Errorf("the value without parts is kept, ExpiredKeys = %v", stats.ExpiredKeys)
+	}
+	if want := sizeOf("a", v) + sizeOf("b", &testExpiringValue{}); stats.UsedMemory != want {
+		t.Errorf("UsedMemory = %v, want %v", stats.UsedMemory, want)
+	}
+	// the value stays in the heap with its next deadline
+	if got := s.parts.Len(); got != 1 {
+		t.Errorf("parts heap len = %d, want 1", got)
+	}
+	s.Del("a")
+	if got := s.parts.Len(); got != 0 {
+		t.Errorf("parts heap len after Del = %d, want 0", got)
+	}
+}
+
+type testSizedValue int
+
+func (self testSizedValue) Size() int {
+	return int(self)
+}
+
+func Test_rawStorage_Del(t *testing.T) {
+	s := newTestRawStorage()
+	now := s.TimeNow()
+	keys := make([]core.StrValue, 0)
+	for i := 0; i < 50; i++ {
+		key := core.StrValue(fmt.Sprint(i))
+		keys = append(keys, key)
+		s.Set(key, i)
+		s.SetDeadline(key, now.Add(time.Duration(i%7+1)*time.Hour))
+	}
+	// removal from the middle of the heap keeps the indexes of the rest
+	for _, i := range rand.Perm(len(keys)) {
+		if !s.Del(keys[i]) {
+			t.Fatalf("Del(%s) = false", keys[i])
+		}
+	}
+	if s.h.Len() != 0 {
+		t.Errorf("TTL heap len = %d, want 0", s.h.Len())
+	}
+}
+
+func Test_rawStorage_FreeMemory(t *testing.T) {
+	keySize := sizeOf("a", testSizedValue(100))
+	tests := []struct {
+		name        string
+		eviction    EvictionPolicy
+		volatile    []core.StrValue
+		wantErr     error
+		wantEvicted []core.StrValue
+	}{
+		{
+			name:     "NoEviction",
+			eviction: NoEviction,
+			wantErr:  ErrOutOfMemory,
+		},
+		{
+			name:        "LRU",
+			eviction:    AllKeysLRUEviction,
+			wantEvicted: []core.StrValue{"a"},
+		},
+		{
+			name:        "LFU",
+			eviction:    AllKeysLFUEviction,
+			wantEvicted: []core.StrValue{"b"},
+		},
+		{
+			name:        "VolatileTTL",
+			eviction:    VolatileTTLEviction,
+			volatile:    []core.StrValue{"c"},
+			wantEvicted: []core.StrValue{"c"},
+		},
+		{
+			name:     "VolatileTTLNothing",
+			eviction: VolatileTTLEviction,
+			wantErr:  ErrOutOfMemory,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := newTestRawStorage()
+			self.opts = &Options{MaxMemory: 2 * keySize, Eviction: tt.eviction}
+			now := self.TimeNow()
+			for i, k := range []core.StrValue{"a", "b", "c"} {
+				self.Set(k, testSizedValue(100))
+				self.m[k].accessed = now.Add(time.Duration(i) * time.Second).UnixNano()
+			}
+			self.m["a"].hits = 10
+			self.m["c"].hits = 5
+			for _, k := range tt.volatile {
+				self.SetDeadline(k, now.Add(time.Hour))
+			}
+			if err := self.FreeMemory(); err != tt.wantErr {
+				t.Errorf("rawStorage.FreeMemory() error = %v, want %v", err, tt.wantErr)
+			}
+			for _, k := range tt.wantEvicted {
+				if _, ok := self.m[k]; ok {
+					t.Errorf("rawStorage.FreeMemory() did not evict %v", k)
+				}
+			}
+			stats := self.Stats()
+			if stats.EvictedKeys != len(tt.wantEvicted) {
+				t.Errorf("rawStorage.Stats().EvictedKeys = %v, want %v", stats.EvictedKeys, len(tt.wantEvicted))
+			}
+			if want := (3 - len(tt.wantEvicted)) * keySize; stats.UsedMemory != want {
+				t.Errorf("rawStorage.Stats().UsedMemory = %v, want %v", stats.UsedMemory, want)
+			}
+		})
+	}
+}
+
+func Test_BaseStorage_Shards(t *testing.T) {
+	self := New(&Options{Eviction: NoEviction, Shards: 4})
+	keys := []core.StrValue{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, k := range keys {
+		self.Write(func(w Writer) (interface{}, error) {
+			w.Set(k, k)
+			return nil, nil
+		}, k)
+	}
+
+	if got := len(self.(*BaseStorage).shardSet(keys).locked); got < 2 {
+		t.Fatalf("keys are placed into %v shards, want several", got)
+	}
+
+	all, _ := self.Read(func(r Reader) (interface{}, error) {
+		return r.Keys(), nil
+	})
+	if got := len(all.([]core.StrValue)); got != len(keys) {
+		t.Errorf("Storage.Read() Keys() = %v keys, want %v", got, len(keys))
+	}
+
+	deleted, _ := self.Free(func(w Writer) (interface{}, error) {
+		var counter int
+		for _, k := range keys[:5] {
+			if w.Delete(k) {
+				counter += 1
+			}
+		}
+		return counter, nil
+	}, keys[:5]...)
+	if deleted != 5 {
+		t.Errorf("Storage.Free() deleted = %v, want %v", deleted, 5)
+	}
+
+	stats, _ := self.Read(func(r Reader) (interface{}, error) {
+		return r.Stats(), nil
+	})
+	if got := stats.(Stats).Keys; got != len(keys)-5 {
+		t.Errorf("Storage.Read() Stats().Keys = %v, want %v", got, len(keys)-5)
+	}
+}
+
+func Test_BaseStorage_MaxMemory(t *testing.T) {
+	keySize := sizeOf("a", testSizedValue(100))
+	// each shard is below the limit, but all of them are not
+	self := New(&Options{MaxMemory: 2 * keySize, Eviction: AllKeysLRUEviction, Shards: 8})
+	shards := make(map[*rawStorage]bool)
+	for _, k := range []core.StrValue{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		set := self.(*BaseStorage).shardSet([]core.StrValue{k})
+		if s := set.route(k); shards[s] {
+			continue
+		} else {
+			shards[s] = true
+		}
+		if _, err := self.Write(func(w Writer) (interface{}, error) {
+			w.Set(k, testSizedValue(100))
+			return nil, nil
+		}, k); err != nil {
+			t.Fatalf("Storage.Write() error = %v", err)
+		}
+	}
+	if len(shards) < 4 {
+		t.Fatalf("keys are placed into %v shards, want several", len(shards))
+	}
+
+	stats, _ := self.Read(func(r Reader) (interface{}, error) {
+		return r.Stats(), nil
+	})
+	got := stats.(Stats)
+	// the last write is accounted after the eviction
+	if got.Keys != 3 || got.UsedMemory != 3*keySize || got.EvictedKeys != len(shards)-3 {
+		t.Errorf("Stats() = %+v, want 3 keys left", got)
+	}
+	if got.MaxMemory != 2*keySize {
+		t.Errorf("Stats().MaxMemory = %v, want %v", got.MaxMemory, 2*keySize)
+	}
+}
+
+func Test_BaseStorage_Watch(t *testing.T) {
+	self := New(&Options{Eviction: NoEviction, Shards: 4})
+	set := func(key core.StrValue) {
+		self.Write(func(w Writer) (interface{}, error) {
+			w.Set(key, key)
+			return nil, nil
+		}, key)
+	}
+	set("a")
+	self.Write(func(w Writer) (interface{}, error) {
+		w.Set("ttl", "ttl")
+		w.SetDeadline("ttl", w.TimeNow().Add(50*time.Millisecond))
+		return nil, nil
+	}, "ttl")
+
+	watch, _ := self.Watch("a", "missing")
+	set("b")
+	if watch.Changed() {
+		t.Errorf("Changed() = true after a write of the other key")
+	}
+	set("missing")
+	if !watch.Changed() {
+		t.Errorf("Changed() = false after a write of the missing key")
+	}
+	select {
+	case <-watch.Done():
+	default:
+		t.Errorf("Done() is not closed after a write of the missing key")
+	}
+	set("a")
+	watch.Close()
+
+	// the values got by the writes might be modified in place
+	watch, _ = self.Watch("a")
+	self.Write(func(w Writer) (interface{}, error) {
+		w.Get("a")
+		return nil, nil
+	}, "a")
+	if !watch.Changed() {
+		t.Errorf("Changed() = false after an in place write")
+	}
+	watch.Close()
+
+	watch, _ = self.Watch("a")
+	self.Free(func(w Writer) (interface{}, error) {
+		return w.Delete("a"), nil
+	}, "a")
+	if !watch.Changed() {
+		t.Errorf("Changed() = false after the removal")
+	}
+	watch.Close()
+
+	watch, _ = self.Watch("ttl")
+	time.Sleep(60 * time.Millisecond)
+	if !watch.Changed() {
+		t.Errorf("Changed() = false after the expiry")
+	}
+	watch.Close()
+	for _, s := range self.(*BaseStorage).shards {
+		if n := len(s.storage.watches); n != 0 {
+			t.Errorf("watches left after Close() = %d", n)
+		}
+	}
+
+	_, err := self.Atomic(func(s Storage) (interface{}, error) {
+		if _, err := s.Watch("a"); err != ErrWatchInAtomic {
+			t.Errorf("Watch() within Atomic() error = %v", err)
+		}
+		return s.Write(func(w Writer) (interface{}, error) {
+			w.Set("c", "c")
+			return nil, nil
+		}, "c")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+const (
+	// how many random keys are compared to pick the one to evict
+	evictionSamples = 5
+
+	// approximate memory overhead of a single key
+	keyOverhead = 64
+)
+
+var (
+	ErrOutOfMemory           = errors.New("out of memory")
+	ErrUnknownEvictionPolicy = errors.New("unknown eviction policy")
+
+	NoEviction          EvictionPolicy = new(noEviction)
+	AllKeysLRUEviction  EvictionPolicy = new(lruEviction)
+	AllKeysLFUEviction  EvictionPolicy = new(lfuEviction)
+	VolatileTTLEviction EvictionPolicy = new(volatileTTLEviction)
+
+	EvictionPolicies = map[string]EvictionPolicy{
+		"noeviction":   NoEviction,
+		"allkeys-lru":  AllKeysLRUEviction,
+		"allkeys-lfu":  AllKeysLFUEviction,
+		"volatile-ttl": VolatileTTLEviction,
+	}
+)
+
+type Sizer interface {
+	Size() int
+}
+
+// approximate memory used by the key and its value
+func sizeOf(key core.StrValue, v interface{}) int {
+	size := len(key) + keyOverhead
+	if s, ok := v.(Sizer); ok {
+		size += s.Size()
+	}
+	return size
+}
+
+type EvictionCandidate struct {
+	Key   core.StrValue
+	Value *ValueObject
+}
+
+type EvictionPool interface {
+	// up to n random keys of the storage
+	Sample(n int) []EvictionCandidate
+	// the key with the nearest deadline
+	Soonest() (core.StrValue, bool)
+	TimeNow() time.Time
+}
+
+type EvictionPolicy interface {
+	// the key to evict, false if there is nothing to evict
+	Victim(pool EvictionPool) (core.StrValue, bool)
+}
+
+type noEviction struct{}
+
+func (self *noEviction) Victim(pool EvictionPool) (core.StrValue, bool) {
+	return core.EmptyStrValue, false
+}
+
+// picks the sampled key with the least score
+func sampleVictim(pool EvictionPool, score func(*ValueObject) int64) (core.StrValue, bool) {
+	var victim core.StrValue
+	var found bool
+	var min int64
+	for _, c := range pool.Sample(evictionSamples) {
+		if s := score(c.Value); !found || s < min {
+			victim, min, found = c.Key, s, true
+		}
+	}
+	return victim, found
+}
+
+type lruEviction struct{}
+
+func (self *lruEviction) Victim(pool EvictionPool) (core.StrValue, bool) {
+	return sampleVictim(pool, func(v *ValueObject) int64 {
+		return v.Accessed().UnixNano()
+	})
+}
+
+type lfuEviction struct{}
+
+func (self *lfuEviction) Victim(pool EvictionPool) (core.StrValue, bool) {
+	now := pool.TimeNow()
+	return sampleVictim(pool, func(v *ValueObject) int64 {
+		return int64(v.Frequency(now))
+	})
+}
+
+type volatileTTLEviction struct{}
+
+func (self *volatileTTLEviction) Victim(pool EvictionPool) (core.StrValue, bool) {
+	return pool.Soonest()
+}
+
+func LookupEvictionPolicy(name string) (EvictionPolicy, error) {
+	if p, ok := EvictionPolicies[name]; ok {
+		return p, nil
+	}
+	return nil, ErrUnknownEvictionPolicy
+}
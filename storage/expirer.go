@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/auvn/go.cache/util/sync"
+)
+
+var (
+	_ (sync.Server) = (*Expirer)(nil)
+
+	DefaultExpirerOptions = &ExpirerOptions{
+		Interval: 100 * time.Millisecond,
+		Budget:   25 * time.Millisecond,
+	}
+)
+
+type ExpirerOptions struct {
+	Interval time.Duration
+	Budget   time.Duration // max time spent in a single cycle
+}
+
+// Expirer periodically reclaims expired keys, so they do not stay in memory
+// until the next write to the storage.
+type Expirer struct {
+	storage Storage
+	opts    *ExpirerOptions
+}
+
+func (self *Expirer) cycle() {
+	self.storage.Free(func(w Writer) (interface{}, error) {
+		return w.Cleanup(self.opts.Budget), nil
+	})
+}
+
+func (self *Expirer) loopCycles(quit sync.Quit) {
+	ticker := time.NewTicker(self.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			self.cycle()
+		}
+	}
+}
+
+func (self *Expirer) Serve(quit sync.Quit) error {
+	self.loopCycles(quit)
+	return nil
+}
+
+func NewExpirer(s Storage, opts *ExpirerOptions) *Expirer {
+	if opts == nil {
+		opts = DefaultExpirerOptions
+	}
+	return &Expirer{storage: s, opts: opts}
+}
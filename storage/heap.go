@@ -32,8 +32,8 @@ func (self ttlQueue) Less(i, j int) bool {
 
 func (self ttlQueue) Swap(i, j int) {
 	self[i], self[j] = self[j], self[i]
-	self[i].SetIndex(j)
-	self[j].SetIndex(i)
+	self[i].SetIndex(i)
+	self[j].SetIndex(j)
 }
 
 func (self *ttlQueue) Push(x interface{}) {
@@ -48,7 +48,7 @@ func (self *ttlQueue) Pop() interface{} {
 	hlen := len(h)
 	k := h[hlen-1]
 	*self = h[:hlen-1]
-	k.SetIndex(1)
+	k.SetIndex(-1)
 	return k
 }
 
@@ -88,6 +88,19 @@ func (self *TTLHeap) PopExpired(now time.Time) (core.StrValue, bool) {
 	return core.EmptyStrValue, false
 }
 
+// the key with the nearest deadline
+func (self *TTLHeap) Peek() (core.StrValue, bool) {
+	arr := *self.h
+	if arr.Len() <= 0 {
+		return core.EmptyStrValue, false
+	}
+	return arr[0].(*keyTTL).key, true
+}
+
+func (self *TTLHeap) Len() int {
+	return self.h.Len()
+}
+
 func (self *TTLHeap) Fix(i Indexable) {
 	index := i.Index()
 	if index < 0 {
@@ -1,13 +1,20 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/auvn/go.cache/core"
 )
 
 type Reader interface {
 	Get(key core.StrValue) (interface{}, bool)
 	TTL(key core.StrValue) core.IntValue
+	PTTL(key core.StrValue) core.IntValue
 	Keys() []core.StrValue
+	// calls the function for every key which is not expired
+	Scan(fn ScanFn)
+	TimeNow() time.Time
+	Stats() Stats
 }
 
 type reader struct {
@@ -25,6 +32,22 @@ func (self *reader) TTL(key core.StrValue) core.IntValue {
 	return self.storage.TTL(key)
 }
 
+func (self *reader) PTTL(key core.StrValue) core.IntValue {
+	return self.storage.PTTL(key)
+}
+
 func (self *reader) Keys() []core.StrValue {
 	return self.storage.Keys()
 }
+
+func (self *reader) Scan(fn ScanFn) {
+	self.storage.Scan(fn)
+}
+
+func (self *reader) TimeNow() time.Time {
+	return self.storage.TimeNow()
+}
+
+func (self *reader) Stats() Stats {
+	return self.storage.Stats()
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+var (
+	_ (RawStorage) = (*shardSet)(nil)
+)
+
+type shard struct {
+	rw      sync.RWMutex
+	storage *rawStorage
+}
+
+// FNV-1a
+func shardHash(key core.StrValue) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// shardSet routes keys to their shards and aggregates the whole storage
+// operations over the locked shards
+type shardSet struct {
+	all    []*shard
+	locked []*shard
+}
+
+func (self *shardSet) route(key core.StrValue) *rawStorage {
+	return self.all[shardHash(key)%uint32(len(self.all))].storage
+}
+
+// shards of the keys ordered by index, all of the shards if there are no keys
+func (self *shardSet) pick(keys []core.StrValue) []*shard {
+	if len(keys) == 0 {
+		return self.all
+	}
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]struct{}, len(keys))
+	for _, k := range keys {
+		i := int(shardHash(k) % uint32(len(self.all)))
+		if _, ok := seen[i]; !ok {
+			seen[i] = struct{}{}
+			indexes = append(indexes, i)
+		}
+	}
+	// the same locking order prevents deadlocks between multi-key operations
+	sort.Ints(indexes)
+	shards := make([]*shard, len(indexes))
+	for i, index := range indexes {
+		shards[i] = self.all[index]
+	}
+	return shards
+}
+
+func (self *shardSet) Get(key core.StrValue) interface{} {
+	return self.route(key).Get(key)
+}
+
+func (self *shardSet) Set(key core.StrValue, v interface{}) {
+	self.route(key).Set(key, v)
+}
+
+func (self *shardSet) Del(key core.StrValue) bool {
+	return self.route(key).Del(key)
+}
+
+func (self *shardSet) TTL(key core.StrValue) core.IntValue {
+	return self.route(key).TTL(key)
+}
+
+func (self *shardSet) PTTL(key core.StrValue) core.IntValue {
+	return self.route(key).PTTL(key)
+}
+
+func (self *shardSet) SetTTL(key core.StrValue, ttl core.IntValue) bool {
+	return self.route(key).SetTTL(key, ttl)
+}
+
+func (self *shardSet) SetDeadline(key core.StrValue, deadline time.Time) bool {
+	return self.route(key).SetDeadline(key, deadline)
+}
+
+func (self *shardSet) Persist(key core.StrValue) bool {
+	return self.route(key).Persist(key)
+}
+
+func (self *shardSet) Keys() []core.StrValue {
+	keys := make([]core.StrValue, 0)
+	for _, s := range self.locked {
+		keys = append(keys, s.storage.Keys()...)
+	}
+	return keys
+}
+
+func (self *shardSet) Scan(fn ScanFn) {
+	for _, s := range self.locked {
+		s.storage.Scan(fn)
+	}
+}
+
+func (self *shardSet) TimeNow() time.Time {
+	return time.Now().UTC()
+}
+
+// the budget is split between the shards
+func (self *shardSet) Cleanup(budget time.Duration) core.IntValue {
+	var counter core.IntValue
+	for _, s := range self.locked {
+		counter += s.storage.Cleanup(budget / time.Duration(len(self.locked)))
+	}
+	return counter
+}
+
+func (self *shardSet) Stats() Stats {
+	var stats Stats
+	for _, s := range self.locked {
+		stats = stats.add(s.storage.Stats())
+	}
+	return stats
+}
+
+func (self *shardSet) Account(keys []core.StrValue) {
+	for _, k := range keys {
+		s := self.route(k)
+		s.account(k)
+		s.touch(k)
+	}
+}
+
+func (self *shardSet) isLocked(s *shard) bool {
+	for _, locked := range self.locked {
+		if locked == s {
+			return true
+		}
+	}
+	return false
+}
+
+// evicts keys of the locked shards first, then of the other ones which are not
+// busy, the busy ones are freed by their writers
+func (self *shardSet) FreeMemory() error {
+	for _, s := range self.locked {
+		if s.storage.evict() {
+			return nil
+		}
+	}
+	for _, s := range self.all {
+		if self.isLocked(s) || !s.rw.TryLock() {
+			continue
+		}
+		fits := s.storage.evict()
+		s.rw.Unlock()
+		if fits {
+			return nil
+		}
+	}
+	return ErrOutOfMemory
+}
@@ -0,0 +1,30 @@
+package storage
+
+type Stats struct {
+	Keys              int // including expired but not yet reclaimed ones
+	Expires           int // keys with a TTL
+	ExpiredKeys       int // reclaimed expired keys
+	ActiveExpiredKeys int // reclaimed by the active expiry cycle
+	ExpireCycles      int
+	ExpiredFields     int // reclaimed expired parts of the values, e.g. the keys of hashes
+	UsedMemory        int // approximate size of keys and values in bytes
+	MaxMemory         int
+	EvictedKeys       int
+}
+
+func (self Stats) add(other Stats) Stats {
+	self.Keys += other.Keys
+	self.Expires += other.Expires
+	self.ExpiredKeys += other.ExpiredKeys
+	self.ActiveExpiredKeys += other.ActiveExpiredKeys
+	self.ExpiredFields += other.ExpiredFields
+	self.UsedMemory += other.UsedMemory
+	self.EvictedKeys += other.EvictedKeys
+	// the limit is shared by the shards
+	self.MaxMemory = other.MaxMemory
+	// cycles run over all of the shards at once
+	if other.ExpireCycles > self.ExpireCycles {
+		self.ExpireCycles = other.ExpireCycles
+	}
+	return self
+}
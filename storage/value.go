@@ -1,13 +1,60 @@
 package storage
 
 import (
+	"math"
+	"sync/atomic"
 	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+const (
+	// the access counter of a value is decremented for every period it was not accessed
+	lfuDecayPeriod = time.Minute
 )
 
+// Expiring is a value which parts expire on their own, e.g. the keys of a hash.
+type Expiring interface {
+	// the nearest deadline of the parts, zero if none of them expires
+	NextDeadline() time.Time
+	// removes the parts expired by now, returns how many were removed
+	ExpireParts(now time.Time) int
+	// the parts left, the value without parts is removed with its key
+	Len() core.IntValue
+}
+
+// partsTTL is the nearest deadline of the expiring parts of the value
+type partsTTL struct {
+	deadline time.Time
+	index    int
+}
+
+func (self *partsTTL) Expired(t time.Time) bool {
+	return !self.deadline.IsZero() && self.deadline.Before(t)
+}
+
+func (self *partsTTL) Deadline() time.Time {
+	return self.deadline
+}
+
+func (self *partsTTL) Index() int {
+	return self.index
+}
+
+func (self *partsTTL) SetIndex(i int) {
+	self.index = i
+}
+
 type ValueObject struct {
 	Object   interface{}
 	deadline time.Time
 	index    int
+	size     int
+	parts    partsTTL
+
+	// access information is updated by concurrent readers
+	accessed int64
+	hits     uint32
 }
 
 func (self *ValueObject) Expired(t time.Time) bool {
@@ -33,10 +80,46 @@ func (self *ValueObject) SetIndex(i int) {
 	self.index = i
 }
 
+// records an access to the value for the eviction policies
+func (self *ValueObject) Touch(now time.Time) {
+	ts := now.UnixNano()
+	last := atomic.SwapInt64(&self.accessed, ts)
+	hits := decayHits(atomic.LoadUint32(&self.hits), ts-last)
+	if hits < math.MaxUint32 {
+		hits += 1
+	}
+	atomic.StoreUint32(&self.hits, hits)
+}
+
+func (self *ValueObject) Accessed() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&self.accessed))
+}
+
+// access counter of the value decayed for the time it was not accessed
+func (self *ValueObject) Frequency(now time.Time) uint32 {
+	idle := now.UnixNano() - atomic.LoadInt64(&self.accessed)
+	return decayHits(atomic.LoadUint32(&self.hits), idle)
+}
+
+func (self *ValueObject) Size() int {
+	return self.size
+}
+
 func (self *ValueObject) SetObject(object interface{}) {
 	self.Object = object
 }
 
+func decayHits(hits uint32, idle int64) uint32 {
+	periods := idle / int64(lfuDecayPeriod)
+	if periods <= 0 {
+		return hits
+	}
+	if periods >= int64(hits) {
+		return 0
+	}
+	return hits - uint32(periods)
+}
+
 func NewValueObject(object interface{}) *ValueObject {
-	return &ValueObject{Object: object, index: -1}
+	return &ValueObject{Object: object, index: -1, parts: partsTTL{index: -1}}
 }
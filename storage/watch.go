@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+var (
+	ErrWatchInAtomic = errors.New("cannot watch the keys within an atomic access")
+)
+
+// Watch tracks the changes of the keys since it is created, e.g. for WATCH.
+// A key is changed once it is written, removed or expired.
+type Watch struct {
+	storage *BaseStorage
+	keys    []core.StrValue
+	// the deadlines of the keys when the watch is created
+	deadlines []time.Time
+	changed   int32
+	done      chan struct{}
+}
+
+func (self *Watch) touch() {
+	if atomic.CompareAndSwapInt32(&self.changed, 0, 1) {
+		close(self.done)
+	}
+}
+
+// Done is closed once a key is written or removed, the expiry of
+// the keys is not tracked by it.
+func (self *Watch) Done() <-chan struct{} {
+	return self.done
+}
+
+// Changed is reliable only with the shards of the keys locked, e.g. within Atomic.
+func (self *Watch) Changed() bool {
+	if atomic.LoadInt32(&self.changed) != 0 {
+		return true
+	}
+	// the expired keys might not be removed yet
+	now := time.Now()
+	for _, deadline := range self.deadlines {
+		if !deadline.IsZero() && deadline.Before(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops tracking the keys.
+func (self *Watch) Close() {
+	set := self.storage.lock(self.keys)
+	defer self.storage.unlock(set)
+	for _, key := range self.keys {
+		set.route(key).unwatch(key, self)
+	}
+}
+
+// the watches of the keys of a shard
+type watches map[core.StrValue]map[*Watch]struct{}
+
+func (self *rawStorage) watch(key core.StrValue, w *Watch) {
+	if self.watches == nil {
+		self.watches = make(watches)
+	}
+	if self.watches[key] == nil {
+		self.watches[key] = make(map[*Watch]struct{})
+	}
+	self.watches[key][w] = struct{}{}
+}
+
+func (self *rawStorage) unwatch(key core.StrValue, w *Watch) {
+	delete(self.watches[key], w)
+	if len(self.watches[key]) == 0 {
+		delete(self.watches, key)
+	}
+}
+
+// marks the watches of the key changed
+func (self *rawStorage) touch(key core.StrValue) {
+	for w := range self.watches[key] {
+		w.touch()
+	}
+}
+
+func (self *BaseStorage) Watch(keys ...core.StrValue) (*Watch, error) {
+	w := &Watch{
+		storage:   self,
+		keys:      keys,
+		deadlines: make([]time.Time, len(keys)),
+		done:      make(chan struct{}),
+	}
+	set := self.lock(keys)
+	defer self.unlock(set)
+	for i, key := range keys {
+		s := set.route(key)
+		s.watch(key, w)
+		if v := s.get(key, true); v != nil {
+			w.deadlines[i] = v.Deadline()
+		}
+	}
+	return w, nil
+}
+
+// lockedStorage accesses the shards locked by Atomic
+type lockedStorage struct {
+	base *BaseStorage
+	set  *shardSet
+}
+
+func (self *lockedStorage) Write(fn WriteFn, keys ...core.StrValue) (interface{}, error) {
+	if err := self.set.FreeMemory(); err != nil {
+		return nil, err
+	}
+	return self.base.write(self.set, fn)
+}
+
+func (self *lockedStorage) Free(fn WriteFn, keys ...core.StrValue) (interface{}, error) {
+	return self.base.write(self.set, fn)
+}
+
+func (self *lockedStorage) Read(fn ReadFn, keys ...core.StrValue) (interface{}, error) {
+	return fn(&reader{storage: self.set})
+}
+
+func (self *lockedStorage) Watch(keys ...core.StrValue) (*Watch, error) {
+	return nil, ErrWatchInAtomic
+}
+
+func (self *lockedStorage) Atomic(fn AtomicFn) (interface{}, error) {
+	return fn(self)
+}
+
+func (self *BaseStorage) Atomic(fn AtomicFn) (interface{}, error) {
+	set := self.lock(nil)
+	defer self.unlock(set)
+	return fn(&lockedStorage{base: self, set: set})
+}
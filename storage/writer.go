@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/auvn/go.cache/core"
 )
 
@@ -8,15 +10,27 @@ type Writer interface {
 	Reader
 	Set(key core.StrValue, v interface{})
 	SetTTL(key core.StrValue, ttl core.IntValue) bool
+	SetDeadline(key core.StrValue, deadline time.Time) bool
+	Persist(key core.StrValue) bool
 	Delete(key core.StrValue) bool
+	Cleanup(budget time.Duration) core.IntValue
 }
 
 type writer struct {
 	Reader
 	storage RawStorage
+
+	// keys which values might be modified by the current write
+	touched []core.StrValue
+}
+
+func (self *writer) Get(key core.StrValue) (interface{}, bool) {
+	self.touched = append(self.touched, key)
+	return self.Reader.Get(key)
 }
 
 func (self *writer) Set(key core.StrValue, v interface{}) {
+	self.touched = append(self.touched, key)
 	self.storage.Set(key, v)
 }
 
@@ -24,6 +38,23 @@ func (self *writer) SetTTL(key core.StrValue, ttl core.IntValue) bool {
 	return self.storage.SetTTL(key, ttl)
 }
 
+func (self *writer) SetDeadline(key core.StrValue, deadline time.Time) bool {
+	return self.storage.SetDeadline(key, deadline)
+}
+
+func (self *writer) Persist(key core.StrValue) bool {
+	return self.storage.Persist(key)
+}
+
 func (self *writer) Delete(key core.StrValue) bool {
 	return self.storage.Del(key)
 }
+
+func (self *writer) Cleanup(budget time.Duration) core.IntValue {
+	return self.storage.Cleanup(budget)
+}
+
+func (self *writer) account() {
+	self.storage.Account(self.touched)
+	self.touched = self.touched[:0]
+}
@@ -1,12 +1,32 @@
 package types
 
-import "github.com/auvn/go.cache/core"
+import (
+	"time"
 
+	"github.com/auvn/go.cache/core"
+)
+
+// Hash keys might have deadlines, the expired keys are skipped by the reads
+// and removed by the next write or ExpireParts.
 type Hash interface {
+	// Set removes the deadline of the key.
 	Set(key core.StrValue, value core.Value) bool
 	Get(key core.StrValue) (core.Value, bool)
 	Del(key ...core.StrValue) core.IntValue
 	Keys() []core.StrValue
+	Values() []core.Value
+	Len() core.IntValue
+	Size() int
+	// SetDeadline sets the deadline of the key, false if there is no such key.
+	SetDeadline(key core.StrValue, deadline time.Time) bool
+	// Deadline is zero if the key has no deadline or there is no such key.
+	Deadline(key core.StrValue) time.Time
+	// Persist removes the deadline of the key, false if it has no deadline.
+	Persist(key core.StrValue) bool
+	// NextDeadline is the nearest deadline of the keys, zero if none of them expires.
+	NextDeadline() time.Time
+	// ExpireParts removes the keys expired by now, returns how many were removed.
+	ExpireParts(now time.Time) int
 }
 
 type hashStorage map[core.StrValue]core.Value
@@ -26,39 +46,154 @@ func (self hashStorage) Delete(key core.StrValue) {
 
 type hashObject struct {
 	storage hashStorage
+	// nil until a key has a deadline
+	ttls *fieldTTLs
+	size int
+}
+
+func (self *hashObject) expired(key core.StrValue, now time.Time) bool {
+	return self.ttls != nil && self.ttls.expired(key, now)
+}
+
+func (self *hashObject) removeTTL(key core.StrValue) bool {
+	if self.ttls == nil || !self.ttls.remove(key) {
+		return false
+	}
+	self.size -= elementOverhead
+	if self.ttls.len() == 0 {
+		self.ttls = nil
+	}
+	return true
+}
+
+func (self *hashObject) del(key core.StrValue) bool {
+	v, ok := self.storage.Get(key)
+	if !ok {
+		return false
+	}
+	self.storage.Delete(key)
+	self.size -= len(key) + len(v) + elementOverhead
+	self.removeTTL(key)
+	return true
 }
 
 func (self *hashObject) Set(key core.StrValue, value core.Value) bool {
-	_, updated := self.storage.Get(key)
+	self.ExpireParts(time.Now())
+	self.removeTTL(key)
+	old, updated := self.storage.Get(key)
+	if updated {
+		self.size -= len(old)
+	} else {
+		self.size += len(key) + elementOverhead
+	}
+	self.size += len(value)
 	self.storage.Set(key, value)
 	return !updated
 }
 
 func (self *hashObject) Get(key core.StrValue) (core.Value, bool) {
+	if self.expired(key, time.Now()) {
+		return nil, false
+	}
 	return self.storage.Get(key)
 }
 
 func (self *hashObject) Del(keys ...core.StrValue) core.IntValue {
+	self.ExpireParts(time.Now())
 	var counter int = 0
 	for _, k := range keys {
-		_, ok := self.storage.Get(k)
-		if !ok {
-			continue
+		if self.del(k) {
+			counter += 1
 		}
-		self.storage.Delete(k)
-		counter += 1
 	}
 	return core.IntValue(counter)
 }
 
 func (self *hashObject) Keys() []core.StrValue {
+	now := time.Now()
 	keys := make([]core.StrValue, 0, len(self.storage))
 	for k := range self.storage {
-		keys = append(keys, k)
+		if !self.expired(k, now) {
+			keys = append(keys, k)
+		}
 	}
 	return keys
 }
 
+func (self *hashObject) Values() []core.Value {
+	now := time.Now()
+	values := make([]core.Value, 0, len(self.storage))
+	for k, v := range self.storage {
+		if !self.expired(k, now) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (self *hashObject) Len() core.IntValue {
+	n := len(self.storage)
+	if self.ttls != nil {
+		n -= self.ttls.countExpired(time.Now())
+	}
+	return core.IntValue(n)
+}
+
+func (self *hashObject) Size() int {
+	return self.size
+}
+
+func (self *hashObject) SetDeadline(key core.StrValue, deadline time.Time) bool {
+	self.ExpireParts(time.Now())
+	if _, ok := self.storage.Get(key); !ok {
+		return false
+	}
+	if self.ttls == nil {
+		self.ttls = newFieldTTLs()
+	}
+	if !self.ttls.set(key, deadline) {
+		self.size += elementOverhead
+	}
+	return true
+}
+
+func (self *hashObject) Deadline(key core.StrValue) time.Time {
+	if self.ttls == nil {
+		return time.Time{}
+	}
+	t, ok := self.ttls.get(key)
+	if !ok || t.Expired(time.Now()) {
+		return time.Time{}
+	}
+	return t.deadline
+}
+
+func (self *hashObject) Persist(key core.StrValue) bool {
+	self.ExpireParts(time.Now())
+	return self.removeTTL(key)
+}
+
+func (self *hashObject) NextDeadline() time.Time {
+	if self.ttls == nil {
+		return time.Time{}
+	}
+	t, _ := self.ttls.peek()
+	return t.deadline
+}
+
+func (self *hashObject) ExpireParts(now time.Time) int {
+	var counter int
+	for self.ttls != nil {
+		t, ok := self.ttls.peek()
+		if !ok || !t.Expired(now) {
+			break
+		}
+		self.del(t.key)
+		counter += 1
+	}
+	return counter
+}
+
 func NewHash() Hash {
 	return &hashObject{storage: hashStorage{}}
 }
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+func newTestHash(keys ...string) Hash {
+	h := NewHash()
+	for _, k := range keys {
+		h.Set(core.StrValue(k), core.Value("v"+k))
+	}
+	return h
+}
+
+func hashKeys(h Hash) []string {
+	var ret []string
+	for _, k := range h.Keys() {
+		ret = append(ret, string(k))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func Test_hashObject_Deadlines(t *testing.T) {
+	now := time.Now()
+	h := newTestHash("a", "b", "c", "d")
+	size := h.Size()
+
+	if h.SetDeadline("missing", now.Add(time.Hour)) {
+		t.Errorf("SetDeadline() of the missing key = true")
+	}
+	h.SetDeadline("b", now.Add(time.Hour))
+	h.SetDeadline("c", now.Add(time.Minute))
+	h.SetDeadline("d", now.Add(time.Hour))
+	// the writes remove the expired keys, so it is the last one
+	h.SetDeadline("a", now.Add(-time.Second))
+
+	// the expired key is kept until the next write, but it is not visible
+	if _, ok := h.Get("a"); ok {
+		t.Errorf("Get() of the expired key = true")
+	}
+	if got, want := hashKeys(h), []string{"b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if got := h.Len(); got != 3 {
+		t.Errorf("Len() = %v, want 3", got)
+	}
+	if got := h.NextDeadline(); !got.Equal(now.Add(-time.Second)) {
+		t.Errorf("NextDeadline() = %v, want the deadline of the expired key", got)
+	}
+	if got := h.ExpireParts(now); got != 1 {
+		t.Errorf("ExpireParts() = %v, want 1", got)
+	}
+	if got := h.NextDeadline(); !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("NextDeadline() = %v, want %v", got, now.Add(time.Minute))
+	}
+
+	if got := h.Deadline("b"); !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("Deadline() = %v, want %v", got, now.Add(time.Hour))
+	}
+	if !h.Persist("b") || h.Persist("b") {
+		t.Errorf("Persist() removes the deadline only once")
+	}
+	// the value replaced by Set has no deadline
+	h.Set("c", core.Value("new"))
+	h.Del("d")
+	if !h.Deadline("b").IsZero() || !h.Deadline("c").IsZero() || !h.NextDeadline().IsZero() {
+		t.Errorf("deadlines are left after Persist, Set and Del")
+	}
+
+	h.Set("a", core.Value("va"))
+	h.Set("c", core.Value("vc"))
+	h.Set("d", core.Value("vd"))
+	if got := h.Size(); got != size {
+		t.Errorf("Size() = %v, want %v", got, size)
+	}
+}
@@ -0,0 +1,119 @@
+package types
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/auvn/go.cache/core"
+)
+
+// fieldTTL is the deadline of a key of a hash
+type fieldTTL struct {
+	key      core.StrValue
+	deadline time.Time
+	index    int
+}
+
+func (self *fieldTTL) Expired(t time.Time) bool {
+	return self.deadline.Before(t)
+}
+
+// fieldTTLQueue orders the keys of a hash by their deadlines, the same way
+// the TTLHeap of the storage orders the keys of the storage
+type fieldTTLQueue []*fieldTTL
+
+func (self fieldTTLQueue) Len() int {
+	return len(self)
+}
+
+func (self fieldTTLQueue) Less(i, j int) bool {
+	return self[i].deadline.Before(self[j].deadline)
+}
+
+func (self fieldTTLQueue) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+	self[i].index = i
+	self[j].index = j
+}
+
+func (self *fieldTTLQueue) Push(x interface{}) {
+	t := x.(*fieldTTL)
+	t.index = len(*self)
+	*self = append(*self, t)
+}
+
+func (self *fieldTTLQueue) Pop() interface{} {
+	q := *self
+	t := q[len(q)-1]
+	q[len(q)-1] = nil
+	*self = q[:len(q)-1]
+	t.index = -1
+	return t
+}
+
+// fieldTTLs tracks the deadlines of the keys of a hash
+type fieldTTLs struct {
+	m map[core.StrValue]*fieldTTL
+	q fieldTTLQueue
+}
+
+func (self *fieldTTLs) get(key core.StrValue) (*fieldTTL, bool) {
+	t, ok := self.m[key]
+	return t, ok
+}
+
+// false if the key had no deadline
+func (self *fieldTTLs) set(key core.StrValue, deadline time.Time) bool {
+	if t, ok := self.m[key]; ok {
+		t.deadline = deadline
+		heap.Fix(&self.q, t.index)
+		return true
+	}
+	t := &fieldTTL{key: key, deadline: deadline}
+	self.m[key] = t
+	heap.Push(&self.q, t)
+	return false
+}
+
+func (self *fieldTTLs) remove(key core.StrValue) bool {
+	t, ok := self.m[key]
+	if !ok {
+		return false
+	}
+	heap.Remove(&self.q, t.index)
+	delete(self.m, key)
+	return true
+}
+
+// the key with the nearest deadline
+func (self *fieldTTLs) peek() (*fieldTTL, bool) {
+	if len(self.q) == 0 {
+		return nil, false
+	}
+	return self.q[0], true
+}
+
+func (self *fieldTTLs) expired(key core.StrValue, now time.Time) bool {
+	t, ok := self.m[key]
+	return ok && t.Expired(now)
+}
+
+// the number of the keys expired by now, the queue is not modified,
+// so it is safe for the concurrent readers
+func (self *fieldTTLs) countExpired(now time.Time) int {
+	var counter int
+	for _, t := range self.q {
+		if t.Expired(now) {
+			counter += 1
+		}
+	}
+	return counter
+}
+
+func (self *fieldTTLs) len() int {
+	return len(self.q)
+}
+
+func newFieldTTLs() *fieldTTLs {
+	return &fieldTTLs{m: map[core.StrValue]*fieldTTL{}}
+}
@@ -1,9 +1,21 @@
 package types
 
 import (
+	"bytes"
+
 	"github.com/auvn/go.cache/core"
 )
 
+const (
+	// approximate memory overhead of a single element of containers
+	elementOverhead = 48
+
+	// the header of the value kept by the list buffer
+	listElementOverhead = 24
+	// the capacity of the buffer is a power of two not less than it
+	minListCapacity = 8
+)
+
 var (
 	emptyValue      = core.Value{}
 	emptyValueSlice = []core.Value{}
@@ -16,39 +28,91 @@ type List interface {
 	RPop() (core.Value, bool)
 	Range(start, stop core.IntValue) []core.Value
 	Get(index core.IntValue) core.Value
+	// Set replaces the element at the index, false if it is out of range.
+	Set(index core.IntValue, value core.Value) bool
+	// Insert puts the value before or after the first pivot from the head,
+	// -1 if there is no pivot.
+	Insert(before bool, pivot, value core.Value) core.IntValue
+	// Remove removes count elements equal to the value from the head,
+	// from the tail if count is negative, all of them if it is zero.
+	Remove(count core.IntValue, value core.Value) core.IntValue
+	// Trim keeps the elements of the range only.
+	Trim(start, stop core.IntValue)
+	Len() core.IntValue
+	Size() int
 }
 
-type listElement struct {
-	Value core.Value
-	Next  *listElement
-	Prev  *listElement
+// listObject keeps the elements in a ring buffer, so they are indexed
+// in O(1) from either end and there is no allocation per element.
+// The pushes and the pops of both ends are O(1) amortized.
+type listObject struct {
+	// nil until the first push, the capacity is a power of two
+	buf    []core.Value
+	head   int
+	length int
+	size   int
 }
 
-type listObject struct {
-	Head   *listElement
-	Tail   *listElement
-	Length int
+// the position in the buffer of the i-th element
+func (self *listObject) pos(i int) int {
+	return (self.head + i) & (len(self.buf) - 1)
 }
 
-func (self *listObject) push(beginning bool, values ...core.Value) core.IntValue {
-	if len(values) == 0 {
-		return self.length()
+func (self *listObject) resize(capacity int) {
+	buf := make([]core.Value, capacity)
+	if self.buf != nil {
+		// the elements are either contiguous or wrapped around the end
+		end := self.head + self.length
+		if end > len(self.buf) {
+			end = len(self.buf)
+		}
+		n := copy(buf, self.buf[self.head:end])
+		copy(buf[n:], self.buf[:self.length-n])
 	}
+	self.buf = buf
+	self.head = 0
+}
 
-	if self.empty() {
-		self.pushFirst(values[0])
-		values = values[1:]
+// makes room for n more elements
+func (self *listObject) grow(n int) {
+	capacity := len(self.buf)
+	if capacity < minListCapacity {
+		capacity = minListCapacity
 	}
-	if beginning {
-		for _, value := range values {
-			self.lpush(value)
-		}
-	} else {
-		for _, value := range values {
-			self.rpush(value)
+	for capacity < self.length+n {
+		capacity *= 2
+	}
+	if capacity != len(self.buf) {
+		self.resize(capacity)
+	}
+}
+
+// releases the buffer once it is mostly unused
+func (self *listObject) shrink() {
+	if self.length == 0 {
+		self.buf, self.head = nil, 0
+	} else if len(self.buf) > minListCapacity && self.length <= len(self.buf)/4 {
+		self.resize(len(self.buf) / 2)
+	}
+}
+
+func (self *listObject) adjustSize(value core.Value, sign int) {
+	self.size += sign * (len(value) + listElementOverhead)
+}
+
+func (self *listObject) push(beginning bool, values ...core.Value) core.IntValue {
+	self.grow(len(values))
+	for _, value := range values {
+		if beginning {
+			self.head = self.pos(-1)
+			self.buf[self.head] = value
+		} else {
+			self.buf[self.pos(self.length)] = value
 		}
+		self.length += 1
+		self.adjustSize(value, 1)
 	}
-	return self.length()
+	return self.len()
 }
 
 func (self *listObject) LPush(values ...core.Value) core.IntValue {
@@ -64,11 +128,18 @@ func (self *listObject) pop(beginning bool) (core.Value, bool) {
 		return emptyValue, false
 	}
 
+	i := self.pos(self.length - 1)
 	if beginning {
-		return self.lpop().Value, true
-	} else {
-		return self.rpop().Value, true
+		i = self.head
+		self.head = self.pos(1)
 	}
+	value := self.buf[i]
+	// the buffer does not keep the popped values alive
+	self.buf[i] = nil
+	self.length -= 1
+	self.adjustSize(value, -1)
+	self.shrink()
+	return value, true
 }
 
 func (self *listObject) LPop() (core.Value, bool) {
@@ -79,10 +150,11 @@ func (self *listObject) RPop() (core.Value, bool) {
 	return self.pop(false)
 }
 
-func (self *listObject) Range(start, stop core.IntValue) []core.Value {
+// the range within the list, ok is false if it is empty
+func (self *listObject) bounds(start, stop core.IntValue) (int, int, bool) {
 	startVal := start.Value()
 	stopVal := stop.Value()
-	length := self.Length
+	length := self.length
 
 	if startVal < 0 {
 		startVal = length + startVal
@@ -95,112 +167,157 @@ func (self *listObject) Range(start, stop core.IntValue) []core.Value {
 	}
 
 	if startVal > stopVal || startVal >= length {
-		return emptyValueSlice
+		return 0, 0, false
 	}
 
 	if stopVal >= length {
 		stopVal = length - 1
 	}
-	cursor := self.Head
+	return startVal, stopVal, true
+}
 
-	for i := 0; i < startVal; i++ {
-		cursor = cursor.Next
+func (self *listObject) Range(start, stop core.IntValue) []core.Value {
+	startVal, stopVal, ok := self.bounds(start, stop)
+	if !ok {
+		return emptyValueSlice
 	}
-	count := stopVal - startVal
-	values := make([]core.Value, 0, count)
-	for count >= 0 {
-		values = append(values, cursor.Value)
-		count -= 1
-		cursor = cursor.Next
+	values := make([]core.Value, 0, stopVal-startVal+1)
+	for i := startVal; i <= stopVal; i++ {
+		values = append(values, self.buf[self.pos(i)])
 	}
-
 	return values
 }
 
-func (self *listObject) Get(index core.IntValue) core.Value {
+// the position of the index in the list, negative ones count from the tail,
+// false if it is out of range
+func (self *listObject) index(index core.IntValue) (int, bool) {
 	i := index.Value()
-	if self.Length < i {
-		return emptyValue
+	if i < 0 {
+		i = self.length + i
 	}
+	return i, i >= 0 && i < self.length
+}
 
-	var cur int
-	elem := self.Head
-	for cur < i && elem != nil {
-		elem = elem.Next
-		cur += 1
-	}
-	if elem == nil {
+func (self *listObject) Get(index core.IntValue) core.Value {
+	i, ok := self.index(index)
+	if !ok {
 		return emptyValue
 	}
-	return elem.Value
+	return self.buf[self.pos(i)]
 }
 
-func (self *listObject) length() core.IntValue {
-	return core.IntValue(self.Length)
+func (self *listObject) Set(index core.IntValue, value core.Value) bool {
+	i, ok := self.index(index)
+	if !ok {
+		return false
+	}
+	p := self.pos(i)
+	self.adjustSize(self.buf[p], -1)
+	self.buf[p] = value
+	self.adjustSize(value, 1)
+	return true
 }
 
-func (self *listObject) empty() bool {
-	return self.Length == 0
+// moves the shorter side of the list, so the value is put at the i-th position
+func (self *listObject) insertAt(i int, value core.Value) {
+	self.grow(1)
+	if i < self.length/2 {
+		self.head = self.pos(-1)
+		for j := 0; j < i; j++ {
+			self.buf[self.pos(j)] = self.buf[self.pos(j+1)]
+		}
+	} else {
+		for j := self.length; j > i; j-- {
+			self.buf[self.pos(j)] = self.buf[self.pos(j-1)]
+		}
+	}
+	self.buf[self.pos(i)] = value
+	self.length += 1
+	self.adjustSize(value, 1)
 }
 
-func (self *listObject) adjustLength(value int) int {
-	self.Length += value
-	return self.Length
+func (self *listObject) Insert(before bool, pivot, value core.Value) core.IntValue {
+	for i := 0; i < self.length; i++ {
+		if !bytes.Equal(self.buf[self.pos(i)], pivot) {
+			continue
+		}
+		if !before {
+			i += 1
+		}
+		self.insertAt(i, value)
+		return self.len()
+	}
+	return -1
 }
 
-func (self *listObject) pushFirst(value core.Value) *listElement {
-	defer self.adjustLength(1)
-
-	elem := &listElement{Value: value, Next: nil, Prev: nil}
-	self.Head = elem
-	self.Tail = elem
-	return elem
+func (self *listObject) Remove(count core.IntValue, value core.Value) core.IntValue {
+	n := count.Value()
+	fromTail := n < 0
+	if fromTail {
+		n = -n
+	}
+	// the kept elements are moved towards the end the removal starts from,
+	// step walks from it
+	first, step := 0, 1
+	if fromTail {
+		first, step = self.length-1, -1
+	}
+	var removed int
+	w := first
+	for r := first; r >= 0 && r < self.length; r += step {
+		v := self.buf[self.pos(r)]
+		if (n == 0 || removed < n) && bytes.Equal(v, value) {
+			self.adjustSize(v, -1)
+			removed++
+			continue
+		}
+		self.buf[self.pos(w)] = v
+		w += step
+	}
+	// releases the positions left behind
+	for i := 0; i < removed; i++ {
+		self.buf[self.pos(w)] = nil
+		w += step
+	}
+	if fromTail {
+		self.head = self.pos(removed)
+	}
+	self.length -= removed
+	self.shrink()
+	return core.IntValue(removed)
 }
 
-func (self *listObject) lpush(value core.Value) *listElement {
-	defer self.adjustLength(1)
-
-	oldHead := self.Head
-	self.Head = &listElement{Value: value, Next: oldHead, Prev: nil}
-	oldHead.Prev = self.Head
-	return self.Head
+func (self *listObject) Trim(start, stop core.IntValue) {
+	startVal, stopVal, ok := self.bounds(start, stop)
+	if !ok {
+		startVal, stopVal = self.length, self.length-1
+	}
+	for i := 0; i < self.length; i++ {
+		if i < startVal || i > stopVal {
+			p := self.pos(i)
+			self.adjustSize(self.buf[p], -1)
+			self.buf[p] = nil
+		}
+	}
+	self.head = self.pos(startVal)
+	self.length = stopVal - startVal + 1
+	self.shrink()
 }
 
-func (self *listObject) rpush(value core.Value) *listElement {
-	defer self.adjustLength(1)
-
-	oldTail := self.Tail
-	self.Tail = &listElement{Value: value, Prev: oldTail, Next: nil}
-	oldTail.Next = self.Tail
-	return self.Tail
+func (self *listObject) Len() core.IntValue {
+	return self.len()
 }
 
-func (self *listObject) lpop() *listElement {
-	defer self.adjustLength(-1)
-
-	elem := self.Head
-	self.Head = elem.Next
-	if self.Head != nil {
-		self.Head.Prev = nil
-	}
-
-	elem.Next = nil
-	elem.Prev = nil
-	return elem
+func (self *listObject) Size() int {
+	return self.size
 }
 
-func (self *listObject) rpop() *listElement {
-	defer self.adjustLength(-1)
-
-	elem := self.Tail
-	self.Tail = elem.Prev
-	if self.Tail != nil {
-		self.Tail.Next = nil
-	}
+func (self *listObject) len() core.IntValue {
+	return core.IntValue(self.length)
+}
 
-	elem.Next = nil
-	elem.Prev = nil
-	return elem
+func (self *listObject) empty() bool {
+	return self.length == 0
 }
 
 func NewList() List {
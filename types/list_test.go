@@ -0,0 +1,241 @@
+package types
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/auvn/go.cache/core"
+)
+
+func newTestList(values ...string) List {
+	l := NewList()
+	for _, v := range values {
+		l.RPush(core.Value(v))
+	}
+	return l
+}
+
+func listValues(l List) []string {
+	var ret []string
+	for _, v := range l.Range(0, -1) {
+		ret = append(ret, string(v))
+	}
+	return ret
+}
+
+// the size of the list built from scratch
+func listSize(values []string) int {
+	return newTestList(values...).Size()
+}
+
+func Test_listObject_Modify(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(l List) interface{}
+		ret    interface{}
+		want   []string
+	}{
+		{
+			name:   "SetNegative",
+			modify: func(l List) interface{} { return l.Set(-1, core.Value("xyz")) },
+			ret:    true,
+			want:   []string{"a", "b", "a", "c", "xyz"},
+		},
+		{
+			name:   "SetOutOfRange",
+			modify: func(l List) interface{} { return l.Set(5, core.Value("x")) },
+			ret:    false,
+			want:   []string{"a", "b", "a", "c", "a"},
+		},
+		{
+			name:   "InsertBeforeHead",
+			modify: func(l List) interface{} { return l.Insert(true, core.Value("a"), core.Value("x")) },
+			ret:    core.IntValue(6),
+			want:   []string{"x", "a", "b", "a", "c", "a"},
+		},
+		{
+			name:   "InsertAfter",
+			modify: func(l List) interface{} { return l.Insert(false, core.Value("c"), core.Value("x")) },
+			ret:    core.IntValue(6),
+			want:   []string{"a", "b", "a", "c", "x", "a"},
+		},
+		{
+			name:   "InsertNoPivot",
+			modify: func(l List) interface{} { return l.Insert(false, core.Value("z"), core.Value("x")) },
+			ret:    core.IntValue(-1),
+			want:   []string{"a", "b", "a", "c", "a"},
+		},
+		{
+			name:   "RemoveFromHead",
+			modify: func(l List) interface{} { return l.Remove(2, core.Value("a")) },
+			ret:    core.IntValue(2),
+			want:   []string{"b", "c", "a"},
+		},
+		{
+			name:   "RemoveFromTail",
+			modify: func(l List) interface{} { return l.Remove(-2, core.Value("a")) },
+			ret:    core.IntValue(2),
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "RemoveAll",
+			modify: func(l List) interface{} { return l.Remove(0, core.Value("a")) },
+			ret:    core.IntValue(3),
+			want:   []string{"b", "c"},
+		},
+		{
+			name:   "Trim",
+			modify: func(l List) interface{} { l.Trim(1, -2); return l.Len() },
+			ret:    core.IntValue(3),
+			want:   []string{"b", "a", "c"},
+		},
+		{
+			name:   "TrimEmptyRange",
+			modify: func(l List) interface{} { l.Trim(3, 1); return l.Len() },
+			ret:    core.IntValue(0),
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestList("a", "b", "a", "c", "a")
+			if got := tt.modify(l); !reflect.DeepEqual(got, tt.ret) {
+				t.Errorf("returned %v, want %v", got, tt.ret)
+			}
+			if got := listValues(l); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("list = %v, want %v", got, tt.want)
+			}
+			if got, want := l.Size(), listSize(tt.want); got != want {
+				t.Errorf("Size() = %v, want %v", got, want)
+			}
+			if got, want := l.Len(), core.IntValue(len(tt.want)); got != want {
+				t.Errorf("Len() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_listObject_Get(t *testing.T) {
+	l := newTestList("a", "b", "c")
+	for index, want := range map[core.IntValue]string{0: "a", 2: "c", -1: "c", -3: "a", 3: "", -4: ""} {
+		if got := string(l.Get(index)); got != want {
+			t.Errorf("Get(%v) = %q, want %q", index, got, want)
+		}
+	}
+}
+
+// the random operations wrap the elements around the end of the buffer,
+// grow and shrink it, the list is compared with a slice doing the same
+func Test_listObject_Model(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	l := NewList()
+	var model []string
+	const steps = 4000
+	for i := 0; i < steps; i++ {
+		v := strconv.Itoa(r.Intn(10))
+		op := r.Intn(10)
+		// the list grows in the first half and shrinks in the second one
+		if i >= steps/2 && op < 6 {
+			op = 6 + op%2
+		}
+		switch {
+		case op < 3:
+			l.LPush(core.Value(v))
+			model = append([]string{v}, model...)
+		case op < 6:
+			l.RPush(core.Value(v), core.Value(v))
+			model = append(model, v, v)
+		case op < 7:
+			if _, ok := l.LPop(); ok {
+				model = model[1:]
+			}
+		case op < 8:
+			if _, ok := l.RPop(); ok {
+				model = model[:len(model)-1]
+			}
+		case op < 9:
+			if n := l.Insert(true, core.Value(v), core.Value("x")); n > 0 {
+				for j, m := range model {
+					if m == v {
+						model = append(model[:j], append([]string{"x"}, model[j:]...)...)
+						break
+					}
+				}
+			}
+		default:
+			l.Remove(-1, core.Value(v))
+			for j := len(model) - 1; j >= 0; j-- {
+				if model[j] == v {
+					model = append(model[:j], model[j+1:]...)
+					break
+				}
+			}
+		}
+		if got := listValues(l); len(got)+len(model) > 0 && !reflect.DeepEqual(got, model) {
+			t.Fatalf("step %d: list = %v, want %v", i, got, model)
+		}
+	}
+	if got, want := l.Size(), listSize(model); got != want {
+		t.Errorf("Size() = %v, want %v", got, want)
+	}
+}
+
+func newBenchmarkList(n int) List {
+	l := NewList()
+	for i := 0; i < n; i++ {
+		l.RPush(core.Value("value"))
+	}
+	return l
+}
+
+func benchmarkListGet(b *testing.B, n int, index core.IntValue) {
+	l := newBenchmarkList(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Get(index)
+	}
+}
+
+func BenchmarkList_GetHead1M(b *testing.B) {
+	benchmarkListGet(b, 1000000, 10)
+}
+
+func BenchmarkList_GetTail1M(b *testing.B) {
+	benchmarkListGet(b, 1000000, -10)
+}
+
+func BenchmarkList_GetMiddle1M(b *testing.B) {
+	benchmarkListGet(b, 1000000, 500000)
+}
+
+func BenchmarkList_RangeTail1M(b *testing.B) {
+	l := newBenchmarkList(1000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Range(-100, -1)
+	}
+}
+
+func BenchmarkList_RPushLPop(b *testing.B) {
+	l := newBenchmarkList(1000)
+	value := core.Value("value")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.RPush(value)
+		l.LPop()
+	}
+}
+
+func BenchmarkList_RPush(b *testing.B) {
+	value := core.Value("value")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := NewList()
+		for j := 0; j < 1000; j++ {
+			l.RPush(value)
+		}
+	}
+}
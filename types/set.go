@@ -0,0 +1,132 @@
+package types
+
+import "github.com/auvn/go.cache/core"
+
+type Set interface {
+	Add(members ...core.StrValue) core.IntValue
+	Rem(members ...core.StrValue) core.IntValue
+	IsMember(member core.StrValue) bool
+	Members() []core.StrValue
+	Len() core.IntValue
+	Size() int
+}
+
+type setStorage map[core.StrValue]struct{}
+
+func (self setStorage) Has(member core.StrValue) bool {
+	_, ok := self[member]
+	return ok
+}
+
+func (self setStorage) Add(member core.StrValue) {
+	self[member] = struct{}{}
+}
+
+func (self setStorage) Delete(member core.StrValue) {
+	delete(self, member)
+}
+
+type setObject struct {
+	storage setStorage
+	size    int
+}
+
+func (self *setObject) Add(members ...core.StrValue) core.IntValue {
+	var counter int
+	for _, m := range members {
+		if self.storage.Has(m) {
+			continue
+		}
+		self.storage.Add(m)
+		self.size += len(m) + elementOverhead
+		counter += 1
+	}
+	return core.IntValue(counter)
+}
+
+func (self *setObject) Rem(members ...core.StrValue) core.IntValue {
+	var counter int
+	for _, m := range members {
+		if !self.storage.Has(m) {
+			continue
+		}
+		self.storage.Delete(m)
+		self.size -= len(m) + elementOverhead
+		counter += 1
+	}
+	return core.IntValue(counter)
+}
+
+func (self *setObject) IsMember(member core.StrValue) bool {
+	return self.storage.Has(member)
+}
+
+func (self *setObject) Members() []core.StrValue {
+	members := make([]core.StrValue, 0, len(self.storage))
+	for m := range self.storage {
+		members = append(members, m)
+	}
+	return members
+}
+
+func (self *setObject) Len() core.IntValue {
+	return core.IntValue(len(self.storage))
+}
+
+func (self *setObject) Size() int {
+	return self.size
+}
+
+func NewSet() Set {
+	return &setObject{storage: setStorage{}}
+}
+
+// members of the first set which are present in all of the others
+func SetInter(sets ...Set) []core.StrValue {
+	if len(sets) == 0 {
+		return []core.StrValue{}
+	}
+	members := make([]core.StrValue, 0)
+	for _, m := range sets[0].Members() {
+		found := true
+		for _, s := range sets[1:] {
+			if !s.IsMember(m) {
+				found = false
+				break
+			}
+		}
+		if found {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+func SetUnion(sets ...Set) []core.StrValue {
+	union := NewSet()
+	for _, s := range sets {
+		union.Add(s.Members()...)
+	}
+	return union.Members()
+}
+
+// members of the first set which are not present in any of the others
+func SetDiff(sets ...Set) []core.StrValue {
+	if len(sets) == 0 {
+		return []core.StrValue{}
+	}
+	members := make([]core.StrValue, 0)
+	for _, m := range sets[0].Members() {
+		found := false
+		for _, s := range sets[1:] {
+			if s.IsMember(m) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			members = append(members, m)
+		}
+	}
+	return members
+}
@@ -0,0 +1,315 @@
+package types
+
+import (
+	"math/rand"
+
+	"github.com/auvn/go.cache/core"
+)
+
+const (
+	skipListMaxLevel    = 32
+	skipListProbability = 0.25
+)
+
+var (
+	emptySortedSetItems = []SortedSetItem{}
+)
+
+type SortedSetItem struct {
+	Member core.StrValue
+	Score  core.FloatValue
+}
+
+type SortedSet interface {
+	Add(score core.FloatValue, member core.StrValue) bool
+	Rem(members ...core.StrValue) core.IntValue
+	Score(member core.StrValue) (core.FloatValue, bool)
+	Rank(member core.StrValue) (core.IntValue, bool)
+	Range(start, stop core.IntValue) []SortedSetItem
+	RangeByScore(min, max core.FloatValue) []SortedSetItem
+	Len() core.IntValue
+	Size() int
+}
+
+type skipListLevel struct {
+	Forward *skipListNode
+	Span    int
+}
+
+type skipListNode struct {
+	SortedSetItem
+	Backward *skipListNode
+	Levels   []skipListLevel
+}
+
+// true if the node should be placed before the (score, member) pair
+func (self *skipListNode) before(score core.FloatValue, member core.StrValue) bool {
+	return self.Score < score || (self.Score == score && self.Member < member)
+}
+
+func newSkipListNode(level int, score core.FloatValue, member core.StrValue) *skipListNode {
+	return &skipListNode{
+		SortedSetItem: SortedSetItem{Member: member, Score: score},
+		Levels:        make([]skipListLevel, level),
+	}
+}
+
+type skipList struct {
+	Head   *skipListNode
+	Tail   *skipListNode
+	Length int
+	Level  int
+}
+
+func (self *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListProbability {
+		level += 1
+	}
+	return level
+}
+
+func (self *skipList) insert(score core.FloatValue, member core.StrValue) *skipListNode {
+	var update [skipListMaxLevel]*skipListNode
+	var rank [skipListMaxLevel]int
+
+	cursor := self.Head
+	for i := self.Level - 1; i >= 0; i-- {
+		if i != self.Level-1 {
+			rank[i] = rank[i+1]
+		}
+		for next := cursor.Levels[i].Forward; next != nil && next.before(score, member); next = cursor.Levels[i].Forward {
+			rank[i] += cursor.Levels[i].Span
+			cursor = next
+		}
+		update[i] = cursor
+	}
+
+	level := self.randomLevel()
+	if level > self.Level {
+		for i := self.Level; i < level; i++ {
+			rank[i] = 0
+			update[i] = self.Head
+			update[i].Levels[i].Span = self.Length
+		}
+		self.Level = level
+	}
+
+	node := newSkipListNode(level, score, member)
+	for i := 0; i < level; i++ {
+		node.Levels[i].Forward = update[i].Levels[i].Forward
+		update[i].Levels[i].Forward = node
+		node.Levels[i].Span = update[i].Levels[i].Span - (rank[0] - rank[i])
+		update[i].Levels[i].Span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < self.Level; i++ {
+		update[i].Levels[i].Span += 1
+	}
+
+	if update[0] != self.Head {
+		node.Backward = update[0]
+	}
+	if next := node.Levels[0].Forward; next != nil {
+		next.Backward = node
+	} else {
+		self.Tail = node
+	}
+	self.Length += 1
+	return node
+}
+
+func (self *skipList) delete(score core.FloatValue, member core.StrValue) bool {
+	var update [skipListMaxLevel]*skipListNode
+
+	cursor := self.Head
+	for i := self.Level - 1; i >= 0; i-- {
+		for next := cursor.Levels[i].Forward; next != nil && next.before(score, member); next = cursor.Levels[i].Forward {
+			cursor = next
+		}
+		update[i] = cursor
+	}
+
+	node := cursor.Levels[0].Forward
+	if node == nil || node.Score != score || node.Member != member {
+		return false
+	}
+
+	for i := 0; i < self.Level; i++ {
+		if update[i].Levels[i].Forward == node {
+			update[i].Levels[i].Span += node.Levels[i].Span - 1
+			update[i].Levels[i].Forward = node.Levels[i].Forward
+		} else {
+			update[i].Levels[i].Span -= 1
+		}
+	}
+	if next := node.Levels[0].Forward; next != nil {
+		next.Backward = node.Backward
+	} else {
+		self.Tail = node.Backward
+	}
+	for self.Level > 1 && self.Head.Levels[self.Level-1].Forward == nil {
+		self.Level -= 1
+	}
+	self.Length -= 1
+	return true
+}
+
+// 1-based rank of the element, 0 if the element is not found
+func (self *skipList) rank(score core.FloatValue, member core.StrValue) int {
+	var rank int
+	cursor := self.Head
+	for i := self.Level - 1; i >= 0; i-- {
+		for next := cursor.Levels[i].Forward; next != nil && (next.before(score, member) || next.Member == member); next = cursor.Levels[i].Forward {
+			rank += cursor.Levels[i].Span
+			cursor = next
+		}
+		if cursor != self.Head && cursor.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// element by its 1-based rank
+func (self *skipList) byRank(rank int) *skipListNode {
+	var traversed int
+	cursor := self.Head
+	for i := self.Level - 1; i >= 0; i-- {
+		for next := cursor.Levels[i].Forward; next != nil && traversed+cursor.Levels[i].Span <= rank; next = cursor.Levels[i].Forward {
+			traversed += cursor.Levels[i].Span
+			cursor = next
+		}
+		if traversed == rank {
+			return cursor
+		}
+	}
+	return nil
+}
+
+// the first element with a score not less than min
+func (self *skipList) firstFrom(min core.FloatValue) *skipListNode {
+	cursor := self.Head
+	for i := self.Level - 1; i >= 0; i-- {
+		for next := cursor.Levels[i].Forward; next != nil && next.Score < min; next = cursor.Levels[i].Forward {
+			cursor = next
+		}
+	}
+	return cursor.Levels[0].Forward
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		Head:  newSkipListNode(skipListMaxLevel, 0, core.EmptyStrValue),
+		Level: 1,
+	}
+}
+
+type sortedSetObject struct {
+	scores map[core.StrValue]core.FloatValue
+	list   *skipList
+	size   int
+}
+
+// true if the member is a new one
+func (self *sortedSetObject) Add(score core.FloatValue, member core.StrValue) bool {
+	current, ok := self.scores[member]
+	if ok {
+		if current == score {
+			return false
+		}
+		self.list.delete(current, member)
+	}
+	self.list.insert(score, member)
+	self.scores[member] = score
+	if !ok {
+		self.size += 2*len(member) + 2*elementOverhead
+	}
+	return !ok
+}
+
+func (self *sortedSetObject) Rem(members ...core.StrValue) core.IntValue {
+	var counter int
+	for _, m := range members {
+		score, ok := self.scores[m]
+		if !ok {
+			continue
+		}
+		self.list.delete(score, m)
+		delete(self.scores, m)
+		self.size -= 2*len(m) + 2*elementOverhead
+		counter += 1
+	}
+	return core.IntValue(counter)
+}
+
+func (self *sortedSetObject) Score(member core.StrValue) (core.FloatValue, bool) {
+	score, ok := self.scores[member]
+	return score, ok
+}
+
+// 0-based rank of the member
+func (self *sortedSetObject) Rank(member core.StrValue) (core.IntValue, bool) {
+	score, ok := self.scores[member]
+	if !ok {
+		return core.EmptyIntValue, false
+	}
+	return core.IntValue(self.list.rank(score, member) - 1), true
+}
+
+func (self *sortedSetObject) Range(start, stop core.IntValue) []SortedSetItem {
+	startVal := start.Value()
+	stopVal := stop.Value()
+	length := self.list.Length
+
+	if startVal < 0 {
+		startVal = length + startVal
+	}
+	if startVal < 0 {
+		startVal = 0
+	}
+	if stopVal < 0 {
+		stopVal = length + stopVal
+	}
+
+	if startVal > stopVal || startVal >= length {
+		return emptySortedSetItems
+	}
+
+	if stopVal >= length {
+		stopVal = length - 1
+	}
+
+	items := make([]SortedSetItem, 0, stopVal-startVal+1)
+	cursor := self.list.byRank(startVal + 1)
+	for i := startVal; i <= stopVal; i++ {
+		items = append(items, cursor.SortedSetItem)
+		cursor = cursor.Levels[0].Forward
+	}
+	return items
+}
+
+func (self *sortedSetObject) RangeByScore(min, max core.FloatValue) []SortedSetItem {
+	if min > max {
+		return emptySortedSetItems
+	}
+	items := make([]SortedSetItem, 0)
+	for cursor := self.list.firstFrom(min); cursor != nil && cursor.Score <= max; cursor = cursor.Levels[0].Forward {
+		items = append(items, cursor.SortedSetItem)
+	}
+	return items
+}
+
+func (self *sortedSetObject) Len() core.IntValue {
+	return core.IntValue(self.list.Length)
+}
+
+func (self *sortedSetObject) Size() int {
+	return self.size
+}
+
+func NewSortedSet() SortedSet {
+	return &sortedSetObject{
+		scores: map[core.StrValue]core.FloatValue{},
+		list:   newSkipList(),
+	}
+}
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/auvn/go.cache/core"
+)
+
+func newTestSortedSet(items ...SortedSetItem) SortedSet {
+	z := NewSortedSet()
+	for _, item := range items {
+		z.Add(item.Score, item.Member)
+	}
+	return z
+}
+
+var (
+	testSortedSetItems = []SortedSetItem{
+		{Member: "c", Score: 3},
+		{Member: "a", Score: 1},
+		{Member: "d", Score: 3},
+		{Member: "b", Score: 2},
+		{Member: "e", Score: 5},
+	}
+)
+
+func Test_sortedSetObject_Range(t *testing.T) {
+	type args struct {
+		start core.IntValue
+		stop  core.IntValue
+	}
+	tests := []struct {
+		name string
+		args args
+		want []core.StrValue
+	}{
+		{
+			name: "All",
+			args: args{start: 0, stop: -1},
+			want: []core.StrValue{"a", "b", "c", "d", "e"},
+		},
+		{
+			name: "Middle",
+			args: args{start: 1, stop: 3},
+			want: []core.StrValue{"b", "c", "d"},
+		},
+		{
+			name: "Tail",
+			args: args{start: -2, stop: 100},
+			want: []core.StrValue{"d", "e"},
+		},
+		{
+			name: "Empty",
+			args: args{start: 3, stop: 1},
+			want: []core.StrValue{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := newTestSortedSet(testSortedSetItems...)
+			items := self.Range(tt.args.start, tt.args.stop)
+			got := make([]core.StrValue, len(items))
+			for i, item := range items {
+				got[i] = item.Member
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortedSetObject.Range() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sortedSetObject_RangeByScore(t *testing.T) {
+	type args struct {
+		min core.FloatValue
+		max core.FloatValue
+	}
+	tests := []struct {
+		name string
+		args args
+		want []core.StrValue
+	}{
+		{
+			name: "Inclusive",
+			args: args{min: 2, max: 3},
+			want: []core.StrValue{"b", "c", "d"},
+		},
+		{
+			name: "Gap",
+			args: args{min: 3.5, max: 4.5},
+			want: []core.StrValue{},
+		},
+		{
+			name: "Inverted",
+			args: args{min: 5, max: 1},
+			want: []core.StrValue{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := newTestSortedSet(testSortedSetItems...)
+			items := self.RangeByScore(tt.args.min, tt.args.max)
+			got := make([]core.StrValue, len(items))
+			for i, item := range items {
+				got[i] = item.Member
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortedSetObject.RangeByScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sortedSetObject_Rank(t *testing.T) {
+	tests := []struct {
+		name   string
+		member core.StrValue
+		want   core.IntValue
+		wantOk bool
+	}{
+		{name: "First", member: "a", want: 0, wantOk: true},
+		{name: "SameScore", member: "d", want: 3, wantOk: true},
+		{name: "Last", member: "e", want: 4, wantOk: true},
+		{name: "Missing", member: "x", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			self := newTestSortedSet(testSortedSetItems...)
+			got, ok := self.Rank(tt.member)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("sortedSetObject.Rank() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_sortedSetObject_AddRem(t *testing.T) {
+	self := newTestSortedSet(testSortedSetItems...)
+	if self.Add(0, "e") {
+		t.Errorf("sortedSetObject.Add() updated member reported as new")
+	}
+	if got := self.Rem("a", "x", "c"); got != 2 {
+		t.Errorf("sortedSetObject.Rem() = %v, want %v", got, 2)
+	}
+	items := self.Range(0, -1)
+	got := make([]core.StrValue, len(items))
+	for i, item := range items {
+		got[i] = item.Member
+	}
+	want := []core.StrValue{"e", "b", "d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedSetObject.Range() = %v, want %v", got, want)
+	}
+	if got := self.Len(); got != 3 {
+		t.Errorf("sortedSetObject.Len() = %v, want %v", got, 3)
+	}
+}
@@ -7,6 +7,7 @@ import (
 type String interface {
 	Set(s core.Value)
 	Get() core.Value
+	Size() int
 }
 
 type strObject struct {
@@ -21,6 +22,10 @@ func (self *strObject) Get() core.Value {
 	return self.value
 }
 
+func (self *strObject) Size() int {
+	return len(self.value)
+}
+
 func NewString(v core.Value) String {
 	return &strObject{value: v}
 }